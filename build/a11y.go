@@ -0,0 +1,118 @@
+// Copyright 2023 Daniel Erat.
+// All rights reserved.
+
+package build
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path"
+	"regexp"
+	"strings"
+
+	"github.com/derat/validate"
+	"golang.org/x/net/html"
+)
+
+// a11yValidator is a streamValidator that checks HTML documents for accessibility problems:
+// skipped heading levels, placeholder alt text, and links without discernible text.
+type a11yValidator struct{}
+
+func (v *a11yValidator) validateStream(ctx context.Context, r io.Reader) ([]validate.Issue, error) {
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	return checkAccessibility(b), nil
+}
+
+// placeholderAltRegexp matches alt text that doesn't describe an image.
+var placeholderAltRegexp = regexp.MustCompile(
+	`(?i)^(alt|graphic|image|img|photo|picture|placeholder|screenshot|spacer|untitled)\s*\d*$` +
+		`|\.(avif|gif|jpe?g|png|svg|webp)$`)
+
+// headingRegexp matches heading element names and captures the level.
+var headingRegexp = regexp.MustCompile(`^h([1-6])$`)
+
+// checkAccessibility checks the HTML document in b and returns any issues that were found.
+func checkAccessibility(b []byte) []validate.Issue {
+	var issues []validate.Issue
+	var lastHeading int // level of last heading, or 0 if none seen
+
+	// link describes the currently-open <a> element.
+	type link struct {
+		line, col int
+		hasText   bool // link has text or a labeled image
+	}
+	var curLink *link
+	var skip int // depth within elements whose text isn't rendered (e.g. <script>)
+
+	walkHTMLTokens(b, func(z *html.Tokenizer, tt html.TokenType, line, col int) {
+		add := func(format string, args ...interface{}) {
+			issues = append(issues, validate.Issue{Line: line, Col: col, Message: fmt.Sprintf(format, args...)})
+		}
+		switch tt {
+		case html.StartTagToken, html.SelfClosingTagToken:
+			tn, hasAttr := z.TagName()
+			name := string(tn)
+			attrs := make(map[string]string)
+			for hasAttr {
+				var k, v []byte
+				k, v, hasAttr = z.TagAttr()
+				attrs[string(k)] = string(v)
+			}
+
+			if m := headingRegexp.FindStringSubmatch(name); m != nil {
+				level := int(m[1][0] - '0')
+				if lastHeading != 0 && level > lastHeading+1 {
+					add("Heading level skipped: h%d follows h%d.", level, lastHeading)
+				}
+				lastHeading = level
+			}
+
+			switch name {
+			case "a":
+				if _, ok := attrs["href"]; ok && tt == html.StartTagToken {
+					curLink = &link{line: line, col: col,
+						hasText: strings.TrimSpace(attrs["aria-label"]) != "" ||
+							attrs["aria-labelledby"] != "" || strings.TrimSpace(attrs["title"]) != ""}
+				}
+			case "img", "amp-img":
+				alt, ok := attrs["alt"]
+				alt = strings.TrimSpace(alt)
+				if ok && alt != "" && (placeholderAltRegexp.MatchString(alt) ||
+					strings.EqualFold(alt, path.Base(attrs["src"]))) {
+					add("Image has placeholder alt text %q.", alt)
+				}
+				if curLink != nil && alt != "" {
+					curLink.hasText = true
+				}
+			case "script", "style", "template":
+				if tt == html.StartTagToken {
+					skip++
+				}
+			}
+		case html.EndTagToken:
+			tn, _ := z.TagName()
+			switch string(tn) {
+			case "a":
+				if curLink != nil && !curLink.hasText {
+					issues = append(issues, validate.Issue{Line: curLink.line, Col: curLink.col,
+						Message: "Link has no discernible text."})
+				}
+				curLink = nil
+			case "script", "style", "template":
+				if skip > 0 {
+					skip--
+				}
+			}
+		case html.TextToken:
+			if curLink != nil && skip == 0 && strings.TrimSpace(string(z.Text())) != "" {
+				curLink.hasText = true
+			}
+		}
+	})
+	return issues
+}
@@ -0,0 +1,48 @@
+// Copyright 2023 Daniel Erat.
+// All rights reserved.
+
+package build
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func TestCheckAccessibility(t *testing.T) {
+	for _, tc := range []struct {
+		doc  string
+		want []string // "line:col message"
+	}{
+		{`<!DOCTYPE html>
+<html><body><h1>Title</h1><h2>Sub</h2><h3>Subsub</h3><h2>Sub 2</h2>
+<a href="a.html">Text</a> <a href="b.html"><img src="b.png" alt="Described"></a>
+<a href="c.html" aria-label="Label"></a> <a name="anchor"></a>
+<img src="spacer.gif" alt=""> <script>var a = "<a href='x'></a>";</script></body></html>`, nil},
+		{"<h1>A</h1>\n<h3>B</h3><h2>C</h2><h4>D</h4>", []string{
+			"2:1 Heading level skipped: h3 follows h1.",
+			"2:21 Heading level skipped: h4 follows h2.",
+		}},
+		{`<img src="cat.jpg" alt="cat.jpg"><img src="a.png" alt="IMG_1234.PNG">` +
+			`<amp-img src="b.png" alt="image"></amp-img><img src="c.png" alt="Photo 3">`, []string{
+			`1:1 Image has placeholder alt text "cat.jpg".`,
+			`1:34 Image has placeholder alt text "IMG_1234.PNG".`,
+			`1:70 Image has placeholder alt text "image".`,
+			`1:113 Image has placeholder alt text "Photo 3".`,
+		}},
+		{"<a href=\"a.html\"> </a>\n<a href=\"b.html\"><img src=\"b.png\" alt=\"\"></a>", []string{
+			"1:1 Link has no discernible text.",
+			"2:1 Link has no discernible text.",
+		}},
+		// Duplicate IDs are reported by the structural validator instead.
+		{"<div id=\"a\">\n<span id=\"a\">x</span></div>", nil},
+	} {
+		var got []string
+		for _, is := range checkAccessibility([]byte(tc.doc)) {
+			got = append(got, fmt.Sprintf("%d:%d %s", is.Line, is.Col, is.Message))
+		}
+		if !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("checkAccessibility(%q) = %q; want %q", tc.doc, got, tc.want)
+		}
+	}
+}
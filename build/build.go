@@ -5,12 +5,18 @@ package build
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
 	"fmt"
+	"io"
 	"io/ioutil"
+	"net/http"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/derat/intransigence/render"
@@ -40,15 +46,79 @@ const (
 	Serve
 	// Validate indicates that HTML and CSS output should be validated.
 	Validate
+	// Incremental indicates that pages and iframes whose inputs haven't changed since the
+	// previous build should be copied from the build cache instead of being regenerated.
+	Incremental
+	// LiveReload indicates that non-AMP pages should include a script that reloads them
+	// after the site is rebuilt. It is used by Watch.
+	LiveReload
+	// DiffIgnoreSpace indicates that whitespace-only changes to text files (e.g. caused by
+	// pretty-printing) should be omitted from the diff displayed for Prompt.
+	DiffIgnoreSpace
+	// CheckExternal indicates that absolute links to other sites in generated pages should be
+	// checked over HTTP and a report of dead, redirected, and timed-out links should be logged.
+	CheckExternal
+	// Revalidate indicates that Validate should check all generated files instead of reusing
+	// cached results for files whose contents haven't changed since they were last validated.
+	Revalidate
 )
 
+// Options contains additional non-boolean settings that control how the site is built.
+type Options struct {
+	// Jobs contains the maximum number of pages, iframes, stylesheets, or images to process in
+	// parallel. If non-positive, the number of CPUs is used.
+	Jobs int
+	// HTTPClient is used to check external links for CheckExternal.
+	// If nil, a default client is used.
+	HTTPClient *http.Client
+	// ExternalTTL is the maximum age of cached results from checking external links.
+	// If non-positive, DefaultExternalTTL is used.
+	ExternalTTL time.Duration
+	// Validator names the backend used for Validate (e.g. BuiltinValidator).
+	// If empty, render.SiteInfo.Validator is used.
+	Validator string
+	// ValidateReport contains a path prefix for writing machine-readable reports for Validate.
+	// If non-empty, all issues (including ignored ones) are written to ValidateReport+".json"
+	// as JSON and to ValidateReport+".xml" as JUnit XML.
+	ValidateReport string
+}
+
 // Build builds the site rooted at dir into the directory named by out.
 // If out is empty, the site is built into outSubdir under the site directory.
-func Build(ctx context.Context, dir, out string, flags Flags) error {
+// opts may be nil to use default options.
+func Build(ctx context.Context, dir, out string, flags Flags, opts *Options) error {
+	if opts == nil {
+		opts = &Options{}
+	}
+
 	si, err := render.NewSiteInfo(filepath.Join(dir, siteFile))
 	if err != nil {
 		return fmt.Errorf("failed to load site info: %v", err)
 	}
+	si.LiveReload = flags&LiveReload != 0
+	comp, err := newCompressor(si)
+	if err != nil {
+		return err
+	}
+	var validator *validatorBackend
+	var ignoreRules []*ignoreRule
+	var codeContrast []string
+	if flags&Validate != 0 {
+		name := opts.Validator
+		if name == "" {
+			name = si.Validator
+		}
+		if validator, err = newValidatorBackend(name, si.VNUPath); err != nil {
+			return err
+		}
+		if ignoreRules, err = newIgnoreRules(si.Validation.Ignore, time.Now()); err != nil {
+			return err
+		}
+		if si.Validation.Accessibility {
+			validator.a11y = &a11yValidator{}
+			codeContrast = si.CodeContrastIssues()
+		}
+	}
 
 	// If an output directory wasn't specified, create a temp dir within the site dir to build into.
 	buildToSiteDir := false
@@ -66,29 +136,120 @@ func Build(ctx context.Context, dir, out string, flags Flags) error {
 	}
 
 	// Generate inline CSS files before they get included in pages and iframes.
-	// Also create WebP images so that their existence can be checked when generating pages.
-	if err := generateCSS(si.InlineDir(), si.InlineGenDir()); err != nil {
+	// Also create scaled, WebP, and AVIF images so that their existence can be checked when
+	// generating pages.
+	if err := generateCSS(si.InlineDir(), si.InlineGenDir(), si.UseSassc, opts.Jobs); err != nil {
 		return err
 	}
-	if err := generateWebP(si.StaticDir(), si.StaticGenDir()); err != nil {
+	if err := generateResizedImages(si, opts.Jobs); err != nil {
 		return err
 	}
+	imgDirs := []string{si.StaticDir(), si.StaticGenDir()}
+	if err := generateWebP(imgDirs, si.StaticGenDir(), opts.Jobs); err != nil {
+		return err
+	}
+	if si.GenerateAVIF {
+		if err := generateAVIF(imgDirs, si.StaticGenDir(), opts.Jobs); err != nil {
+			return err
+		}
+	}
 
 	exeTime := getExeTime()
+	pretty := flags&PrettyPrint != 0
+	var cache *buildCache
+	if flags&Incremental != 0 {
+		// Discard the cache if the executable or any settings that affect output have changed.
+		// The executable is identified by its contents rather than its mtime, since the mtime
+		// is unavailable for renamed binaries and under "go run".
+		if exeHash, err := getExeHash(); err != nil {
+			logf("Not using build cache: %v", err)
+		} else {
+			key := fmt.Sprintf("version=%d exe=%s pretty=%v reload=%v",
+				cacheVersion, exeHash, pretty, si.LiveReload)
+			if cache, err = loadBuildCache(dir, key); err != nil {
+				return fmt.Errorf("failed to load build cache: %v", err)
+			}
+		}
+	}
+
+	// Record where output files came from for the build manifest.
+	// Later entries overwrite earlier ones, just as later copies overwrite earlier files.
+	sources := make(fileSources)
+	outRel := func(ps []string) []string {
+		rels := make([]string, len(ps))
+		for i, p := range ps {
+			rels[i] = p[len(out)+1:]
+		}
+		return rels
+	}
+
 	var genPaths []string
 	var feedInfos []render.PageFeedInfo
-	if genPaths, feedInfos, err = generatePages(si, out, flags&PrettyPrint != 0, exeTime); err != nil {
+	var pageMetas map[string]*render.PageMeta
+	if genPaths, feedInfos, pageMetas, err = generatePages(si, out, pretty, exeTime, opts.Jobs, cache); err != nil {
+		return err
+	}
+	pagePaths := outRel(genPaths)
+	sources.add(sourcePage, outRel(genPaths), func(rel string) string {
+		base := strings.TrimSuffix(rel, render.AMPExt)
+		base = strings.TrimSuffix(base, render.HTMLExt)
+		if meta := pageMetas[rel]; meta != nil && meta.PageNum > 1 {
+			base = strings.TrimSuffix(base, fmt.Sprintf("-%d", meta.PageNum))
+		}
+		return filepath.Join(filepath.Base(si.PageDir()), base+".md")
+	})
+	tagged, err := collectTags(pageMetas)
+	if err != nil {
 		return err
 	}
-	if ps, err := generateIframes(si, out, flags&PrettyPrint != 0, exeTime); err != nil {
+	if ps, metas, err := generateTagPages(si, out, pretty, tagged, pageMetas); err != nil {
 		return err
 	} else {
 		genPaths = append(genPaths, ps...)
+		pagePaths = append(pagePaths, outRel(ps)...)
+		for rel, meta := range metas {
+			pageMetas[rel] = meta
+		}
+		sources.add(sourceTag, outRel(ps), nil)
+	}
+	if ps, err := generateIframes(si, out, pretty, exeTime, opts.Jobs, cache); err != nil {
+		return err
+	} else {
+		genPaths = append(genPaths, ps...)
+		sources.add(sourceIframe, outRel(ps), func(rel string) string {
+			base := strings.TrimSuffix(filepath.Base(rel), render.HTMLExt)
+			return filepath.Join(filepath.Base(si.IframeDir()), base+".yaml")
+		})
+	}
+	if err := cache.save(); err != nil {
+		return fmt.Errorf("failed to save build cache: %v", err)
 	}
 
 	// Only validate generated files -- we don't want to fail on issues in static files.
 	if flags&Validate != 0 {
-		if err := validateFiles(ctx, genPaths); err != nil {
+		// Discard cached results if the executable has changed, since the built-in checks may differ,
+		// or if the validator configuration has changed.
+		var vcache *validateCache
+		if exeHash, err := getExeHash(); err != nil {
+			logf("Not using validation cache: %v", err)
+		} else {
+			key := fmt.Sprintf("version=%d exe=%s vnu=%q", validateCacheVersion, exeHash, si.VNUPath)
+			if vcache, err = loadValidateCache(dir, key, flags&Revalidate != 0); err != nil {
+				return fmt.Errorf("failed to load validation cache: %v", err)
+			}
+		}
+		report, err := validateFiles(ctx, genPaths, validator, vcache, ignoreRules, codeContrast)
+		if ctx.Err() == nil {
+			if err := vcache.save(); err != nil {
+				return fmt.Errorf("failed to save validation cache: %v", err)
+			}
+		}
+		if report != nil && opts.ValidateReport != "" {
+			if err := report.writeFiles(opts.ValidateReport); err != nil {
+				return fmt.Errorf("failed writing validation report: %v", err)
+			}
+		}
+		if err != nil {
 			return err
 		}
 	}
@@ -98,6 +259,9 @@ func Build(ctx context.Context, dir, out string, flags Flags) error {
 	if err := copy.Copy(si.StaticDir(), out, copyOpts); err != nil {
 		return err
 	}
+	if err := sources.addDir(sourceStatic, dir, filepath.Base(si.StaticDir()), "", nil); err != nil {
+		return err
+	}
 	for src, dst := range si.ExtraStaticDirs {
 		dp := filepath.Clean(filepath.Join(out, dst))
 		if !strings.HasPrefix(dp, out+"/") {
@@ -106,34 +270,124 @@ func Build(ctx context.Context, dir, out string, flags Flags) error {
 		if err := copy.Copy(filepath.Join(dir, src), dp, copyOpts); err != nil {
 			return err
 		}
+		if err := sources.addDir(sourceExtraStatic, dir, filepath.Clean(src), dp[len(out)+1:], nil); err != nil {
+			return err
+		}
 	}
-	// Also copy over generated WebP images.
+	// Also copy over generated scaled, WebP, and AVIF images.
 	gd := si.StaticGenDir()
 	if err := filepath.Walk(gd, func(p string, fi os.FileInfo, err error) error {
 		if err != nil {
 			return err
 		}
-		if fi.Mode()&os.ModeType == 0 && filepath.Ext(p) == render.WebPExt {
-			return copy.Copy(p, filepath.Join(out, p[len(gd)+1:]), copyOpts)
+		if fi.Mode()&os.ModeType != 0 {
+			return nil
+		}
+		// Skip stale AVIF images left over from when they were enabled.
+		if filepath.Ext(p) == render.AVIFExt && !si.GenerateAVIF {
+			return nil
 		}
-		return nil
+		rel := p[len(gd)+1:]
+		sources[rel] = fileSource{sourceGenImage, filepath.Join(gd[len(dir)+1:], rel)}
+		return copy.Copy(p, filepath.Join(out, rel), copyOpts)
 	}); err != nil {
 		return err
 	}
 
-	// TODO: Try to preserve sitemap and feed timestamps somehow?
-	if err := writeSitemap(filepath.Join(out, sitemapFile), si); err != nil {
+	// Give cacheable static files content-hashed names to match the references in pages.
+	if err := fingerprintFiles(out, si, sources); err != nil {
+		return fmt.Errorf("fingerprinting failed: %v", err)
+	}
+
+	// TODO: Try to preserve sitemap timestamps somehow?
+	if err := writeSitemap(filepath.Join(out, sitemapFile), pageMetas); err != nil {
 		return fmt.Errorf("sitemap failed: %v", err)
 	}
-	if err := writeFeed(filepath.Join(out, render.FeedFile), si, feedInfos); err != nil {
+	feedFiles, err := writeFeeds(out, si, feedInfos)
+	if err != nil {
 		return fmt.Errorf("feed failed: %v", err)
 	}
+	tagFeedFiles, err := writeTagFeeds(out, si, tagged, feedInfos)
+	if err != nil {
+		return fmt.Errorf("tag feed failed: %v", err)
+	}
+	sources.add(sourceSitemap, []string{sitemapFile}, nil)
+	sources.add(sourceFeed, feedFiles, nil)
+	sources.add(sourceTag, tagFeedFiles, nil)
+
+	// Check that internal links in generated pages point at output files now that everything
+	// (including fingerprinted files) has been written.
+	if broken, err := checkLinks(out, si.BaseURL, genPaths); err != nil {
+		return fmt.Errorf("link check failed: %v", err)
+	} else if len(broken) > 0 {
+		for _, bl := range broken {
+			logf("%s\n", bl.String())
+		}
+		if flags&Validate != 0 {
+			return fmt.Errorf("found %d broken link(s)", len(broken))
+		}
+	}
 
-	// Create gzipped versions of text-based files for the HTTP server to use.
-	if si.CompressPages {
-		if err := compressDir(out); err != nil {
+	// Check page sizes now that images have their final names.
+	if weights, exceeded, err := checkPageWeights(out, pagePaths, pageMetas, si.PageBudgets); err != nil {
+		return fmt.Errorf("measuring pages failed: %v", err)
+	} else {
+		if si.PageBudgets != (render.PageBudgets{}) {
+			var b strings.Builder
+			writeWeightTable(&b, weights)
+			logf("%s", b.String())
+		}
+		for _, s := range exceeded {
+			logf("%s\n", s)
+		}
+		if len(exceeded) > 0 {
+			return fmt.Errorf("exceeded %d page size limit(s)", len(exceeded))
+		}
+	}
+
+	if flags&CheckExternal != 0 {
+		ec := newExternalChecker(opts.HTTPClient, opts.ExternalTTL)
+		report, err := checkExternalLinks(ctx, ec, dir, out, si.BaseURL, genPaths)
+		if err != nil {
+			return fmt.Errorf("external link check failed: %v", err)
+		}
+		var b strings.Builder
+		report.write(&b)
+		logf("%s", b.String())
+	}
+
+	// Give open pages a new token to tell them to reload themselves.
+	if si.LiveReload {
+		tok := []byte(strconv.FormatInt(time.Now().UnixNano(), 10))
+		if err := ioutil.WriteFile(filepath.Join(out, render.LiveReloadFile), tok, fileMode); err != nil {
 			return err
 		}
+		sources.add(sourceLiveReload, []string{render.LiveReloadFile}, nil)
+	}
+
+	// Remove any manifest left over from an earlier build into the same dir
+	// so that it won't be compressed.
+	if si.BuildManifestFile != "" {
+		if _, ok := sources[si.BuildManifestFile]; !ok {
+			if err := os.Remove(filepath.Join(out, si.BuildManifestFile)); err != nil && !os.IsNotExist(err) {
+				return err
+			}
+		}
+	}
+
+	// Create compressed versions of text-based files for the HTTP server to use.
+	if comp != nil {
+		if err := comp.compressDir(out); err != nil {
+			return err
+		}
+	}
+
+	// Describe the output files. This happens after compression so the manifest lists
+	// compressed files (but isn't compressed itself).
+	if si.BuildManifestFile != "" {
+		if err := writeManifest(out, si.BuildManifestFile, sources); err != nil {
+			return fmt.Errorf("manifest failed: %v", err)
+		}
 	}
 
 	// Update directory timestamps to improve rsync performance.
@@ -149,7 +403,7 @@ func Build(ctx context.Context, dir, out string, flags Flags) error {
 		} else if err == nil {
 			// Show a diff and confirm that we should replace the existing output dir.
 			if flags&Prompt != 0 {
-				if ok, err := prompt(ctx, dest, out, flags&Serve != 0); err != nil {
+				if ok, err := prompt(ctx, dest, out, flags&Serve != 0, flags&DiffIgnoreSpace != 0); err != nil {
 					return fmt.Errorf("failed displaying diff: %v", err)
 				} else if !ok {
 					return errors.New("diff rejected")
@@ -173,6 +427,12 @@ func Build(ctx context.Context, dir, out string, flags Flags) error {
 	return nil
 }
 
+// OutDir returns the directory that the site rooted at dir is built into when
+// Build is called with an empty out argument.
+func OutDir(dir string) string {
+	return filepath.Join(dir, outSubdir)
+}
+
 // getExeTime returns the intransigence executable's mtime.
 // The zero time is returned during testing or if an error is encountered.
 func getExeTime() time.Time {
@@ -186,3 +446,34 @@ func getExeTime() time.Time {
 	}
 	return fi.ModTime()
 }
+
+var exeHashOnce struct {
+	sync.Once
+	hash string
+	err  error
+}
+
+// getExeHash returns a hex-encoded SHA-256 hash of the running executable's contents.
+// The hash is only computed once per process.
+func getExeHash() (string, error) {
+	exeHashOnce.Do(func() {
+		exe, err := os.Executable()
+		if err != nil {
+			exeHashOnce.err = err
+			return
+		}
+		f, err := os.Open(exe)
+		if err != nil {
+			exeHashOnce.err = err
+			return
+		}
+		defer f.Close()
+		h := sha256.New()
+		if _, err := io.Copy(h, f); err != nil {
+			exeHashOnce.err = err
+			return
+		}
+		exeHashOnce.hash = hex.EncodeToString(h.Sum(nil))
+	})
+	return exeHashOnce.hash, exeHashOnce.err
+}
@@ -7,11 +7,17 @@ import (
 	"bytes"
 	"compress/gzip"
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
 	"flag"
 	"fmt"
+	"image"
+	_ "image/jpeg"
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"reflect"
 	"regexp"
 	"strings"
 	"testing"
@@ -19,6 +25,8 @@ import (
 
 	"github.com/derat/intransigence/render"
 
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/zstd"
 	"github.com/otiai10/copy"
 	"github.com/pmezard/go-difflib/difflib"
 )
@@ -39,7 +47,7 @@ func TestBuild_Full(t *testing.T) {
 	if validateTest {
 		flags |= Validate
 	}
-	if err := Build(context.Background(), dir, "", flags); err != nil {
+	if err := Build(context.Background(), dir, "", flags, nil); err != nil {
 		os.RemoveAll(dir)
 		t.Fatal("Build failed:", err)
 	}
@@ -269,27 +277,42 @@ func TestBuild_Full(t *testing.T) {
 	// The generated sitemap should list all pages.
 	checkFileContents(t, filepath.Join(out, sitemapFile), strings.TrimLeft(`
 <?xml version="1.0" encoding="UTF-8"?>
-<urlset xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">
+<urlset xmlns="http://www.sitemaps.org/schemas/sitemap/0.9" xmlns:image="http://www.google.com/schemas/sitemap-image/1.1">
   <url>
     <loc>https://www.example.org/</loc>
+    <lastmod>2020-05-20</lastmod>
     <changefreq>weekly</changefreq>
+    <image:image>
+      <image:loc>https://www.example.org/scottish_fold/maru-800.jpg</image:loc>
+    </image:image>
   </url>
   <url>
     <loc>https://www.example.org/cats.html</loc>
+    <lastmod>2020-05-20</lastmod>
     <changefreq>weekly</changefreq>
   </url>
   <url>
-    <loc>https://www.example.org/scottish_fold.html</loc>
+    <loc>https://www.example.org/cheshire.html</loc>
+    <lastmod>2021-09-07</lastmod>
     <changefreq>weekly</changefreq>
   </url>
   <url>
-    <loc>https://www.example.org/cheshire.html</loc>
+    <loc>https://www.example.org/scottish_fold.html</loc>
+    <lastmod>2020-05-21</lastmod>
     <changefreq>weekly</changefreq>
+    <image:image>
+      <image:loc>https://www.example.org/scottish_fold/maru-800.jpg</image:loc>
+    </image:image>
+    <image:image>
+      <image:loc>https://www.example.org/scottish_fold/christmas.webp</image:loc>
+    </image:image>
   </url>
 </urlset>
 `, "\n"))
 
-	checkFileContents(t, filepath.Join(out, render.FeedFile), strings.TrimLeft(`
+	// Entries' full contents are checked below.
+	atomContentRegexp := regexp.MustCompile(`\n\s*<content type="html">[^<]*</content>`)
+	checkFileContentsFiltered(t, filepath.Join(out, render.FeedFile), atomContentRegexp, strings.TrimLeft(`
 <?xml version="1.0" encoding="UTF-8"?><feed xmlns="http://www.w3.org/2005/Atom">
   <title>example.org</title>
   <id>https://www.example.org/</id>
@@ -324,7 +347,7 @@ func TestBuild_Full(t *testing.T) {
   </entry>
   <entry>
     <title>Scottish Fold</title>
-    <updated>2020-05-20T00:00:00Z</updated>
+    <updated>2020-05-21T00:00:00Z</updated>
     <id>tag:www.example.org,2020-05-20:/scottish_fold.html</id>
     <link href="https://www.example.org/scottish_fold.html" rel="alternate"></link>
     <summary type="html">Example site</summary>
@@ -334,6 +357,15 @@ func TestBuild_Full(t *testing.T) {
     </author>
   </entry>
 </feed>`, "\n"))
+	checkPageContents(t, filepath.Join(out, render.FeedFile), []string{
+		// Relative URLs should be made absolute.
+		`<content type="html">[^<]*&lt;a href=&#34;https://www\.example\.org/cats\.html&#34;&gt;`,
+		`<content type="html">[^<]*&lt;img[^<]*src=&#34;https://www\.example\.org/scottish_fold/maru-400\.jpg&#34;`,
+	}, []string{
+		`<content type="html">[^<]*&lt;script`,
+		`<content type="html">[^<]*&lt;!--`, // AMP-only content is commented out in non-AMP pages
+		`<content type="html">[^<]*&lt;footer`,
+	})
 
 	if t.Failed() {
 		fmt.Println("Output is in", out)
@@ -348,7 +380,7 @@ func TestBuild_Rebuild(t *testing.T) {
 	if err != nil {
 		t.Fatal("Failed creating site dir:", err)
 	}
-	if err := Build(context.Background(), dir, "", PrettyPrint); err != nil {
+	if err := Build(context.Background(), dir, "", PrettyPrint, nil); err != nil {
 		os.RemoveAll(dir)
 		t.Fatal("Build failed:", err)
 	}
@@ -359,7 +391,7 @@ func TestBuild_Rebuild(t *testing.T) {
 		os.RemoveAll(dir)
 		t.Fatal("Failed appending content:", err)
 	}
-	if err := Build(context.Background(), dir, "", PrettyPrint); err != nil {
+	if err := Build(context.Background(), dir, "", PrettyPrint, nil); err != nil {
 		os.RemoveAll(dir)
 		t.Fatal("Build failed on rebuild:", err)
 	}
@@ -393,6 +425,820 @@ func TestBuild_Rebuild(t *testing.T) {
 	}
 }
 
+func TestBuild_Incremental(t *testing.T) {
+	dir, err := newTestSiteDir()
+	if err != nil {
+		t.Fatal("Failed creating site dir:", err)
+	}
+	const flags = PrettyPrint | Incremental
+	if err := Build(context.Background(), dir, "", flags, nil); err != nil {
+		os.RemoveAll(dir)
+		t.Fatal("Build failed:", err)
+	}
+
+	// Tamper with some cached pages so we can tell whether they're reused.
+	const marker = "<!-- from build cache -->"
+	cacheOut := filepath.Join(dir, cacheSubdir, cacheOutSubdir)
+	for _, fn := range []string{"cats.html", "index.html", "iframes/map.html"} {
+		if err := appendToFile(filepath.Join(cacheOut, fn), marker); err != nil {
+			os.RemoveAll(dir)
+			t.Fatal("Failed appending to cached file:", err)
+		}
+	}
+
+	// After the index page is changed, only it should be regenerated.
+	const newContent = "Here's a newly-added sentence."
+	if err := appendToFile(filepath.Join(dir, "pages/index.md"), "\n"+newContent+"\n"); err != nil {
+		os.RemoveAll(dir)
+		t.Fatal("Failed appending content:", err)
+	}
+	if err := Build(context.Background(), dir, "", flags, nil); err != nil {
+		os.RemoveAll(dir)
+		t.Fatal("Build failed on rebuild:", err)
+	}
+	out := filepath.Join(dir, outSubdir)
+	quotedMarker := regexp.QuoteMeta(marker)
+	checkPageContents(t, filepath.Join(out, "cats.html"), []string{quotedMarker}, nil)
+	checkPageContents(t, filepath.Join(out, "iframes/map.html"), []string{quotedMarker}, nil)
+	checkPageContents(t, filepath.Join(out, "index.html"), []string{regexp.QuoteMeta(newContent)}, []string{quotedMarker})
+	compareFiles(t, filepath.Join(out, "cats.html"), filepath.Join(dir, "pages/cats.md"), mtimeEqual)
+
+	// Changing the site file should invalidate everything.
+	now := time.Now()
+	if err := os.Chtimes(filepath.Join(dir, siteFile), now, now); err != nil {
+		os.RemoveAll(dir)
+		t.Fatal("Failed updating site file:", err)
+	}
+	if err := Build(context.Background(), dir, "", flags, nil); err != nil {
+		os.RemoveAll(dir)
+		t.Fatal("Build failed on second rebuild:", err)
+	}
+	checkPageContents(t, filepath.Join(out, "cats.html"), nil, []string{quotedMarker})
+	checkPageContents(t, filepath.Join(out, "iframes/map.html"), nil, []string{quotedMarker})
+
+	if t.Failed() {
+		fmt.Println("Output is in", out)
+	} else {
+		os.RemoveAll(dir)
+	}
+}
+
+func TestBuild_LiveReload(t *testing.T) {
+	dir, err := newTestSiteDir()
+	if err != nil {
+		t.Fatal("Failed creating site dir:", err)
+	}
+	if err := Build(context.Background(), dir, "", PrettyPrint|LiveReload, nil); err != nil {
+		os.RemoveAll(dir)
+		t.Fatal("Build failed:", err)
+	}
+
+	// Only non-AMP pages should poll the token file.
+	out := filepath.Join(dir, outSubdir)
+	pat := regexp.QuoteMeta("fetch('/" + render.LiveReloadFile + "'")
+	checkPageContents(t, filepath.Join(out, "index.html"), []string{pat}, nil)
+	checkPageContents(t, filepath.Join(out, "index.amp.html"), nil, []string{pat})
+	if _, err := os.Stat(filepath.Join(out, render.LiveReloadFile)); err != nil {
+		t.Error("Token file not written:", err)
+	}
+
+	if t.Failed() {
+		fmt.Println("Output is in", out)
+	} else {
+		os.RemoveAll(dir)
+	}
+}
+
+func TestBuild_AVIF(t *testing.T) {
+	dir, err := newTestSiteDir()
+	if err != nil {
+		t.Fatal("Failed creating site dir:", err)
+	}
+	if err := appendToFile(filepath.Join(dir, siteFile), "generate_avif: true\n"); err != nil {
+		os.RemoveAll(dir)
+		t.Fatal("Failed updating site file:", err)
+	}
+	if err := Build(context.Background(), dir, "", PrettyPrint, nil); err != nil {
+		os.RemoveAll(dir)
+		t.Fatal("Build failed:", err)
+	}
+
+	out := filepath.Join(dir, outSubdir)
+	checkPageContents(t, filepath.Join(out, "scottish_fold.html"), []string{
+		// The AVIF <source> should precede the WebP one.
+		`<picture>\s*` +
+			`<source\s+type="image/avif"\s+sizes="400px"\s+` +
+			`srcset="scottish_fold/maru-400\.avif 400w, scottish_fold/maru-800\.avif 800w">\s*` +
+			`<source\s+type="image/webp"\s+sizes="400px"\s+` +
+			`srcset="scottish_fold/maru-400\.webp 400w, scottish_fold/maru-800\.webp 800w">\s*` +
+			`<img\s+src="scottish_fold/maru-400\.jpg"`,
+		// Map placeholder background image
+		regexp.QuoteMeta(`background-image:image-set("scottish_fold/map_light.avif" type("image/avif"), ` +
+			`"scottish_fold/map_light.webp" type("image/webp"), "scottish_fold/map_light.png" type("image/png"))`),
+	}, []string{
+		// avifenc doesn't support GIFs.
+		regexp.QuoteMeta("nyan.avif"),
+	})
+	// <amp-img> doesn't support <source>, so AVIF images are only used for backgrounds in AMP pages.
+	checkPageContents(t, filepath.Join(out, "scottish_fold.amp.html"), nil, []string{regexp.QuoteMeta("maru-400.avif")})
+	compareFiles(t, filepath.Join(out, "scottish_fold/maru-400.avif"),
+		filepath.Join(dir, "static/scottish_fold/maru-400.jpg"), mtimeEqual)
+	checkFileNotExist(t, filepath.Join(out, "scottish_fold/nyan.avif"))
+
+	// Stale AVIF files should be deleted when the original image is removed.
+	if err := os.Remove(filepath.Join(dir, "static/scottish_fold/map_dark.png")); err != nil {
+		t.Fatal(err)
+	}
+	if err := generateAVIF([]string{filepath.Join(dir, "static")}, filepath.Join(dir, "gen/static"), 0); err != nil {
+		t.Error("generateAVIF failed:", err)
+	}
+	checkFileNotExist(t, filepath.Join(dir, "gen/static/scottish_fold/map_dark.avif"))
+
+	if t.Failed() {
+		fmt.Println("Output is in", out)
+	} else {
+		os.RemoveAll(dir)
+	}
+}
+
+func TestCompare(t *testing.T) {
+	dir, err := newTestSiteDir()
+	if err != nil {
+		t.Fatal("Failed creating site dir:", err)
+	}
+	if err := Build(context.Background(), dir, "", PrettyPrint, nil); err != nil {
+		os.RemoveAll(dir)
+		t.Fatal("Build failed:", err)
+	}
+	if err := appendToFile(filepath.Join(dir, "pages/cats.md"), "\nHere's a newly-added sentence.\n"); err != nil {
+		os.RemoveAll(dir)
+		t.Fatal("Failed appending content:", err)
+	}
+
+	out := filepath.Join(dir, outSubdir)
+	for _, tc := range []struct {
+		allow      []string
+		unexpected []string
+	}{
+		{nil, []string{"atom.xml", "atom.xml.gz", "cats.amp.html", "cats.amp.html.gz", "cats.html", "cats.html.gz", "manifest.json"}},
+		{[]string{"cats.html"}, []string{"atom.xml", "atom.xml.gz", "cats.amp.html", "cats.amp.html.gz", "manifest.json"}},
+		{[]string{"*.html", "*.xml", "manifest.json"}, []string{}},
+	} {
+		rep, err := Compare(context.Background(), dir, "", PrettyPrint|Prompt, nil, tc.allow)
+		if err != nil {
+			t.Errorf("Compare with %q failed: %v", tc.allow, err)
+			continue
+		}
+		var changed []string
+		for _, fc := range rep.Changed {
+			changed = append(changed, fc.Path)
+		}
+		// The feed includes the page's contents. Sizes of precompressed copies are compared.
+		if want := []string{"atom.xml", "atom.xml.gz", "cats.amp.html", "cats.amp.html.gz",
+			"cats.html", "cats.html.gz", "manifest.json"}; !reflect.DeepEqual(changed, want) {
+			t.Errorf("Compare with %q reported changes %q; want %q", tc.allow, changed, want)
+		}
+		if len(rep.Added) != 0 || len(rep.Removed) != 0 {
+			t.Errorf("Compare with %q reported added %v and removed %v", tc.allow, rep.Added, rep.Removed)
+		}
+		if !reflect.DeepEqual(rep.Unexpected, tc.unexpected) {
+			t.Errorf("Compare with %q reported unexpected changes %q; want %q", tc.allow, rep.Unexpected, tc.unexpected)
+		}
+	}
+
+	// The existing output dir should be untouched, and the temp dir should be removed.
+	checkPageContents(t, filepath.Join(out, "cats.html"), nil, []string{"newly-added"})
+	if ps, err := filepath.Glob(filepath.Join(dir, tmpOutPrefix+"*")); err != nil {
+		t.Error(err)
+	} else if len(ps) > 0 {
+		t.Errorf("Temp dirs weren't removed: %v", ps)
+	}
+
+	if t.Failed() {
+		fmt.Println("Output is in", out)
+	} else {
+		os.RemoveAll(dir)
+	}
+}
+
+func TestBuild_Compression(t *testing.T) {
+	dir, err := newTestSiteDir()
+	if err != nil {
+		t.Fatal("Failed creating site dir:", err)
+	}
+	if err := appendToFile(filepath.Join(dir, siteFile),
+		"compress_encodings: [gzip, br, zstd]\ncompress_level: best\ncompress_extensions: [.html, .txt]\n"); err != nil {
+		os.RemoveAll(dir)
+		t.Fatal("Failed updating site file:", err)
+	}
+	// Compressing this file would make it larger.
+	if err := ioutil.WriteFile(filepath.Join(dir, "static/tiny.txt"), []byte("a"), 0644); err != nil {
+		os.RemoveAll(dir)
+		t.Fatal("Failed writing file:", err)
+	}
+	if err := Build(context.Background(), dir, "", PrettyPrint, nil); err != nil {
+		os.RemoveAll(dir)
+		t.Fatal("Build failed:", err)
+	}
+
+	out := filepath.Join(dir, outSubdir)
+	for _, ext := range []string{".gz", ".br", ".zst"} {
+		compareFiles(t, filepath.Join(out, "index.html"+ext), filepath.Join(out, "index.html"), contentsEqual|mtimeEqual)
+		compareFiles(t, filepath.Join(out, "other/extra.html"+ext), filepath.Join(out, "other/extra.html"),
+			contentsEqual|mtimeEqual)
+		checkFileNotExist(t, filepath.Join(out, "tiny.txt"+ext))
+		checkFileNotExist(t, filepath.Join(out, "atom.xml"+ext)) // not in compress_extensions
+	}
+
+	// Compressed files should be identical across builds.
+	if err := Build(context.Background(), dir, "", PrettyPrint, nil); err != nil {
+		os.RemoveAll(dir)
+		t.Fatal("Build failed on rebuild:", err)
+	}
+	oldOut := filepath.Join(dir, oldOutSubdir)
+	for _, fn := range []string{"cats.html.gz", "cats.html.br", "cats.html.zst"} {
+		if a, err := ioutil.ReadFile(filepath.Join(out, fn)); err != nil {
+			t.Error(err)
+		} else if b, err := ioutil.ReadFile(filepath.Join(oldOut, fn)); err != nil {
+			t.Error(err)
+		} else if !bytes.Equal(a, b) {
+			t.Errorf("%v differs between builds", fn)
+		}
+	}
+
+	if t.Failed() {
+		fmt.Println("Output is in", out)
+	} else {
+		os.RemoveAll(dir)
+	}
+}
+
+func TestBuild_Manifest(t *testing.T) {
+	dir, err := newTestSiteDir()
+	if err != nil {
+		t.Fatal("Failed creating site dir:", err)
+	}
+	if err := Build(context.Background(), dir, "", PrettyPrint, nil); err != nil {
+		os.RemoveAll(dir)
+		t.Fatal("Build failed:", err)
+	}
+
+	out := filepath.Join(dir, outSubdir)
+	b, err := ioutil.ReadFile(filepath.Join(out, "manifest.json"))
+	if err != nil {
+		t.Fatal("Failed reading manifest:", err)
+	}
+	var man struct {
+		Files map[string]manifestEntry `json:"files"`
+	}
+	if err := json.Unmarshal(b, &man); err != nil {
+		t.Fatal("Failed unmarshaling manifest:", err)
+	}
+
+	for _, tc := range []struct {
+		path, contentType, source, sourcePath string
+	}{
+		{"cats.html", "text/html; charset=utf-8", sourcePage, "pages/cats.md"},
+		{"cats.amp.html", "text/html; charset=utf-8", sourcePage, "pages/cats.md"},
+		{"cats.html.gz", "application/gzip", sourceCompressed, "cats.html"},
+		{"iframes/map.html", "text/html; charset=utf-8", sourceIframe, "iframes/map.yaml"},
+		{"static.html", "text/html; charset=utf-8", sourceStatic, "static/static.html"},
+		{"scottish_fold/maru-400.jpg", "image/jpeg", sourceStatic, "static/scottish_fold/maru-400.jpg"},
+		{"scottish_fold/maru-400.webp", "image/webp", sourceGenImage, "gen/static/scottish_fold/maru-400.webp"},
+		{"other/extra.html", "text/html; charset=utf-8", sourceExtraStatic, "extra/extra.html"},
+		{"sitemap.xml", "text/xml; charset=utf-8", sourceSitemap, ""},
+		{"atom.xml", "text/xml; charset=utf-8", sourceFeed, ""},
+	} {
+		ent, ok := man.Files[tc.path]
+		if !ok {
+			t.Errorf("%v not listed in manifest", tc.path)
+			continue
+		}
+		if ent.ContentType != tc.contentType || ent.Source != tc.source || ent.SourcePath != tc.sourcePath {
+			t.Errorf("%v has content type %q, source %q, and source path %q; want %q, %q, and %q",
+				tc.path, ent.ContentType, ent.Source, ent.SourcePath, tc.contentType, tc.source, tc.sourcePath)
+		}
+		data, err := ioutil.ReadFile(filepath.Join(out, tc.path))
+		if err != nil {
+			t.Error(err)
+			continue
+		}
+		if sum := sha256.Sum256(data); ent.Size != int64(len(data)) || ent.SHA256 != hex.EncodeToString(sum[:]) {
+			t.Errorf("%v has size %d and hash %v; want %d and %x", tc.path, ent.Size, ent.SHA256, len(data), sum)
+		}
+	}
+	if _, ok := man.Files["manifest.json"]; ok {
+		t.Error("Manifest lists itself")
+	}
+	checkPageContents(t, filepath.Join(out, sitemapFile), nil, []string{"manifest"})
+
+	// Building into the same dir again should overwrite the old manifest, and files left over
+	// from earlier builds should be listed with unknown sources.
+	if err := ioutil.WriteFile(filepath.Join(out, "stale.html"), []byte("stale"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		if err := Build(context.Background(), dir, out, PrettyPrint, nil); err != nil {
+			t.Fatalf("Rebuilding into output dir failed (iteration %d): %v", i, err)
+		}
+	}
+	man.Files = nil
+	if b, err := ioutil.ReadFile(filepath.Join(out, "manifest.json")); err != nil {
+		t.Error("Failed reading manifest:", err)
+	} else if err := json.Unmarshal(b, &man); err != nil {
+		t.Error("Failed unmarshaling manifest:", err)
+	} else {
+		if ent := man.Files["stale.html"]; ent.Source != sourceUnknown {
+			t.Errorf("stale.html has source %q; want %q", ent.Source, sourceUnknown)
+		}
+		if ent := man.Files["cats.html"]; ent.Source != sourcePage {
+			t.Errorf("cats.html has source %q after rebuild; want %q", ent.Source, sourcePage)
+		}
+	}
+
+	if t.Failed() {
+		fmt.Println("Output is in", out)
+	} else {
+		os.RemoveAll(dir)
+	}
+}
+
+func TestBuild_Fingerprint(t *testing.T) {
+	dir, err := newTestSiteDir()
+	if err != nil {
+		t.Fatal("Failed creating site dir:", err)
+	}
+	if err := appendToFile(filepath.Join(dir, siteFile),
+		"fingerprint_static: ['*.png', 'scottish_fold/maru-*']\n"); err != nil {
+		os.RemoveAll(dir)
+		t.Fatal("Failed updating site file:", err)
+	}
+	if err := Build(context.Background(), dir, "", PrettyPrint, nil); err != nil {
+		os.RemoveAll(dir)
+		t.Fatal("Build failed:", err)
+	}
+
+	// fp returns the fingerprinted version of the static path p, which should be present in
+	// the output dir instead of the original file.
+	out := filepath.Join(dir, outSubdir)
+	fp := func(p string) string {
+		b, err := ioutil.ReadFile(filepath.Join(dir, "gen/static", p))
+		if os.IsNotExist(err) {
+			b, err = ioutil.ReadFile(filepath.Join(dir, "static", p))
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		fp := render.FingerprintPath(p, b)
+		checkFileNotExist(t, filepath.Join(out, p))
+		if _, err := os.Stat(filepath.Join(out, fp)); err != nil {
+			t.Errorf("Fingerprinted %v not written: %v", p, err)
+		}
+		return regexp.QuoteMeta(fp)
+	}
+
+	checkPageContents(t, filepath.Join(out, "index.html"), []string{
+		`<link rel="icon" href="favicon\.ico" sizes="any">`,
+		`<link rel="icon" href="` + fp("resources/favicon.png") + `" sizes="192x192">`,
+		`"logo":{"@type":"ImageObject","url":"https://www\.example\.org/` + fp("resources/logo-460.png") + `"`,
+		`"image":{"@type":"ImageObject","url":"https://www\.example\.org/` + fp("scottish_fold/maru-800.jpg") + `"`,
+		`<img class="logo " src="` + fp("resources/logo-html-128.png") + `"`,
+	}, nil)
+	checkPageContents(t, filepath.Join(out, "scottish_fold.html"), []string{
+		`<a href="` + fp("scottish_fold/maru-800.jpg") + `">`,
+		`srcset="` + fp("scottish_fold/maru-400.webp") + ` 400w, ` + fp("scottish_fold/maru-800.webp") + ` 800w">`,
+		`<img\s+src="` + fp("scottish_fold/maru-400.jpg") + `"`,
+		// Only the PNG is fingerprinted.
+		`"scottish_fold/map_light\.webp" type\("image/webp"\), "` + fp("scottish_fold/map_light.png") + `" type\("image/png"\)`,
+	}, nil)
+	checkPageContents(t, filepath.Join(out, "scottish_fold.amp.html"), []string{
+		`<a href="https://www\.example\.org/` + fp("scottish_fold/maru-800.jpg") + `">`,
+	}, nil)
+	checkPageContents(t, filepath.Join(out, "iframes/map.html"), []string{
+		`url\(\.\./` + fp("scottish_fold/map_dark.png") + `\)`,
+	}, nil)
+	compareFiles(t, filepath.Join(out, "scottish_fold/map_light.webp"),
+		filepath.Join(dir, "gen/static/scottish_fold/map_light.webp"), contentsEqual)
+
+	// Rebuilding into the same dir should reuse the existing fingerprinted files.
+	if err := Build(context.Background(), dir, out, PrettyPrint, nil); err != nil {
+		t.Fatal("Rebuilding into output dir failed:", err)
+	}
+	checkPageContents(t, filepath.Join(out, "index.html"),
+		[]string{`href="` + fp("resources/favicon.png") + `"`}, nil)
+
+	// A fingerprinted file with different contents should be reported as a conflict.
+	fav, err := ioutil.ReadFile(filepath.Join(dir, "static/resources/favicon.png"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(out, render.FingerprintPath("resources/favicon.png", fav)),
+		[]byte("bogus"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := Build(context.Background(), dir, out, PrettyPrint, nil); err == nil {
+		t.Error("Rebuilding with conflicting fingerprinted file unexpectedly succeeded")
+	}
+
+	if t.Failed() {
+		fmt.Println("Output is in", out)
+	} else {
+		os.RemoveAll(dir)
+	}
+}
+
+func TestBuild_ResizeImages(t *testing.T) {
+	dir, err := newTestSiteDir()
+	if err != nil {
+		t.Fatal("Failed creating site dir:", err)
+	}
+	if err := copy.Copy(filepath.Join(dir, "static/scottish_fold/maru-800.jpg"),
+		filepath.Join(dir, "static/resize/maru.jpg")); err != nil {
+		os.RemoveAll(dir)
+		t.Fatal("Failed copying image:", err)
+	}
+	const page = "```page\ntitle: Resize\nid: cats\n```\n" +
+		"```image\npath: resize/maru.jpg\nwidths: [200, 400]\nalt: Maru\n```\n"
+	if err := ioutil.WriteFile(filepath.Join(dir, "pages/resize.md"), []byte(page), 0644); err != nil {
+		os.RemoveAll(dir)
+		t.Fatal("Failed writing page:", err)
+	}
+	if err := Build(context.Background(), dir, "", PrettyPrint, nil); err != nil {
+		os.RemoveAll(dir)
+		t.Fatal("Build failed:", err)
+	}
+
+	out := filepath.Join(dir, outSubdir)
+	checkPageContents(t, filepath.Join(out, "resize.html"), []string{
+		`<source\s+type="image/webp"\s+sizes="200px"\s+` +
+			`srcset="resize/maru-200\.webp 200w, resize/maru-400\.webp 400w">\s*` +
+			`<img\s+src="resize/maru-200\.jpg"[^>]*\s+` +
+			`srcset="resize/maru-200\.jpg 200w, resize/maru-400\.jpg 400w"`,
+		`<a href="resize/maru-400\.jpg"`, // link to biggest image
+	}, nil)
+	for _, w := range []int{200, 400} {
+		gp := filepath.Join(dir, fmt.Sprintf("gen/static/resize/maru-%d.jpg", w))
+		if width, _, err := getImageSize(gp); err != nil {
+			t.Error("Failed getting image size:", err)
+		} else if width != w {
+			t.Errorf("%v has width %d; want %d", gp, width, w)
+		}
+		compareFiles(t, gp, filepath.Join(dir, "static/resize/maru.jpg"), mtimeEqual)
+		compareFiles(t, filepath.Join(out, fmt.Sprintf("resize/maru-%d.jpg", w)), gp, contentsEqual)
+	}
+
+	// Scaled images shouldn't be regenerated if the original is unchanged,
+	// and no-longer-requested sizes should be deleted.
+	const marker = "not really an image"
+	gp := filepath.Join(dir, "gen/static/resize/maru-200.jpg")
+	if err := appendToFile(gp, marker); err != nil {
+		t.Fatal(err)
+	}
+	if err := copyTimes(filepath.Join(dir, "static/resize/maru.jpg"), gp); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "pages/resize.md"),
+		[]byte(strings.Replace(page, "200, 400", "200", 1)), 0644); err != nil {
+		t.Fatal(err)
+	}
+	// Other images under gen/static that weren't generated from static images
+	// should be left alone.
+	others := []string{
+		filepath.Join(dir, "gen/static/resize/extra.jpg"),
+		filepath.Join(dir, "gen/static/resize/kitty-300.png"),
+	}
+	for _, p := range others {
+		if err := ioutil.WriteFile(p, []byte(marker), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	si, err := render.NewSiteInfo(filepath.Join(dir, siteFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := generateResizedImages(si, 0); err != nil {
+		t.Error("generateResizedImages failed:", err)
+	}
+	checkPageContents(t, gp, []string{marker}, nil)
+	checkFileNotExist(t, filepath.Join(dir, "gen/static/resize/maru-400.jpg"))
+	for _, p := range others {
+		checkPageContents(t, p, []string{marker}, nil)
+	}
+
+	if t.Failed() {
+		fmt.Println("Output is in", out)
+	} else {
+		os.RemoveAll(dir)
+	}
+}
+
+func TestBuild_Feeds(t *testing.T) {
+	dir, err := newTestSiteDir()
+	if err != nil {
+		t.Fatal("Failed creating site dir:", err)
+	}
+	defer os.RemoveAll(dir)
+	if err := appendToFile(filepath.Join(dir, siteFile),
+		"\nfeed_items: 2\nfeed_rss: true\nfeed_json: true\n"); err != nil {
+		t.Fatal(err)
+	}
+	if err := Build(context.Background(), dir, "", 0, nil); err != nil {
+		t.Fatal("Build failed:", err)
+	}
+
+	out := filepath.Join(dir, outSubdir)
+	checkPageContents(t, filepath.Join(out, "index.html"), []string{
+		`<link rel="alternate" type="application/atom\+xml" href="https://www\.example\.org/atom\.xml">`,
+		`<link rel="alternate" type="application/rss\+xml" href="https://www\.example\.org/rss\.xml">`,
+		`<link rel="alternate" type="application/feed\+json" href="https://www\.example\.org/feed\.json">`,
+	}, nil)
+	checkPageContents(t, filepath.Join(out, render.FeedFile), []string{
+		`(?s)<entry>.*<entry>`,
+	}, []string{
+		`(?s)<entry>.*<entry>.*<entry>`,
+	})
+	checkPageContents(t, filepath.Join(out, render.RSSFeedFile), []string{
+		`(?s)<item>\s*<title>Cheshire Cat</title>\s*` +
+			`<link>https://www\.example\.org/cheshire\.html</link>\s*` +
+			`<description>Example site</description>\s*` +
+			`<content:encoded><!\[CDATA\[<div class="box">.*?\]\]></content:encoded>.*?` +
+			`<guid>https://www\.example\.org/cheshire\.html</guid>`,
+		`(?s)<item>.*<item>`,
+	}, []string{
+		`(?s)<item>.*<item>.*<item>`,
+	})
+
+	b, err := ioutil.ReadFile(filepath.Join(out, render.JSONFeedFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var feed struct {
+		Items []struct {
+			ID          string `json:"id"`
+			URL         string `json:"url"`
+			ContentHTML string `json:"content_html"`
+		} `json:"items"`
+	}
+	if err := json.Unmarshal(b, &feed); err != nil {
+		t.Fatal("Failed unmarshaling JSON feed:", err)
+	}
+	var got []string
+	for _, it := range feed.Items {
+		got = append(got, it.ID+" "+it.URL)
+		if !strings.Contains(it.ContentHTML, `<div class="box">`) {
+			t.Errorf("JSON feed item %v has content %q", it.URL, it.ContentHTML)
+		}
+	}
+	if want := []string{
+		"tag:www.example.org,2021-09-07:/cheshire.html https://www.example.org/cheshire.html",
+		"tag:www.example.org,2020-05-20:/cats.html https://www.example.org/cats.html",
+	}; !reflect.DeepEqual(got, want) {
+		t.Errorf("JSON feed has items %q; want %q", got, want)
+	}
+}
+
+func TestBuild_FeedUpdates(t *testing.T) {
+	dir, err := newTestSiteDir()
+	if err != nil {
+		t.Fatal("Failed creating site dir:", err)
+	}
+	defer os.RemoveAll(dir)
+	if err := appendToFile(filepath.Join(dir, siteFile), "\nfeed_items: 2\nfeed_json: true\n"); err != nil {
+		t.Fatal(err)
+	}
+	// Substantively update a page that would otherwise be too old to be listed.
+	p := filepath.Join(dir, "pages/cats.md")
+	b, err := ioutil.ReadFile(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b = []byte(strings.Replace(string(b), "modified: 2020-05-20",
+		"modified: 2022-03-04\nupdate_note: Added more cats.", 1))
+	if err := ioutil.WriteFile(p, b, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	out := filepath.Join(dir, outSubdir)
+	atom := filepath.Join(out, render.FeedFile)
+	var lastAtom []byte
+	for i := 0; i < 2; i++ {
+		if err := Build(context.Background(), dir, "", 0, nil); err != nil {
+			t.Fatal("Build failed:", err)
+		}
+		checkPageContents(t, atom, []string{
+			`(?s)<feed[^>]*>\s*<title>[^<]*</title>\s*<id>[^<]*</id>\s*<updated>2022-03-04T00:00:00Z</updated>`,
+			`(?s)<entry>\s*<title>Cats</title>\s*<updated>2022-03-04T00:00:00Z</updated>\s*` +
+				`<id>tag:www\.example\.org,2020-05-20:/cats\.html</id>.*?` +
+				`<summary type="html">Example site \(Updated: Added more cats\.\)</summary>.*?</entry>\s*` +
+				`<entry>\s*<title>Cheshire Cat</title>`,
+		}, nil)
+		checkPageContents(t, filepath.Join(out, render.JSONFeedFile), []string{
+			`"date_modified": "2022-03-04T00:00:00Z"`,
+		}, nil)
+
+		// The feed and its timestamp should be unchanged by rebuilding.
+		want := time.Date(2022, 3, 4, 0, 0, 0, 0, time.UTC)
+		if mtime, err := getFileMtime(atom); err != nil {
+			t.Error(err)
+		} else if !mtime.Equal(want) {
+			t.Errorf("%v has mtime %v; want %v", atom, mtime, want)
+		}
+		b, err := ioutil.ReadFile(atom)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if lastAtom != nil && !bytes.Equal(b, lastAtom) {
+			t.Errorf("%v changed after rebuilding", atom)
+		}
+		lastAtom = b
+	}
+}
+
+func TestBuild_Tags(t *testing.T) {
+	dir, err := newTestSiteDir()
+	if err != nil {
+		t.Fatal("Failed creating site dir:", err)
+	}
+	defer os.RemoveAll(dir)
+
+	// setTags replaces the "modified" line in the named page's page block with a "tags" line.
+	setTags := func(fn, tags string) {
+		p := filepath.Join(dir, "pages", fn)
+		b, err := ioutil.ReadFile(p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		re := regexp.MustCompile(`(?m)^modified: .*$`)
+		if err := ioutil.WriteFile(p, re.ReplaceAll(b, []byte("tags: "+tags)), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	setTags("cats.md", "[Cats]")
+	setTags("cheshire.md", "[Cats, Fiction]")
+
+	out := filepath.Join(dir, outSubdir)
+	if err := Build(context.Background(), dir, "", 0, nil); err != nil {
+		t.Fatal("Build failed:", err)
+	}
+
+	checkPageContents(t, filepath.Join(out, "cheshire.html"), []string{
+		`<div class="tags">Tags: <a href="tag_cats\.html">Cats</a>, <a href="tag_fiction\.html">Fiction</a>`,
+		`"keywords":"Cats,Fiction"`,
+	}, nil)
+	checkPageContents(t, filepath.Join(out, "cheshire.amp.html"), []string{
+		`<a href="tag_cats\.amp\.html">Cats</a>`,
+	}, nil)
+	checkPageContents(t, filepath.Join(out, "scottish_fold.html"), nil, []string{
+		`class="tags"`,
+		`"keywords"`,
+	})
+	checkPageContents(t, filepath.Join(out, "tag_cats.html"), []string{
+		`<title>Tag: Cats`,
+		`(?s)<li><a href="cheshire\.html">Cheshire Cat</a> \(Sep 7, 2021\)\s*</li>\s*` +
+			`<li><a href="cats\.html">Cats</a> \(May 20, 2020\)`,
+		`<link rel="alternate" type="application/atom\+xml" href="https://www\.example\.org/tag_cats\.xml">`,
+		`<a href="tags\.html">All tags</a>`,
+	}, nil)
+	checkPageContents(t, filepath.Join(out, "tag_cats.amp.html"), []string{
+		`<a href="cheshire\.amp\.html">Cheshire Cat</a>`,
+	}, nil)
+	checkPageContents(t, filepath.Join(out, "tags.html"), []string{
+		`(?s)<a href="tag_cats\.html">Cats</a> \(2 pages\).*<a href="tag_fiction\.html">Fiction</a> \(1 page\)`,
+	}, nil)
+	checkPageContents(t, filepath.Join(out, "tags.amp.html"), []string{
+		`<a href="tag_fiction\.amp\.html">Fiction</a>`,
+	}, nil)
+	checkPageContents(t, filepath.Join(out, "tag_fiction.xml"), []string{
+		`<title>[^<]*: Fiction</title>`,
+		`<entry>\s*<title>Cheshire Cat</title>`,
+	}, []string{
+		`<title>Cats</title>`,
+	})
+	checkPageContents(t, filepath.Join(out, sitemapFile), []string{
+		`<loc>https://www\.example\.org/tag_cats\.html</loc>`,
+		`<loc>https://www\.example\.org/tags\.html</loc>`,
+	}, nil)
+
+	// Tags that would be written to the same file should be rejected.
+	setTags("scottish_fold.md", "[cats]")
+	if err := Build(context.Background(), dir, "", 0, nil); err == nil {
+		t.Error("Build unexpectedly succeeded with conflicting tags")
+	}
+}
+
+func TestBuild_PageList(t *testing.T) {
+	dir, err := newTestSiteDir()
+	if err != nil {
+		t.Fatal("Failed creating site dir:", err)
+	}
+	defer os.RemoveAll(dir)
+
+	// replace replaces the first occurrence of old in the named page with new.
+	replace := func(fn, old, new string) {
+		p := filepath.Join(dir, "pages", fn)
+		b, err := ioutil.ReadFile(p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Contains(b, []byte(old)) {
+			t.Fatalf("%v doesn't contain %q", fn, old)
+		}
+		if err := ioutil.WriteFile(p, bytes.Replace(b, []byte(old), []byte(new), 1), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	replace("cats.md", "\n# Cats\n", "\n# Cats\n\n```pagelist\nnav: cats\nsort: title\ndate: true\n"+
+		"thumbnail: true\nper_page: 1\n```\n")
+	replace("scottish_fold.md", "\ncreated:", "\nimage_path: scottish_fold/maru-800.jpg\ncreated:")
+
+	const flags = Incremental
+	out := filepath.Join(dir, outSubdir)
+	if err := Build(context.Background(), dir, "", flags, nil); err != nil {
+		t.Fatal("Build failed:", err)
+	}
+	checkPageContents(t, filepath.Join(out, "cats.html"), []string{
+		`<ul class="pagelist">\s*<li><a href="cheshire\.html">Cheshire Cat</a> ` +
+			`<time datetime="2021-09-07">Sep 7, 2021</time>\s*</li>\s*</ul>`,
+		`<div class="pagelist-pages">Pages: <span class="selected">1</span> <a href="cats-2\.html">2</a>`,
+	}, nil)
+	checkPageContents(t, filepath.Join(out, "cats-2.html"), []string{
+		`<title>Cats \(page 2\)`,
+		`<link rel="amphtml" href="https://www\.example\.org/cats-2\.amp\.html">`,
+		`<ul class="pagelist">\s*<li><a class="image" href="scottish_fold\.html" tabindex="-1"><picture>.*` +
+			`<img loading="lazy" src="scottish_fold/maru-800\.jpg" sizes="80px" [^>]*width="80" height="\d+" alt="Scottish Fold">`,
+		`<a href="cats\.html">1</a> <span class="selected">2</span>`,
+	}, nil)
+	checkPageContents(t, filepath.Join(out, "cats-2.amp.html"), []string{
+		`<link rel="canonical" href="https://www\.example\.org/cats-2\.html">`,
+		`<amp-img layout="fixed" src="scottish_fold/maru-800\.webp" sizes="80px" [^>]*width="80"`,
+		`<a href="scottish_fold\.amp\.html">Scottish Fold</a>`,
+		`<a href="cats\.amp\.html">1</a>`,
+	}, nil)
+	checkPageContents(t, filepath.Join(out, sitemapFile), []string{
+		`<loc>https://www\.example\.org/cats-2\.html</loc>`,
+	}, nil)
+	checkPageContents(t, filepath.Join(out, "manifest.json"), []string{
+		`(?s)"cats-2\.html": \{[^}]*"source_path": "pages/cats\.md"`,
+	}, nil)
+	if _, err := os.Stat(filepath.Join(out, "cats-3.html")); err == nil {
+		t.Error("cats-3.html unexpectedly written")
+	}
+
+	// Changing a listed page should cause the listing to be regenerated.
+	replace("cheshire.md", "title: Cheshire Cat", "title: Cheshire Puss")
+	if err := Build(context.Background(), dir, "", flags, nil); err != nil {
+		t.Fatal("Build failed on rebuild:", err)
+	}
+	checkPageContents(t, filepath.Join(out, "cats.html"), []string{
+		`<a href="cheshire\.html">Cheshire Puss</a>`,
+	}, nil)
+
+	// Unknown nav items should be reported.
+	replace("cats.md", "nav: cats", "nav: bogus")
+	if err := Build(context.Background(), dir, "", flags, nil); err == nil {
+		t.Error("Build unexpectedly succeeded with bad nav item")
+	}
+}
+
+func TestBuild_Sitemap(t *testing.T) {
+	dir, err := newTestSiteDir()
+	if err != nil {
+		t.Fatal("Failed creating site dir:", err)
+	}
+	defer os.RemoveAll(dir)
+
+	// replacePageInfo replaces the "modified" line in the named page's page block with repl.
+	replacePageInfo := func(fn, repl string) {
+		p := filepath.Join(dir, "pages", fn)
+		b, err := ioutil.ReadFile(p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		re := regexp.MustCompile(`(?m)^modified: .*$`)
+		if err := ioutil.WriteFile(p, re.ReplaceAll(b, []byte(repl)), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	replacePageInfo("cats.md", "omit_from_sitemap: true")
+	replacePageInfo("cheshire.md", "sitemap_changefreq: monthly\nsitemap_priority: 0.8")
+
+	out := filepath.Join(dir, outSubdir)
+	if err := Build(context.Background(), dir, "", 0, nil); err != nil {
+		t.Fatal("Build failed:", err)
+	}
+	checkPageContents(t, filepath.Join(out, sitemapFile), []string{
+		`(?s)<loc>https://www\.example\.org/cheshire\.html</loc>\s*` +
+			`<lastmod>2021-09-07</lastmod>\s*` + // falls back to creation date
+			`<changefreq>monthly</changefreq>\s*` +
+			`<priority>0\.8</priority>\s*</url>`,
+	}, []string{`cats\.html`})
+
+	replacePageInfo("scottish_fold.md", "sitemap_changefreq: sometimes")
+	if err := Build(context.Background(), dir, "", 0, nil); err == nil {
+		t.Error("Build unexpectedly succeeded with bad sitemap_changefreq")
+	}
+}
+
 // newTestSiteDir creates a new temporary directory and copies test data into it.
 func newTestSiteDir() (string, error) {
 	dir, err := ioutil.TempDir("", "build_test.")
@@ -465,19 +1311,29 @@ func getFileMtime(p string) (time.Time, error) {
 }
 
 // getFileContents reads and returns p's contents.
-// If p ends in ".gz", the contents are uncompressed before being returned.
+// If p ends in ".gz", ".br", or ".zst", the contents are uncompressed before being returned.
 func getFileContents(p string) ([]byte, error) {
 	b, err := ioutil.ReadFile(p)
 	if err != nil {
 		return nil, err
 	}
-	if filepath.Ext(p) == ".gz" {
+	switch filepath.Ext(p) {
+	case ".gz":
 		r, err := gzip.NewReader(bytes.NewReader(b))
 		if err != nil {
 			return nil, err
 		}
 		defer r.Close()
 		b, err = ioutil.ReadAll(r)
+	case ".br":
+		b, err = ioutil.ReadAll(brotli.NewReader(bytes.NewReader(b)))
+	case ".zst":
+		r, err := zstd.NewReader(nil)
+		if err != nil {
+			return nil, err
+		}
+		defer r.Close()
+		return r.DecodeAll(b, nil)
 	}
 	return b, err
 }
@@ -485,12 +1341,21 @@ func getFileContents(p string) ([]byte, error) {
 // checkFileContents checks that the contents of the file at path p exactly match want.
 // If the file doesn't match, a failure containing a diff is reported.
 func checkFileContents(t *testing.T, p, want string) {
+	checkFileContentsFiltered(t, p, nil, want)
+}
+
+// checkFileContentsFiltered is like checkFileContents, but it removes matches of
+// ignore (if non-nil) from the file's contents before comparing them against want.
+func checkFileContentsFiltered(t *testing.T, p string, ignore *regexp.Regexp, want string) {
 	b, err := getFileContents(p)
 	if err != nil {
 		t.Error("Failed to get file contents:", err)
 		return
 	}
 	got := string(b)
+	if ignore != nil {
+		got = ignore.ReplaceAllString(got, "")
+	}
 	if got != want {
 		diff, _ := difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
 			A:        difflib.SplitLines(want),
@@ -547,6 +1412,17 @@ func checkFileNotExist(t *testing.T, p string) {
 	}
 }
 
+// getImageSize returns the dimensions of the image at p.
+func getImageSize(p string) (width, height int, err error) {
+	f, err := os.Open(p)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer f.Close()
+	cfg, _, err := image.DecodeConfig(f)
+	return cfg.Width, cfg.Height, err
+}
+
 // appendToFile appends data to the file at path p.
 func appendToFile(p, data string) error {
 	f, err := os.OpenFile(p, os.O_APPEND|os.O_WRONLY, 0)
@@ -0,0 +1,242 @@
+// Copyright 2023 Daniel Erat.
+// All rights reserved.
+
+package build
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/derat/intransigence/render"
+	"github.com/otiai10/copy"
+)
+
+const (
+	cacheSubdir    = "gen/cache"  // subdir under site dir containing the build cache
+	cacheFile      = "cache.json" // file under cacheSubdir describing cached outputs
+	cacheOutSubdir = "out"        // subdir under cacheSubdir containing copies of cached outputs
+)
+
+// cacheVersion is included in the build cache's key. It must be incremented whenever
+// cacheEntry or render.PageMeta (including the types that it contains) change so that
+// entries written in an older format are discarded.
+const cacheVersion = 1
+
+// buildCache records the inputs that were used to generate pages and iframes so that
+// outputs whose inputs haven't changed can be reused in later builds.
+// All methods are safe for concurrent use, and a nil *buildCache never reports hits.
+type buildCache struct {
+	// Key identifies the executable and settings used to generate outputs.
+	// If it changes, all entries are discarded.
+	Key string `json:"key"`
+	// Entries is keyed by output paths relative to the output dir, e.g. "foo.amp.html".
+	Entries map[string]*cacheEntry `json:"entries"`
+
+	siteDir  string              // site dir containing cacheSubdir
+	mu       sync.Mutex          // protects the following fields and Entries
+	used     map[string]struct{} // keys from Entries used during the current build
+	prints   map[string]string   // memoized results from fingerprint, keyed by path
+	modified bool                // Entries has been changed
+}
+
+// cacheEntry describes a single cached output file.
+type cacheEntry struct {
+	// Deps contains fingerprints of the input files that were consulted to generate the output.
+	// Keys are paths relative to the site dir.
+	Deps map[string]string `json:"deps"`
+	// Page contains the page's metadata. It is nil for iframes.
+	Page *render.PageMeta `json:"page,omitempty"`
+}
+
+// loadBuildCache loads the build cache from siteDir.
+// If the cache doesn't exist or was written with a different key, an empty cache is returned.
+func loadBuildCache(siteDir, key string) (*buildCache, error) {
+	c := &buildCache{
+		Key:     key,
+		Entries: make(map[string]*cacheEntry),
+		siteDir: siteDir,
+		used:    make(map[string]struct{}),
+		prints:  make(map[string]string),
+	}
+	b, err := ioutil.ReadFile(filepath.Join(siteDir, cacheSubdir, cacheFile))
+	if os.IsNotExist(err) {
+		return c, nil
+	} else if err != nil {
+		return nil, err
+	}
+	var old buildCache
+	if err := json.Unmarshal(b, &old); err != nil {
+		// Just rebuild everything if the cache is corrupt.
+		logf("Ignoring bad build cache: %v", err)
+		c.modified = true
+		return c, nil
+	}
+	if old.Key != key {
+		c.modified = true
+		return c, nil
+	}
+	for name, e := range old.Entries {
+		c.Entries[name] = e
+	}
+	return c, nil
+}
+
+// reuse copies the cached version of the output file name to dest if it is still current.
+// If the file was copied, true is returned along with the entry's page metadata.
+func (c *buildCache) reuse(name, dest string) (bool, *render.PageMeta, error) {
+	if c == nil {
+		return false, nil, nil
+	}
+
+	c.mu.Lock()
+	e, ok := c.Entries[name]
+	c.mu.Unlock()
+	if !ok {
+		return false, nil, nil
+	}
+	for p, fp := range e.Deps {
+		if cur, err := c.fingerprint(filepath.Join(c.siteDir, p)); err != nil {
+			return false, nil, err
+		} else if cur != fp {
+			return false, nil, nil
+		}
+	}
+
+	src := filepath.Join(c.siteDir, cacheSubdir, cacheOutSubdir, name)
+	if err := copy.Copy(src, dest); os.IsNotExist(err) {
+		return false, nil, nil
+	} else if err != nil {
+		return false, nil, err
+	}
+
+	c.mu.Lock()
+	c.used[name] = struct{}{}
+	c.mu.Unlock()
+	return true, e.Page, nil
+}
+
+// update saves a copy of the newly-generated output file at src to the cache as name.
+// deps contains the paths of the files that were used to generate it, and meta contains
+// the page's metadata (if any). The site file is automatically included in deps.
+func (c *buildCache) update(name, src string, deps []string, meta *render.PageMeta) error {
+	if c == nil {
+		return nil
+	}
+
+	e := &cacheEntry{Deps: make(map[string]string), Page: meta}
+	for _, p := range append(deps, filepath.Join(c.siteDir, siteFile)) {
+		fp, err := c.fingerprint(p)
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(c.siteDir, p)
+		if err != nil {
+			return err
+		}
+		e.Deps[rel] = fp
+	}
+
+	dest := filepath.Join(c.siteDir, cacheSubdir, cacheOutSubdir, name)
+	if err := os.MkdirAll(filepath.Dir(dest), dirMode); err != nil {
+		return err
+	}
+	if err := copy.Copy(src, dest); err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	c.Entries[name] = e
+	c.used[name] = struct{}{}
+	c.modified = true
+	c.mu.Unlock()
+	return nil
+}
+
+// save removes entries that weren't used during the current build and writes the cache to disk.
+func (c *buildCache) save() error {
+	if c == nil {
+		return nil
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for name := range c.Entries {
+		if _, ok := c.used[name]; ok {
+			continue
+		}
+		delete(c.Entries, name)
+		c.modified = true
+		p := filepath.Join(c.siteDir, cacheSubdir, cacheOutSubdir, name)
+		if err := os.Remove(p); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	if !c.modified {
+		return nil
+	}
+
+	b, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return err
+	}
+	dir := filepath.Join(c.siteDir, cacheSubdir)
+	if err := os.MkdirAll(dir, dirMode); err != nil {
+		return err
+	}
+	// Write to a temp file first so a partially-written cache won't be loaded.
+	tp := filepath.Join(dir, cacheFile+".tmp")
+	if err := ioutil.WriteFile(tp, append(b, '\n'), fileMode); err != nil {
+		return err
+	}
+	if err := os.Rename(tp, filepath.Join(dir, cacheFile)); err != nil {
+		return err
+	}
+	c.modified = false
+	return nil
+}
+
+// fingerprint returns a string describing the current state of the file at p.
+// If p contains '*', it is treated as a glob and the fingerprint describes the matched paths.
+// Nonexistent files also receive a fingerprint, so their later creation will be noticed.
+func (c *buildCache) fingerprint(p string) (string, error) {
+	c.mu.Lock()
+	fp, ok := c.prints[p]
+	c.mu.Unlock()
+	if ok {
+		return fp, nil
+	}
+
+	if strings.ContainsRune(p, '*') {
+		ms, err := filepath.Glob(p)
+		if err != nil {
+			return "", err
+		}
+		// Only hash the matched filenames so that moving the site dir doesn't invalidate the cache.
+		for i, m := range ms {
+			ms[i] = filepath.Base(m)
+		}
+		sum := sha256.Sum256([]byte(strings.Join(ms, "\x00")))
+		fp = "glob:" + hex.EncodeToString(sum[:])
+	} else if fi, err := os.Stat(p); os.IsNotExist(err) {
+		fp = "missing"
+	} else if err != nil {
+		return "", err
+	} else {
+		// Like rsync, use the size and mtime rather than hashing the file's contents.
+		// Generated files like WebP images and inline CSS inherit their sources' mtimes.
+		fp = fmt.Sprintf("%d:%d", fi.Size(), fi.ModTime().UnixNano())
+	}
+
+	c.mu.Lock()
+	c.prints[p] = fp
+	c.mu.Unlock()
+	return fp, nil
+}
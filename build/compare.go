@@ -0,0 +1,98 @@
+// Copyright 2023 Daniel Erat.
+// All rights reserved.
+
+package build
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+)
+
+// DiffReport describes differences between a newly-built site and a reference directory.
+type DiffReport struct {
+	DirDiff
+	// Unexpected contains the paths of added, removed, and changed files that weren't
+	// matched by any of the patterns passed to Compare.
+	Unexpected []string `json:"unexpected"`
+}
+
+// Compare builds the site rooted at dir into a temporary directory and compares the output
+// against the directory ref (outSubdir under dir if empty). The temporary directory is deleted
+// afterward. flags and opts are passed to Build, but Prompt and Serve are ignored.
+// Changes to files whose slash-separated relative paths are matched by any of the path.Match
+// patterns in allow (e.g. "atom.xml" or "*.html") are not listed in the report's Unexpected field.
+// Compressed copies of files (e.g. "atom.xml.gz") are matched using their uncompressed paths.
+func Compare(ctx context.Context, dir, ref string, flags Flags, opts *Options,
+	allow []string) (*DiffReport, error) {
+	if ref == "" {
+		ref = filepath.Join(dir, outSubdir)
+	}
+	if fi, err := os.Stat(ref); err != nil {
+		return nil, err
+	} else if !fi.IsDir() {
+		return nil, fmt.Errorf("%v is not a directory", ref)
+	}
+	for _, pat := range allow {
+		if _, err := path.Match(pat, ""); err != nil {
+			return nil, fmt.Errorf("bad allowlist pattern %q: %v", pat, err)
+		}
+	}
+
+	out, err := ioutil.TempDir(dir, tmpOutPrefix)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create temp output dir: %v", err)
+	}
+	defer os.RemoveAll(out)
+
+	if err := Build(ctx, dir, out, flags&^(Prompt|Serve), opts); err != nil {
+		return nil, err
+	}
+	d, err := diffDirs(ref, out, flags&DiffIgnoreSpace != 0)
+	if err != nil {
+		return nil, fmt.Errorf("failed comparing output: %v", err)
+	}
+
+	report := DiffReport{DirDiff: *d, Unexpected: []string{}}
+	for _, fcs := range [][]FileChange{d.Added, d.Removed, d.Changed} {
+		for _, fc := range fcs {
+			p := fc.Path
+			if fc.Compressed {
+				p = trimCompressedExt(p)
+			}
+			if !matchesAny(allow, filepath.ToSlash(p)) {
+				report.Unexpected = append(report.Unexpected, fc.Path)
+			}
+		}
+	}
+	return &report, nil
+}
+
+// matchesAny returns true if p is matched by any of the path.Match patterns in pats.
+func matchesAny(pats []string, p string) bool {
+	for _, pat := range pats {
+		if ok, _ := path.Match(pat, p); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// WriteText writes a human-readable summary of r to w.
+func (r *DiffReport) WriteText(w io.Writer) error {
+	var b bytes.Buffer
+	r.writeSummary(&b, false)
+	if len(r.Unexpected) > 0 {
+		fmt.Fprintf(&b, "\n%d unexpected change(s):\n", len(r.Unexpected))
+		for _, p := range r.Unexpected {
+			fmt.Fprintf(&b, "  %s\n", p)
+		}
+	}
+	_, err := w.Write(b.Bytes())
+	return err
+}
@@ -4,14 +4,93 @@
 package build
 
 import (
+	"bytes"
 	"compress/gzip"
-	"io"
+	"fmt"
+	"io/ioutil"
 	"os"
 	"path/filepath"
+	"strings"
+
+	"github.com/derat/intransigence/render"
+
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/zstd"
 )
 
-// compressDir writes compressed versions of textual files within dir (including in subdirs).
-func compressDir(dir string) error {
+// Compression levels that can be specified via render.SiteInfo.CompressLevel.
+const (
+	levelFastest = "fastest"
+	levelDefault = "default"
+	levelBest    = "best"
+)
+
+// defaultCompressExts lists the extensions of files that are compressed if
+// render.SiteInfo.CompressExts is empty.
+var defaultCompressExts = []string{".css", ".htm", ".html", ".js", ".json", ".txt", ".xml"}
+
+// encoding describes a content encoding that can be used for precompressed files.
+type encoding struct {
+	ext string // extension appended to compressed files, e.g. ".gz"
+	// compress returns a compressed version of b at the supplied level.
+	// The output must only depend on b and level.
+	compress func(b []byte, level string) ([]byte, error)
+}
+
+// encodings contains supported encodings keyed by the names used in render.SiteInfo.CompressEncodings.
+var encodings = map[string]encoding{
+	"gzip": {".gz", compressGzip},
+	"br":   {".br", compressBrotli},
+	"zstd": {".zst", compressZstd},
+}
+
+// compressor writes precompressed copies of files.
+type compressor struct {
+	encs  []string            // keys from encodings
+	level string              // levelFastest, levelDefault, or levelBest
+	exts  map[string]struct{} // extensions of files to compress, e.g. ".html"
+}
+
+// newCompressor returns a compressor using the settings in si.
+// nil is returned if si doesn't request compression.
+func newCompressor(si *render.SiteInfo) (*compressor, error) {
+	encs := si.CompressEncodings
+	if len(encs) == 0 && si.CompressPages {
+		encs = []string{"gzip"}
+	}
+	if len(encs) == 0 {
+		return nil, nil
+	}
+	for _, enc := range encs {
+		if _, ok := encodings[enc]; !ok {
+			return nil, fmt.Errorf("unknown compression encoding %q", enc)
+		}
+	}
+
+	c := compressor{encs: encs, level: si.CompressLevel, exts: make(map[string]struct{})}
+	switch c.level {
+	case "":
+		c.level = levelDefault
+	case levelFastest, levelDefault, levelBest:
+	default:
+		return nil, fmt.Errorf("unknown compression level %q", c.level)
+	}
+
+	exts := si.CompressExts
+	if len(exts) == 0 {
+		exts = defaultCompressExts
+	}
+	for _, ext := range exts {
+		if !strings.HasPrefix(ext, ".") {
+			return nil, fmt.Errorf("compression extension %q doesn't start with '.'", ext)
+		}
+		c.exts[ext] = struct{}{}
+	}
+	return &c, nil
+}
+
+// compressDir writes compressed versions of files within dir (including in subdirs).
+func (c *compressor) compressDir(dir string) error {
 	return filepath.Walk(dir, func(p string, fi os.FileInfo, err error) error {
 		if err != nil {
 			return err
@@ -19,38 +98,91 @@ func compressDir(dir string) error {
 		if fi.Mode()&os.ModeType != 0 {
 			return nil
 		}
-		switch filepath.Ext(p) {
-		case ".css", ".htm", ".html", ".js", ".json", ".txt", ".xml":
-			dp := p + ".gz"
-			if err := compressFile(p, dp); err != nil {
+		if _, ok := c.exts[filepath.Ext(p)]; !ok {
+			return nil
+		}
+		b, err := ioutil.ReadFile(p)
+		if err != nil {
+			return err
+		}
+		for _, name := range c.encs {
+			enc := encodings[name]
+			dp := p + enc.ext
+			cb, err := enc.compress(b, c.level)
+			if err != nil {
+				return fmt.Errorf("failed compressing %v: %v", p, err)
+			}
+			// Don't bother writing the compressed file if it isn't smaller than the original.
+			if len(cb) >= len(b) {
+				if err := os.Remove(dp); err != nil && !os.IsNotExist(err) {
+					return err
+				}
+				continue
+			}
+			if err := ioutil.WriteFile(dp, cb, fileMode); err != nil {
+				return err
+			}
+			// Give the compressed file the same mtime and atime as the original file so rsync can skip it.
+			if err := os.Chtimes(dp, getAtime(fi), fi.ModTime()); err != nil {
 				return err
 			}
-			// Give the .gz file the same mtime and atime as the original file so rsync can skip it.
-			return os.Chtimes(dp, getAtime(fi), fi.ModTime())
-		default:
-			return nil
 		}
+		return nil
 	})
 }
 
-// compressFile writes a gzipped version of sp at dp.
+// compressGzip returns a gzipped version of b.
 // The modification time in the gzip header is unset.
-func compressFile(sp, dp string) error {
-	sf, err := os.Open(sp)
+func compressGzip(b []byte, level string) ([]byte, error) {
+	lvl := map[string]int{
+		levelFastest: gzip.BestSpeed,
+		levelDefault: gzip.DefaultCompression,
+		levelBest:    gzip.BestCompression,
+	}[level]
+	var out bytes.Buffer
+	w, err := gzip.NewWriterLevel(&out, lvl)
 	if err != nil {
-		return err
+		return nil, err
+	}
+	if _, err := w.Write(b); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
 	}
-	defer sf.Close()
+	return out.Bytes(), nil
+}
 
-	df, err := os.Create(dp)
-	if err != nil {
-		return err
+// compressBrotli returns a Brotli-compressed version of b.
+func compressBrotli(b []byte, level string) ([]byte, error) {
+	lvl := map[string]int{
+		levelFastest: brotli.BestSpeed,
+		levelDefault: brotli.DefaultCompression,
+		levelBest:    brotli.BestCompression,
+	}[level]
+	var out bytes.Buffer
+	w := brotli.NewWriterLevel(&out, lvl)
+	if _, err := w.Write(b); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
 	}
-	defer df.Close()
+	return out.Bytes(), nil
+}
 
-	w := gzip.NewWriter(df)
-	if _, err := io.Copy(w, sf); err != nil {
-		return err
+// compressZstd returns a Zstandard-compressed version of b.
+func compressZstd(b []byte, level string) ([]byte, error) {
+	lvl := map[string]zstd.EncoderLevel{
+		levelFastest: zstd.SpeedFastest,
+		levelDefault: zstd.SpeedDefault,
+		levelBest:    zstd.SpeedBestCompression,
+	}[level]
+	// EncodeAll compresses the data in a single goroutine, so the output is deterministic.
+	w, err := zstd.NewWriter(nil, zstd.WithEncoderLevel(lvl), zstd.WithEncoderConcurrency(1))
+	if err != nil {
+		return nil, err
 	}
-	return w.Close()
+	defer w.Close()
+	return w.EncodeAll(b, nil), nil
 }
@@ -0,0 +1,291 @@
+// Copyright 2023 Daniel Erat.
+// All rights reserved.
+
+package build
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// deployManifestFile is the name of the file in the root of the deploy target dir
+// that records the hashes of files written by Deploy.
+const deployManifestFile = ".intransigence-deploy.json"
+
+// DeployFlags specifies details of how Deploy syncs files.
+type DeployFlags int
+
+const (
+	// DryRun indicates that the target dir should not be modified.
+	DryRun DeployFlags = 1 << iota
+	// KeepStale indicates that files in the target dir that aren't present in the
+	// source dir should not be deleted.
+	KeepStale
+	// Overwrite indicates that the site should be deployed into a non-empty target dir
+	// that wasn't written by an earlier call to Deploy. Existing files are not deleted.
+	Overwrite
+)
+
+// DeployResult describes the changes made (or that would be made) by Deploy.
+type DeployResult struct {
+	Copied    []string // paths of new or changed files, relative to dirs
+	Deleted   []string // paths of stale files, relative to dirs
+	Unchanged int      // number of files that were already up-to-date
+}
+
+// deployManifest is stored as JSON in deployManifestFile.
+type deployManifest struct {
+	// Files contains info about files in the target dir keyed by path relative to the dir.
+	Files map[string]deployFile `json:"files"`
+}
+
+type deployFile struct {
+	Size int64  `json:"size"`
+	Hash string `json:"sha256"` // hex-encoded SHA-256 of contents
+}
+
+// Deploy syncs the contents of the built site in src to the directory dst.
+// Files are copied if their hashes differ from the ones recorded by the previous call
+// or if they are missing from dst. Each file is written to a temp file and then renamed,
+// so readers never see partially-written files. Unless KeepStale is set in flags,
+// files that were written by an earlier deploy but aren't present in src are deleted.
+// Other files in dst are never deleted. An error is returned if dst is non-empty but
+// wasn't written by an earlier deploy, unless Overwrite is set in flags.
+func Deploy(src, dst string, flags DeployFlags) (*DeployResult, error) {
+	srcFiles, err := hashDir(src)
+	if err != nil {
+		return nil, fmt.Errorf("failed hashing %v: %v", src, err)
+	}
+	old, found, err := readDeployManifest(dst)
+	if err != nil {
+		return nil, fmt.Errorf("failed reading manifest: %v", err)
+	}
+	if !found && flags&Overwrite == 0 {
+		if ents, err := ioutil.ReadDir(dst); err != nil && !os.IsNotExist(err) {
+			return nil, err
+		} else if len(ents) > 0 {
+			return nil, fmt.Errorf("%v isn't empty and wasn't written by an earlier deploy", dst)
+		}
+	}
+	dryRun := flags&DryRun != 0
+
+	var res DeployResult
+	man := deployManifest{Files: make(map[string]deployFile)}
+	for _, p := range sortedDeployKeys(srcFiles) {
+		sf := srcFiles[p]
+		man.Files[p] = sf
+		if of, ok := old.Files[p]; ok && of == sf {
+			// Also check the existing file's size in case it was modified by someone else.
+			if fi, err := os.Stat(filepath.Join(dst, p)); err == nil && fi.Size() == sf.Size {
+				res.Unchanged++
+				continue
+			}
+		}
+		res.Copied = append(res.Copied, p)
+		if !dryRun {
+			if err := replaceFile(filepath.Join(src, p), filepath.Join(dst, p)); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if flags&KeepStale == 0 {
+		if res.Deleted, err = deleteStaleFiles(dst, old.Files, srcFiles, dryRun); err != nil {
+			return nil, err
+		}
+	} else {
+		// Keep tracking stale files so that a later deploy can delete them.
+		for p, of := range old.Files {
+			if _, ok := man.Files[p]; !ok {
+				man.Files[p] = of
+			}
+		}
+	}
+
+	if !dryRun {
+		if err := writeDeployManifest(dst, &man); err != nil {
+			return nil, fmt.Errorf("failed writing manifest: %v", err)
+		}
+	}
+	return &res, nil
+}
+
+// hashDir returns the sizes and hashes of all regular files under dir,
+// keyed by path relative to dir.
+func hashDir(dir string) (map[string]deployFile, error) {
+	files := make(map[string]deployFile)
+	err := filepath.Walk(dir, func(p string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !fi.Mode().IsRegular() {
+			return nil
+		}
+		f, err := os.Open(p)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		h := sha256.New()
+		if _, err := io.Copy(h, f); err != nil {
+			return err
+		}
+		files[p[len(dir)+1:]] = deployFile{Size: fi.Size(), Hash: hex.EncodeToString(h.Sum(nil))}
+		return nil
+	})
+	return files, err
+}
+
+// sortedDeployKeys returns m's keys in ascending order.
+func sortedDeployKeys(m map[string]deployFile) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// readDeployManifest reads deployManifestFile from dir.
+// If the file doesn't exist, an empty manifest is returned and found is false.
+func readDeployManifest(dir string) (man *deployManifest, found bool, err error) {
+	man = &deployManifest{Files: make(map[string]deployFile)}
+	b, err := ioutil.ReadFile(filepath.Join(dir, deployManifestFile))
+	if os.IsNotExist(err) {
+		return man, false, nil
+	} else if err != nil {
+		return nil, false, err
+	}
+	if err := json.Unmarshal(b, man); err != nil {
+		return nil, false, err
+	}
+	if man.Files == nil {
+		man.Files = make(map[string]deployFile)
+	}
+	return man, true, nil
+}
+
+// writeDeployManifest atomically writes man to deployManifestFile in dir.
+func writeDeployManifest(dir string, man *deployManifest) error {
+	b, err := json.MarshalIndent(man, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dir, dirMode); err != nil {
+		return err
+	}
+	f, err := ioutil.TempFile(dir, deployManifestFile+".")
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(append(b, '\n')); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	if err := os.Chmod(f.Name(), fileMode); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	return os.Rename(f.Name(), filepath.Join(dir, deployManifestFile))
+}
+
+// replaceFile copies sp to dp by writing a temp file in dp's dir and renaming it.
+// sp's mtime and atime are preserved.
+func replaceFile(sp, dp string) error {
+	if err := os.MkdirAll(filepath.Dir(dp), dirMode); err != nil {
+		return err
+	}
+	sf, err := os.Open(sp)
+	if err != nil {
+		return err
+	}
+	defer sf.Close()
+
+	tf, err := ioutil.TempFile(filepath.Dir(dp), "."+filepath.Base(dp)+".")
+	if err != nil {
+		return err
+	}
+	tp := tf.Name()
+	if _, err := io.Copy(tf, sf); err != nil {
+		tf.Close()
+		os.Remove(tp)
+		return err
+	}
+	if err := tf.Close(); err != nil {
+		os.Remove(tp)
+		return err
+	}
+	if err := os.Chmod(tp, fileMode); err != nil {
+		os.Remove(tp)
+		return err
+	}
+	if err := copyTimes(sp, tp); err != nil {
+		os.Remove(tp)
+		return err
+	}
+	return os.Rename(tp, dp)
+}
+
+// deleteStaleFiles deletes files under dir that are listed in old (the previous deploy's
+// manifest) but not in keep, along with any of their parent directories that become empty
+// as a result. Files that aren't listed in old are never deleted.
+// The relative paths of deleted files are returned in ascending order.
+// If dryRun is true, the paths are returned but nothing is deleted.
+func deleteStaleFiles(dir string, old, keep map[string]deployFile, dryRun bool) ([]string, error) {
+	var stale []string
+	for _, rel := range sortedDeployKeys(old) {
+		if _, ok := keep[rel]; ok {
+			continue
+		}
+		if fi, err := os.Lstat(filepath.Join(dir, rel)); os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			return nil, err
+		} else if !fi.Mode().IsRegular() {
+			continue
+		}
+		stale = append(stale, rel)
+	}
+	if dryRun {
+		return stale, nil
+	}
+
+	dirs := make(map[string]struct{})
+	for _, rel := range stale {
+		if err := os.Remove(filepath.Join(dir, rel)); err != nil {
+			return nil, err
+		}
+		for d := filepath.Dir(rel); d != "."; d = filepath.Dir(d) {
+			dirs[d] = struct{}{}
+		}
+	}
+	// Remove empty dirs, starting with the most deeply-nested ones.
+	sorted := make([]string, 0, len(dirs))
+	for d := range dirs {
+		sorted = append(sorted, d)
+	}
+	sort.Sort(sort.Reverse(sort.StringSlice(sorted)))
+	for _, d := range sorted {
+		p := filepath.Join(dir, d)
+		if ents, err := ioutil.ReadDir(p); err != nil {
+			return nil, err
+		} else if len(ents) == 0 {
+			if err := os.Remove(p); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return stale, nil
+}
@@ -0,0 +1,113 @@
+// Copyright 2023 Daniel Erat.
+// All rights reserved.
+
+package build
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestDeploy(t *testing.T) {
+	dir, err := ioutil.TempDir("", "deploy_test.")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	src, dst := filepath.Join(dir, "src"), filepath.Join(dir, "dst")
+
+	write := func(p, data string) {
+		p = filepath.Join(dir, p)
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(p, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// listFiles returns the paths of regular files under dst, including the manifest.
+	listFiles := func(dst string) []string {
+		var ps []string
+		if err := filepath.Walk(dst, func(p string, fi os.FileInfo, err error) error {
+			if err == nil && fi.Mode().IsRegular() {
+				ps = append(ps, p[len(dst)+1:])
+			}
+			return err
+		}); err != nil {
+			t.Fatal(err)
+		}
+		sort.Strings(ps)
+		return ps
+	}
+	deployTo := func(dst string, flags DeployFlags, copied, deleted []string, unchanged int) {
+		res, err := Deploy(src, dst, flags)
+		if err != nil {
+			t.Fatalf("Deploy(%v) failed: %v", flags, err)
+		}
+		if want := (DeployResult{copied, deleted, unchanged}); !reflect.DeepEqual(*res, want) {
+			t.Errorf("Deploy(%v) returned %+v; want %+v", flags, *res, want)
+		}
+	}
+	deploy := func(flags DeployFlags, copied, deleted []string, unchanged int) {
+		deployTo(dst, flags, copied, deleted, unchanged)
+	}
+
+	write("src/index.html", "index")
+	write("src/a/b.html", "b")
+	write("src/c.txt", "c")
+	deploy(0, []string{"a/b.html", "c.txt", "index.html"}, nil, 0)
+	if got, want := listFiles(dst), []string{deployManifestFile, "a/b.html", "c.txt", "index.html"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Got files %q after first deploy; want %q", got, want)
+	}
+	compareFiles(t, filepath.Join(dst, "a/b.html"), filepath.Join(src, "a/b.html"), contentsEqual|mtimeEqual)
+
+	// Unchanged files should be skipped based on the manifest, so this modification
+	// (which preserves the file's size) shouldn't be overwritten.
+	write("dst/c.txt", "C")
+	write("src/index.html", "new index")
+	write("dst/extra.txt", "extra")
+	if err := os.Remove(filepath.Join(src, "a/b.html")); err != nil {
+		t.Fatal(err)
+	}
+
+	// A dry run shouldn't change anything. Files that weren't written by an earlier deploy
+	// should never be deleted.
+	deploy(DryRun, []string{"index.html"}, []string{"a/b.html"}, 1)
+	checkFileContents(t, filepath.Join(dst, "index.html"), "index")
+	checkFileContents(t, filepath.Join(dst, "a/b.html"), "b")
+
+	deploy(KeepStale, []string{"index.html"}, nil, 1)
+	checkFileContents(t, filepath.Join(dst, "index.html"), "new index")
+	checkFileContents(t, filepath.Join(dst, "a/b.html"), "b")
+	checkFileContents(t, filepath.Join(dst, "c.txt"), "C")
+
+	deploy(0, nil, []string{"a/b.html"}, 2)
+	if got, want := listFiles(dst), []string{deployManifestFile, "c.txt", "extra.txt", "index.html"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Got files %q after last deploy; want %q", got, want)
+	}
+	checkFileNotExist(t, filepath.Join(dst, "a"))
+
+	// A missing file should be recopied even if the manifest lists it.
+	if err := os.Remove(filepath.Join(dst, "index.html")); err != nil {
+		t.Fatal(err)
+	}
+	deploy(0, []string{"index.html"}, nil, 1)
+
+	// The first deploy into a non-empty dir should fail unless Overwrite is passed,
+	// and existing files should be left alone.
+	other := filepath.Join(dir, "other")
+	write("other/keep.txt", "keep")
+	if _, err := Deploy(src, other, 0); err == nil {
+		t.Error("Deploy into non-empty dir unexpectedly succeeded")
+	}
+	checkFileNotExist(t, filepath.Join(other, "index.html"))
+	deployTo(other, Overwrite, []string{"c.txt", "index.html"}, nil, 0)
+	deployTo(other, 0, nil, nil, 2)
+	if got, want := listFiles(other), []string{deployManifestFile, "c.txt", "index.html", "keep.txt"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Got files %q after deploying to non-empty dir; want %q", got, want)
+	}
+}
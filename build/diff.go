@@ -9,11 +9,17 @@ import (
 	"context"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"net/http"
 	"os"
 	"os/exec"
+	"path/filepath"
+	"sort"
 	"strings"
 	"syscall"
+	"unicode/utf8"
+
+	"github.com/pmezard/go-difflib/difflib"
 )
 
 const serverAddr = ":8888"
@@ -21,7 +27,8 @@ const serverAddr = ":8888"
 // prompt displays differences between directories a and b and
 // prompts the user to accept the changes. The user's response is returned.
 // If serveB is true, an HTTP server is started at serveAddr to serve the contents of b.
-func prompt(ctx context.Context, a, b string, serveB bool) (ok bool, err error) {
+// If ignoreSpace is true, whitespace-only changes in text files are ignored.
+func prompt(ctx context.Context, a, b string, serveB, ignoreSpace bool) (ok bool, err error) {
 	var msg string
 	var srv *http.Server
 	var sch <-chan error
@@ -30,7 +37,7 @@ func prompt(ctx context.Context, a, b string, serveB bool) (ok bool, err error)
 		srv, sch = startServer(b, serverAddr)
 	}
 
-	ok, perr := showDiffAndPrompt(ctx, a, b, msg)
+	ok, perr := showDiffAndPrompt(ctx, a, b, msg, ignoreSpace)
 
 	var serr error
 	if srv != nil {
@@ -63,9 +70,9 @@ func startServer(dir, addr string) (*http.Server, <-chan error) {
 // showDiffAndPrompt displays differences between directories a and b and
 // prompts the user to accept the changes. The user's response is returned.
 // msg is printed above the diff.
-func showDiffAndPrompt(ctx context.Context, a, b, msg string) (ok bool, err error) {
+func showDiffAndPrompt(ctx context.Context, a, b, msg string, ignoreSpace bool) (ok bool, err error) {
 	for {
-		if err := showDiff(ctx, a, b, msg); err != nil {
+		if err := showDiff(ctx, a, b, msg, ignoreSpace); err != nil {
 			return false, err
 		}
 
@@ -84,9 +91,14 @@ func showDiffAndPrompt(ctx context.Context, a, b, msg string) (ok bool, err erro
 	}
 }
 
-// showDiff displays differences between directories a and b.
+// showDiff displays differences between directories a and b using $PAGER (less if unset).
 // header is written above the diff.
-func showDiff(ctx context.Context, a, b, header string) error {
+func showDiff(ctx context.Context, a, b, header string, ignoreSpace bool) error {
+	d, err := diffDirs(a, b, ignoreSpace)
+	if err != nil {
+		return err
+	}
+
 	pager := os.Getenv("PAGER")
 	if pager == "" {
 		pager = "less"
@@ -104,26 +116,9 @@ func showDiff(ctx context.Context, a, b, header string) error {
 	}
 
 	io.WriteString(pagerStdin, header)
-
-	diffCmd := exec.CommandContext(ctx, "diff", "-r", "-u", "--color=always", a, b)
-	diffCmd.Stdout = pagerStdin
-	var diffStderr bytes.Buffer
-	diffCmd.Stderr = &diffStderr
-
-	// diff(1): "Exit status is 0 if inputs are the same, 1 if different, 2 if trouble."
-	diffErr := diffCmd.Run()
-	if diffErr == nil {
-		io.WriteString(pagerStdin, "No differences.\n")
-	} else if exitErr, ok := diffErr.(*exec.ExitError); ok {
-		if exitErr.ExitCode() == 1 {
-			diffErr = nil // differences found
-		} else if ws, ok := exitErr.Sys().(syscall.WaitStatus); ok && ws.Signal() == syscall.SIGPIPE {
-			diffErr = nil // pager exited before it read entire diff
-		}
-	}
-	if diffErr != nil {
-		io.WriteString(pagerStdin, diffStderr.String())
-		diffErr = fmt.Errorf("%q failed: %v", strings.Join(diffCmd.Args, " "), diffErr)
+	werr := d.write(pagerStdin, true)
+	if perr, ok := werr.(*os.PathError); ok && perr.Err == syscall.EPIPE {
+		werr = nil // pager exited before it read entire diff
 	}
 
 	if err := pagerStdin.Close(); err != nil {
@@ -132,5 +127,249 @@ func showDiff(ctx context.Context, a, b, header string) error {
 	if err := pagerCmd.Wait(); err != nil {
 		return fmt.Errorf("failed waiting for %q: %v", strings.Join(pagerCmd.Args, " "), err)
 	}
-	return diffErr
+	return werr
+}
+
+// FileChange describes a file that differs between two directories.
+type FileChange struct {
+	Path    string `json:"path"`     // path relative to dirs
+	OldSize int64  `json:"old_size"` // size in bytes in old dir (-1 if missing)
+	NewSize int64  `json:"new_size"` // size in bytes in new dir (-1 if missing)
+	Binary  bool   `json:"binary"`   // true if either version isn't text
+	// Compressed is true if the file is a precompressed copy of another file (e.g. "index.html.gz").
+	// Only the sizes of compressed files are compared.
+	Compressed bool `json:"compressed"`
+
+	// Unified diff of old and new versions. Only set for changed text files.
+	diff string
+}
+
+// DirDiff describes differences between two directories.
+type DirDiff struct {
+	Added   []FileChange `json:"added"`
+	Removed []FileChange `json:"removed"`
+	Changed []FileChange `json:"changed"`
+}
+
+// binaryCheckLen is the number of leading bytes that are checked for NULs by isBinary.
+const binaryCheckLen = 8000
+
+// isBinary returns true if b doesn't look like text.
+func isBinary(b []byte) bool {
+	n := len(b)
+	if n > binaryCheckLen {
+		n = binaryCheckLen
+	}
+	return bytes.IndexByte(b[:n], 0) >= 0 || !utf8.Valid(b)
+}
+
+// diffDirs compares the files in directory a (old) against the ones in b (new).
+// If ignoreSpace is true, text files that only differ in whitespace are treated as unchanged,
+// and whitespace is collapsed within lines in diffs.
+func diffDirs(a, b string, ignoreSpace bool) (*DirDiff, error) {
+	af, err := listDiffFiles(a)
+	if err != nil {
+		return nil, err
+	}
+	bf, err := listDiffFiles(b)
+	if err != nil {
+		return nil, err
+	}
+
+	// Use empty slices rather than nil so JSON reports contain arrays.
+	d := DirDiff{Added: []FileChange{}, Removed: []FileChange{}, Changed: []FileChange{}}
+	for _, p := range sortedKeys(af) {
+		if _, ok := bf[p]; !ok {
+			d.Removed = append(d.Removed, FileChange{Path: p, OldSize: af[p], NewSize: -1,
+				Compressed: isCompressedCopy(p, af)})
+		}
+	}
+	for _, p := range sortedKeys(bf) {
+		if _, ok := af[p]; !ok {
+			d.Added = append(d.Added, FileChange{Path: p, OldSize: -1, NewSize: bf[p],
+				Compressed: isCompressedCopy(p, bf)})
+			continue
+		}
+		if isCompressedCopy(p, af) || isCompressedCopy(p, bf) {
+			// Diffs of compressed data aren't useful, so just report size changes.
+			if af[p] != bf[p] {
+				d.Changed = append(d.Changed, FileChange{Path: p, OldSize: af[p], NewSize: bf[p],
+					Binary: true, Compressed: true})
+			}
+			continue
+		}
+		ab, err := ioutil.ReadFile(filepath.Join(a, p))
+		if err != nil {
+			return nil, err
+		}
+		bb, err := ioutil.ReadFile(filepath.Join(b, p))
+		if err != nil {
+			return nil, err
+		}
+		if bytes.Equal(ab, bb) {
+			continue
+		}
+		fc := FileChange{Path: p, OldSize: af[p], NewSize: bf[p], Binary: isBinary(ab) || isBinary(bb)}
+		if !fc.Binary {
+			as, bs := string(ab), string(bb)
+			if ignoreSpace {
+				if strings.Join(strings.Fields(as), " ") == strings.Join(strings.Fields(bs), " ") {
+					continue
+				}
+				as, bs = collapseSpace(as), collapseSpace(bs)
+			}
+			if fc.diff, err = difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
+				A:        splitLines(as),
+				B:        splitLines(bs),
+				FromFile: filepath.Join(filepath.Base(a), p),
+				ToFile:   filepath.Join(filepath.Base(b), p),
+				Context:  3,
+			}); err != nil {
+				return nil, err
+			}
+		}
+		d.Changed = append(d.Changed, fc)
+	}
+	return &d, nil
+}
+
+// listDiffFiles returns the sizes of regular files under dir, keyed by path relative to dir.
+func listDiffFiles(dir string) (map[string]int64, error) {
+	files := make(map[string]int64)
+	if err := filepath.Walk(dir, func(p string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if fi.Mode().IsRegular() {
+			files[p[len(dir)+1:]] = fi.Size()
+		}
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	return files, nil
+}
+
+// isCompressedCopy returns true if p is a compressed copy of another file in files
+// (e.g. "foo.html.gz" alongside "foo.html").
+func isCompressedCopy(p string, files map[string]int64) bool {
+	orig := trimCompressedExt(p)
+	if orig == p {
+		return false
+	}
+	_, ok := files[orig]
+	return ok
+}
+
+// trimCompressedExt returns p with its compressed-encoding extension (e.g. ".gz") removed.
+// p is returned unchanged if it doesn't have such an extension.
+func trimCompressedExt(p string) string {
+	for _, enc := range encodings {
+		if strings.HasSuffix(p, enc.ext) {
+			return p[:len(p)-len(enc.ext)]
+		}
+	}
+	return p
+}
+
+// sortedKeys returns m's keys in ascending order.
+func sortedKeys(m map[string]int64) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// splitLines splits s into newline-terminated lines.
+// Unlike difflib.SplitLines, it doesn't add an empty line after a trailing newline.
+func splitLines(s string) []string {
+	lines := strings.SplitAfter(s, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	} else {
+		lines[len(lines)-1] += "\n"
+	}
+	return lines
+}
+
+// collapseSpace trims leading and trailing whitespace from each line in s
+// and replaces other runs of whitespace with single spaces.
+func collapseSpace(s string) string {
+	lines := strings.Split(s, "\n")
+	for i, ln := range lines {
+		lines[i] = strings.Join(strings.Fields(ln), " ")
+	}
+	return strings.Join(lines, "\n")
+}
+
+// ANSI escape sequences used by DirDiff.write.
+const (
+	colorReset = "\x1b[0m"
+	colorBold  = "\x1b[1m"
+	colorRed   = "\x1b[31m"
+	colorGreen = "\x1b[32m"
+	colorCyan  = "\x1b[36m"
+)
+
+// colorize wraps s in the ANSI escape sequence c if color is true.
+func colorize(color bool, c, s string) string {
+	if !color {
+		return s
+	}
+	return c + s + colorReset
+}
+
+// writeSummary writes a list of added, removed, and changed files to b.
+func (d *DirDiff) writeSummary(b *bytes.Buffer, color bool) {
+	if len(d.Added) == 0 && len(d.Removed) == 0 && len(d.Changed) == 0 {
+		b.WriteString("No differences.\n")
+	}
+	for _, fc := range d.Added {
+		fmt.Fprintln(b, colorize(color, colorGreen, fmt.Sprintf("Added    %s (%d bytes)", fc.Path, fc.NewSize)))
+	}
+	for _, fc := range d.Removed {
+		fmt.Fprintln(b, colorize(color, colorRed, fmt.Sprintf("Removed  %s (%d bytes)", fc.Path, fc.OldSize)))
+	}
+	for _, fc := range d.Changed {
+		kind := ""
+		if fc.Compressed {
+			kind = ", compressed"
+		} else if fc.Binary {
+			kind = ", binary"
+		}
+		fmt.Fprintf(b, "Changed  %s (%d -> %d bytes%s)\n", fc.Path, fc.OldSize, fc.NewSize, kind)
+	}
+}
+
+// write writes a summary of added, removed, and changed files to w,
+// followed by unified diffs of changed text files.
+// If color is true, ANSI escape sequences are used to colorize the output.
+func (d *DirDiff) write(w io.Writer, color bool) error {
+	var b bytes.Buffer
+	d.writeSummary(&b, color)
+	for _, fc := range d.Changed {
+		if fc.diff == "" {
+			continue
+		}
+		b.WriteString("\n")
+		for _, ln := range strings.SplitAfter(fc.diff, "\n") {
+			switch {
+			case ln == "":
+			case strings.HasPrefix(ln, "---"), strings.HasPrefix(ln, "+++"):
+				ln = colorize(color, colorBold, strings.TrimSuffix(ln, "\n")) + "\n"
+			case strings.HasPrefix(ln, "@@"):
+				ln = colorize(color, colorCyan, strings.TrimSuffix(ln, "\n")) + "\n"
+			case strings.HasPrefix(ln, "-"):
+				ln = colorize(color, colorRed, strings.TrimSuffix(ln, "\n")) + "\n"
+			case strings.HasPrefix(ln, "+"):
+				ln = colorize(color, colorGreen, strings.TrimSuffix(ln, "\n")) + "\n"
+			}
+			b.WriteString(ln)
+		}
+	}
+
+	_, err := w.Write(b.Bytes())
+	return err
 }
@@ -0,0 +1,120 @@
+// Copyright 2023 Daniel Erat.
+// All rights reserved.
+
+package build
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestDiffDirs(t *testing.T) {
+	dir, err := ioutil.TempDir("", "diff_test.")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	write := func(p, data string) {
+		p = filepath.Join(dir, p)
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(p, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("old/same.html", "same\n")
+	write("new/same.html", "same\n")
+	write("old/removed.txt", "removed\n")
+	write("new/added.txt", "added\n")
+	write("new/sub/added.html", "<p>added</p>\n")
+	write("old/changed.html", "a\nb\nc\n")
+	write("new/changed.html", "a\nB\nc\n")
+	write("old/space.html", "<p>\n  a b\n</p>\n")
+	write("new/space.html", "<p>\n    a   b\n</p>\n")
+	write("old/img.png", "\x89PNG\x00\x01")
+	write("new/img.png", "\x89PNG\x00\x01\x02")
+	// Only size changes should be reported for compressed siblings.
+	write("old/same.html.gz", "old")
+	write("new/same.html.gz", "new")
+	write("old/changed.html.gz", "old")
+	write("new/changed.html.gz", "newer")
+	write("new/added.txt.br", "added")
+	// Compressed files without uncompressed siblings should be included.
+	write("new/archive.gz", "archive")
+
+	oldDir, newDir := filepath.Join(dir, "old"), filepath.Join(dir, "new")
+	d, err := diffDirs(oldDir, newDir, false)
+	if err != nil {
+		t.Fatal("diffDirs failed:", err)
+	}
+	paths := func(fcs []FileChange) []string {
+		var ps []string
+		for _, fc := range fcs {
+			ps = append(ps, fc.Path)
+		}
+		return ps
+	}
+	if got, want := paths(d.Added), []string{"added.txt", "added.txt.br", "archive.gz", "sub/added.html"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("diffDirs added %q; want %q", got, want)
+	} else if !d.Added[1].Compressed || d.Added[2].Compressed {
+		t.Errorf("diffDirs added %+v; want only %v to be compressed", d.Added, d.Added[1].Path)
+	}
+	if got, want := paths(d.Removed), []string{"removed.txt"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("diffDirs removed %q; want %q", got, want)
+	}
+	if got, want := paths(d.Changed), []string{"changed.html", "changed.html.gz", "img.png", "space.html"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("diffDirs changed %q; want %q", got, want)
+	} else {
+		if want := (FileChange{Path: "changed.html.gz", OldSize: 3, NewSize: 5, Binary: true, Compressed: true}); d.Changed[1] != want {
+			t.Errorf("diffDirs returned %+v; want %+v", d.Changed[1], want)
+		}
+		if want := (FileChange{Path: "img.png", OldSize: 6, NewSize: 7, Binary: true}); d.Changed[2] != want {
+			t.Errorf("diffDirs returned %+v; want %+v", d.Changed[2], want)
+		}
+		if want := "-b\n+B\n"; !strings.Contains(d.Changed[0].diff, want) {
+			t.Errorf("changed.html diff %q doesn't contain %q", d.Changed[0].diff, want)
+		}
+	}
+
+	var b bytes.Buffer
+	if err := d.write(&b, false); err != nil {
+		t.Fatal("write failed:", err)
+	}
+	for _, want := range []string{
+		"Added    added.txt (6 bytes)\n",
+		"Removed  removed.txt (8 bytes)\n",
+		"Changed  img.png (6 -> 7 bytes, binary)\n",
+		"Changed  changed.html.gz (3 -> 5 bytes, compressed)\n",
+		"Changed  changed.html (6 -> 6 bytes)\n",
+		"--- old/changed.html\n+++ new/changed.html\n@@ -1,3 +1,3 @@\n a\n-b\n+B\n c\n",
+	} {
+		if !strings.Contains(b.String(), want) {
+			t.Errorf("write output doesn't contain %q:\n%s", want, b.String())
+		}
+	}
+
+	// Whitespace-only changes should be ignored if requested.
+	if d, err := diffDirs(oldDir, newDir, true); err != nil {
+		t.Fatal("diffDirs failed:", err)
+	} else if got, want := paths(d.Changed), []string{"changed.html", "changed.html.gz", "img.png"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("diffDirs with ignoreSpace changed %q; want %q", got, want)
+	}
+
+	d, err = diffDirs(oldDir, oldDir, false)
+	if err != nil {
+		t.Fatal("diffDirs failed:", err)
+	}
+	b.Reset()
+	if err := d.write(&b, false); err != nil {
+		t.Fatal("write failed:", err)
+	} else if got, want := b.String(), "No differences.\n"; got != want {
+		t.Errorf("write for identical dirs produced %q; want %q", got, want)
+	}
+}
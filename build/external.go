@@ -0,0 +1,358 @@
+// Copyright 2023 Daniel Erat.
+// All rights reserved.
+
+package build
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/html"
+)
+
+const (
+	externalCacheFile = "external.json" // file under cacheSubdir containing external link results
+	externalJobs      = 8               // maximum number of concurrent requests
+	externalHostDelay = time.Second     // minimum delay between requests to the same host
+	externalTimeout   = 15 * time.Second
+	externalUserAgent = "Mozilla/5.0 (compatible; intransigence link checker)"
+
+	// DefaultExternalTTL is used when Options.ExternalTTL is zero.
+	DefaultExternalTTL = 7 * 24 * time.Hour
+)
+
+// Statuses for external links.
+const (
+	linkOK         = "ok"
+	linkDead       = "dead"
+	linkRedirected = "redirected"
+	linkTimedOut   = "timed_out"
+)
+
+// linkResult describes the result of checking an external link.
+type linkResult struct {
+	Status   string    `json:"status"`             // one of the link* constants
+	Code     int       `json:"code,omitempty"`     // HTTP status code, if a response was received
+	Location string    `json:"location,omitempty"` // redirect target for linkRedirected
+	Error    string    `json:"error,omitempty"`    // error message if no response was received
+	Checked  time.Time `json:"checked"`
+}
+
+// cacheable returns true if res is definitive enough to be cached. Timeouts, transport errors,
+// and error statuses other than 404 and 410 may be transient, so they're checked again
+// by the next run.
+func (res *linkResult) cacheable() bool {
+	if res.Error != "" || res.Code == 0 {
+		return false
+	}
+	return res.Code < 400 || res.Code == http.StatusNotFound || res.Code == http.StatusGone
+}
+
+func (res *linkResult) String() string {
+	switch {
+	case res.Status == linkRedirected:
+		return fmt.Sprintf("%d -> %s", res.Code, res.Location)
+	case res.Error != "":
+		return res.Error
+	case res.Code != 0:
+		return fmt.Sprintf("%d %s", res.Code, http.StatusText(res.Code))
+	}
+	return ""
+}
+
+// externalChecker checks external links over HTTP.
+type externalChecker struct {
+	client    *http.Client     // doesn't follow redirects
+	jobs      int              // maximum concurrent requests
+	hostDelay time.Duration    // minimum delay between requests to the same host
+	ttl       time.Duration    // maximum age of cached results
+	now       func() time.Time // returns the current time
+}
+
+// newExternalChecker returns a new externalChecker that sends requests using client
+// (or a default client if nil) and reuses cached results that are newer than ttl.
+func newExternalChecker(client *http.Client, ttl time.Duration) *externalChecker {
+	// Copy the client so that redirects can be reported instead of followed.
+	var c http.Client
+	if client != nil {
+		c = *client
+	} else {
+		c.Timeout = externalTimeout
+	}
+	c.CheckRedirect = func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }
+	if ttl <= 0 {
+		ttl = DefaultExternalTTL
+	}
+	return &externalChecker{
+		client:    &c,
+		jobs:      externalJobs,
+		hostDelay: externalHostDelay,
+		ttl:       ttl,
+		now:       time.Now,
+	}
+}
+
+// checkAll checks urls and returns results keyed by URL. Unexpired results are read from
+// cache, and new cacheable results are added to it. Requests to different hosts are made in parallel,
+// while requests to the same host are made sequentially with ec.hostDelay between them.
+func (ec *externalChecker) checkAll(ctx context.Context, urls []string,
+	cache map[string]linkResult) map[string]linkResult {
+	results := make(map[string]linkResult, len(urls))
+	hosts := make(map[string][]string) // URLs that need to be checked, keyed by host
+	for _, u := range urls {
+		if res, ok := cache[u]; ok && res.cacheable() && ec.now().Sub(res.Checked) < ec.ttl {
+			results[u] = res
+			continue
+		}
+		host := u
+		if pu, err := url.Parse(u); err == nil {
+			host = strings.ToLower(pu.Host)
+		}
+		hosts[host] = append(hosts[host], u)
+	}
+
+	var mu sync.Mutex // protects results, cache, and done
+	var done int
+	total := len(urls) - len(results)
+	sem := make(chan struct{}, ec.jobs)
+	var wg sync.WaitGroup
+	for _, hostURLs := range hosts {
+		wg.Add(1)
+		go func(hostURLs []string) {
+			defer wg.Done()
+			var last time.Time // time of last request to host
+			wait := func() {
+				if d := ec.hostDelay - time.Since(last); !last.IsZero() && d > 0 {
+					select {
+					case <-time.After(d):
+					case <-ctx.Done():
+					}
+				}
+				sem <- struct{}{}
+			}
+			release := func() {
+				<-sem
+				last = time.Now()
+			}
+			for _, u := range hostURLs {
+				res := ec.check(ctx, u, wait, release)
+				mu.Lock()
+				results[u] = res
+				if res.cacheable() {
+					cache[u] = res
+				} else {
+					delete(cache, u)
+				}
+				done++
+				statusf("Checking external links: [%d/%d]", done, total)
+				mu.Unlock()
+			}
+		}(hostURLs)
+	}
+	wg.Wait()
+	clearStatus()
+	return results
+}
+
+// check checks u, first with a HEAD request and then with a GET request if needed.
+// wait and release are called before and after each request.
+func (ec *externalChecker) check(ctx context.Context, u string, wait, release func()) linkResult {
+	res := ec.request(ctx, http.MethodHead, u, wait, release)
+	// Some servers don't support HEAD, so try again with GET.
+	if res.Status == linkDead {
+		res = ec.request(ctx, http.MethodGet, u, wait, release)
+	}
+	return res
+}
+
+// request sends a single request for u using method and returns the result.
+func (ec *externalChecker) request(ctx context.Context, method, u string, wait, release func()) linkResult {
+	res := linkResult{Checked: ec.now()}
+	req, err := http.NewRequestWithContext(ctx, method, u, nil)
+	if err != nil {
+		res.Status = linkDead
+		res.Error = err.Error()
+		return res
+	}
+	req.Header.Set("User-Agent", externalUserAgent)
+
+	wait()
+	resp, err := ec.client.Do(req)
+	release()
+	if err != nil {
+		var ue *url.Error
+		if (errors.As(err, &ue) && ue.Timeout()) || errors.Is(err, context.DeadlineExceeded) {
+			res.Status = linkTimedOut
+		} else {
+			res.Status = linkDead
+		}
+		res.Error = err.Error()
+		return res
+	}
+	// Discard a bit of the body so the connection can hopefully be reused.
+	io.CopyN(ioutil.Discard, resp.Body, 4096)
+	resp.Body.Close()
+
+	res.Code = resp.StatusCode
+	switch {
+	case resp.StatusCode >= 300 && resp.StatusCode < 400 && resp.Header.Get("Location") != "":
+		res.Status = linkRedirected
+		res.Location = resp.Header.Get("Location")
+		if loc, err := resp.Request.URL.Parse(res.Location); err == nil {
+			res.Location = loc.String()
+		}
+	case resp.StatusCode >= 400:
+		res.Status = linkDead
+	default:
+		res.Status = linkOK
+	}
+	return res
+}
+
+// externalLink describes a problematic external link in a page.
+type externalLink struct {
+	page string // out-relative path of page containing link
+	url  string
+	res  linkResult
+}
+
+// externalReport describes the results of checking external links.
+type externalReport struct {
+	checked int            // number of unique URLs that were checked
+	bad     []externalLink // sorted by page and then URL
+}
+
+// write writes a human-readable summary of r to w, grouped by page.
+func (r *externalReport) write(w io.Writer) error {
+	counts := make(map[string]int) // unique URLs keyed by status
+	seen := make(map[string]struct{})
+	for _, l := range r.bad {
+		if _, ok := seen[l.url]; !ok {
+			counts[l.res.Status]++
+			seen[l.url] = struct{}{}
+		}
+	}
+	if _, err := fmt.Fprintf(w, "Checked %d external link(s): %d dead, %d redirected, %d timed out\n",
+		r.checked, counts[linkDead], counts[linkRedirected], counts[linkTimedOut]); err != nil {
+		return err
+	}
+	var last string
+	for _, l := range r.bad {
+		if l.page != last {
+			if _, err := fmt.Fprintf(w, "%s:\n", l.page); err != nil {
+				return err
+			}
+			last = l.page
+		}
+		if _, err := fmt.Fprintf(w, "  %-10s %s (%s)\n",
+			strings.ReplaceAll(l.res.Status, "_", " "), l.url, l.res.String()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkExternalLinks uses ec to check absolute http and https URLs in the HTML files at paths
+// within out that don't start with baseURL. Results are cached in siteDir.
+func checkExternalLinks(ctx context.Context, ec *externalChecker, siteDir, out, baseURL string,
+	paths []string) (*externalReport, error) {
+	pages := make(map[string][]string) // out-relative page paths keyed by URL
+	for _, p := range paths {
+		root, err := parseHTMLFile(p)
+		if err != nil {
+			return nil, err
+		}
+		rel := p[len(out)+1:]
+		seen := make(map[string]struct{})
+		forEachLink(root, func(n *html.Node, link string) {
+			if (!strings.HasPrefix(link, "http://") && !strings.HasPrefix(link, "https://")) ||
+				(baseURL != "" && strings.HasPrefix(link, baseURL)) {
+				return
+			}
+			// Fragments aren't sent to servers.
+			if i := strings.IndexByte(link, '#'); i != -1 {
+				link = link[:i]
+			}
+			if _, ok := seen[link]; !ok {
+				pages[link] = append(pages[link], rel)
+				seen[link] = struct{}{}
+			}
+		})
+	}
+	urls := make([]string, 0, len(pages))
+	for u := range pages {
+		urls = append(urls, u)
+	}
+	sort.Strings(urls)
+
+	cache, err := loadExternalCache(siteDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed loading cache: %v", err)
+	}
+	results := ec.checkAll(ctx, urls, cache)
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	// Drop expired results for links that are no longer present.
+	for u, res := range cache {
+		if _, ok := results[u]; !ok && ec.now().Sub(res.Checked) >= ec.ttl {
+			delete(cache, u)
+		}
+	}
+	if err := saveExternalCache(siteDir, cache); err != nil {
+		return nil, fmt.Errorf("failed saving cache: %v", err)
+	}
+
+	report := externalReport{checked: len(urls)}
+	for _, u := range urls {
+		if res := results[u]; res.Status != linkOK {
+			for _, p := range pages[u] {
+				report.bad = append(report.bad, externalLink{p, u, res})
+			}
+		}
+	}
+	sort.SliceStable(report.bad, func(i, j int) bool { return report.bad[i].page < report.bad[j].page })
+	return &report, nil
+}
+
+// loadExternalCache loads cached external link results keyed by URL from siteDir.
+// An empty map is returned if the cache doesn't exist or is corrupt.
+func loadExternalCache(siteDir string) (map[string]linkResult, error) {
+	cache := make(map[string]linkResult)
+	b, err := ioutil.ReadFile(filepath.Join(siteDir, cacheSubdir, externalCacheFile))
+	if os.IsNotExist(err) {
+		return cache, nil
+	} else if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(b, &cache); err != nil {
+		logf("Ignoring bad external link cache: %v\n", err)
+		return make(map[string]linkResult), nil
+	}
+	return cache, nil
+}
+
+// saveExternalCache writes cache to siteDir.
+func saveExternalCache(siteDir string, cache map[string]linkResult) error {
+	b, err := json.MarshalIndent(cache, "", "  ")
+	if err != nil {
+		return err
+	}
+	dir := filepath.Join(siteDir, cacheSubdir)
+	if err := os.MkdirAll(dir, dirMode); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filepath.Join(dir, externalCacheFile), append(b, '\n'), fileMode)
+}
@@ -0,0 +1,150 @@
+// Copyright 2023 Daniel Erat.
+// All rights reserved.
+
+package build
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestCheckExternalLinks(t *testing.T) {
+	var mu sync.Mutex
+	reqs := make(map[string]int) // "METHOD path" -> count
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		reqs[r.Method+" "+r.URL.Path]++
+		mu.Unlock()
+		switch r.URL.Path {
+		case "/ok":
+		case "/no-head":
+			if r.Method == http.MethodHead {
+				w.WriteHeader(http.StatusMethodNotAllowed)
+			}
+		case "/dead":
+			http.NotFound(w, r)
+		case "/redirect":
+			http.Redirect(w, r, "/ok", http.StatusMovedPermanently)
+		case "/slow":
+			time.Sleep(time.Second)
+		case "/unavailable":
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer srv.Close()
+
+	siteDir, err := ioutil.TempDir("", "external_test.")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(siteDir)
+	out := filepath.Join(siteDir, "out")
+	if err := os.MkdirAll(out, 0755); err != nil {
+		t.Fatal(err)
+	}
+	write := func(fn, body string) string {
+		p := filepath.Join(out, fn)
+		if err := ioutil.WriteFile(p, []byte("<html><body>"+body+"</body></html>"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return p
+	}
+	u := srv.URL
+	paths := []string{
+		write("a.html", fmt.Sprintf(`<a href="%s/ok">OK</a><a href="%s/dead#frag">Dead</a>`+
+			`<a href="%s/redirect">Redirect</a><a href="https://www.example.org/internal.html">Internal</a>`, u, u, u)),
+		write("b.html", fmt.Sprintf(`<a href="%s/no-head">No HEAD</a><img src="%s/slow" alt="Slow">`+
+			`<a href="%s/dead">Dead again</a><a href="%s/unavailable">Unavailable</a>`, u, u, u, u)),
+	}
+
+	client := srv.Client()
+	client.Timeout = 200 * time.Millisecond
+	ec := newExternalChecker(client, time.Hour)
+	ec.hostDelay = time.Millisecond
+	check := func() *externalReport {
+		report, err := checkExternalLinks(context.Background(), ec, siteDir, out,
+			"https://www.example.org/", paths)
+		if err != nil {
+			t.Fatal("checkExternalLinks failed:", err)
+		}
+		return report
+	}
+
+	report := check()
+	if report.checked != 6 {
+		t.Errorf("Checked %d URL(s); want 6", report.checked)
+	}
+	type badLink struct{ page, url, status string }
+	var got []badLink
+	for _, l := range report.bad {
+		got = append(got, badLink{l.page, l.url, l.res.Status})
+	}
+	want := []badLink{
+		{"a.html", u + "/dead", linkDead},
+		{"a.html", u + "/redirect", linkRedirected},
+		{"b.html", u + "/dead", linkDead},
+		{"b.html", u + "/slow", linkTimedOut},
+		{"b.html", u + "/unavailable", linkDead},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("checkExternalLinks reported %v; want %v", got, want)
+	}
+
+	var b strings.Builder
+	if err := report.write(&b); err != nil {
+		t.Fatal("write failed:", err)
+	}
+	for _, s := range []string{
+		"Checked 6 external link(s): 2 dead, 1 redirected, 1 timed out\n",
+		"a.html:\n  dead       " + u + "/dead (404 Not Found)\n",
+		"  redirected " + u + "/redirect (301 -> " + u + "/ok)\n",
+		"b.html:\n",
+		"  timed out  " + u + "/slow (",
+	} {
+		if !strings.Contains(b.String(), s) {
+			t.Errorf("Report doesn't contain %q:\n%s", s, b.String())
+		}
+	}
+
+	mu.Lock()
+	if want := map[string]int{
+		"HEAD /ok":          1,
+		"HEAD /no-head":     1,
+		"GET /no-head":      1, // HEAD failed, so GET should've been used
+		"HEAD /dead":        1,
+		"GET /dead":         1,
+		"HEAD /redirect":    1,
+		"HEAD /slow":        1,
+		"HEAD /unavailable": 1,
+		"GET /unavailable":  1,
+	}; !reflect.DeepEqual(reqs, want) {
+		t.Errorf("Server received %v; want %v", reqs, want)
+	}
+	reqs = make(map[string]int)
+	mu.Unlock()
+
+	// Definitive results should be cached, so only the possibly-transient failures should be
+	// requested the second time.
+	if report := check(); len(report.bad) != len(want) {
+		t.Errorf("Second check reported %d bad link(s); want %d", len(report.bad), len(want))
+	}
+	mu.Lock()
+	if want := map[string]int{
+		"HEAD /slow":        1,
+		"HEAD /unavailable": 1,
+		"GET /unavailable":  1,
+	}; !reflect.DeepEqual(reqs, want) {
+		t.Errorf("Server received %v on second check; want %v", reqs, want)
+	}
+	mu.Unlock()
+}
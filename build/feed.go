@@ -4,7 +4,12 @@
 package build
 
 import (
+	"fmt"
+	"io"
+	"net/url"
 	"os"
+	"path/filepath"
+	"sort"
 	"time"
 
 	"github.com/derat/intransigence/render"
@@ -12,50 +17,159 @@ import (
 	"github.com/gorilla/feeds"
 )
 
-const maxFeedItems = 10
+// writeFeeds writes feeds listing pages from feedInfos to out. An Atom feed is always written,
+// and RSS and JSON feeds are also written if requested by si. The written files' paths relative
+// to out are returned. feedInfos should be sorted newest-to-oldest (see render.PageFeedInfo.Listed).
+// The feeds' modification times are set to the time at which the newest entry was updated so
+// they don't change across rebuilds.
+func writeFeeds(out string, si *render.SiteInfo, feedInfos []render.PageFeedInfo) ([]string, error) {
+	feed := newFeed(si, si.FeedTitle, si.BaseURL, si.FeedDesc, feedInfos)
 
-// writeFeed writes an Atom feed listing pages from feedInfos to path p.
-// feedInfos should be sorted newest-to-oldest.
-func writeFeed(p string, si *render.SiteInfo, feedInfos []render.PageFeedInfo) error {
+	type feedFile struct {
+		name  string
+		write func(io.Writer) error
+	}
+	files := []feedFile{{render.FeedFile, feed.WriteAtom}}
+	if si.FeedRSS {
+		// RSS readers treat <guid> as a permalink by default, so use the page's URL instead.
+		rss := *feed
+		rss.Items = make([]*feeds.Item, len(feed.Items))
+		for i, it := range feed.Items {
+			ri := *it
+			ri.Id = it.Link.Href
+			rss.Items[i] = &ri
+		}
+		files = append(files, feedFile{render.RSSFeedFile, rss.WriteRss})
+	}
+	if si.FeedJSON {
+		files = append(files, feedFile{render.JSONFeedFile, feed.WriteJSON})
+	}
+
+	var written []string
+	for _, ff := range files {
+		if err := writeFeedFile(filepath.Join(out, ff.name), ff.write, feed.Updated); err != nil {
+			return nil, fmt.Errorf("%v: %v", ff.name, err)
+		}
+		written = append(written, ff.name)
+	}
+	return written, nil
+}
+
+// writeTagFeeds writes an Atom feed to out for each tag in tagged (see collectTags),
+// listing the pages from feedInfos that have the tag. The written files' paths relative
+// to out are returned. feedInfos should be sorted as described for writeFeeds.
+func writeTagFeeds(out string, si *render.SiteInfo, tagged map[string][]*render.PageSummary,
+	feedInfos []render.PageFeedInfo) ([]string, error) {
+	var written []string
+	for tag := range tagged {
+		var tfis []render.PageFeedInfo
+		for _, fi := range feedInfos {
+			for _, t := range fi.Tags {
+				if t == tag {
+					tfis = append(tfis, fi)
+					break
+				}
+			}
+		}
+		pfn, err := render.TagPageFile(tag)
+		if err != nil {
+			return nil, err
+		}
+		link, err := si.AbsURL(pfn)
+		if err != nil {
+			return nil, err
+		}
+		ffn, err := render.TagFeedFile(tag)
+		if err != nil {
+			return nil, err
+		}
+		feed := newFeed(si, fmt.Sprintf("%s: %s", si.FeedTitle, tag), link,
+			fmt.Sprintf("Pages tagged %q", tag), tfis)
+		if err := writeFeedFile(filepath.Join(out, ffn), feed.WriteAtom, feed.Updated); err != nil {
+			return nil, fmt.Errorf("%v: %v", ffn, err)
+		}
+		written = append(written, ffn)
+	}
+	sort.Strings(written)
+	return written, nil
+}
+
+// newFeed returns a feed with the supplied title, link, and description
+// that lists up to si.FeedItems pages from feedInfos.
+func newFeed(si *render.SiteInfo, title, link, desc string, feedInfos []render.PageFeedInfo) *feeds.Feed {
 	feed := &feeds.Feed{
-		Title:       si.FeedTitle,
-		Link:        &feeds.Link{Href: si.BaseURL},
-		Description: si.FeedDesc,
+		Title:       title,
+		Link:        &feeds.Link{Href: link},
+		Description: desc,
 		Author:      &feeds.Author{Name: si.AuthorName, Email: si.AuthorEmail},
 	}
 
-	for i := 0; i < len(feedInfos) && i < maxFeedItems; i++ {
+	for i := 0; i < len(feedInfos) && i < si.FeedItems; i++ {
 		fi := &feedInfos[i]
-		feed.Add(&feeds.Item{
+		desc := fi.Desc
+		if fi.UpdateNote != "" {
+			desc = fmt.Sprintf("%s (Updated: %s)", desc, fi.UpdateNote)
+		}
+		it := &feeds.Item{
 			Title:       fi.Title,
 			Link:        &feeds.Link{Href: fi.AbsURL},
-			Description: fi.Desc,
+			Id:          feedItemID(fi),
+			Description: desc,
+			Content:     fi.Content,
 			Author:      &feeds.Author{Name: si.AuthorName, Email: si.AuthorEmail},
 			Created:     fi.Created.UTC(),
-		})
+		}
+		if up := fi.Updated(); up.After(fi.Created) {
+			it.Updated = up.UTC()
+		}
+		feed.Add(it)
 	}
 
 	// RFC 4287 says that the atom:updated field should indicate "the most recent instant in
 	// time when an entry or feed was modified in a way the publisher considers significant",
-	// but I don't have any good way of diffing against the currently-published feed to see if
-	// anything has changed.
-	if len(feed.Items) > 0 {
-		feed.Created = feed.Items[0].Created
-	} else {
-		feed.Created = time.Now().UTC()
+	// so use the most-recent creation or modification time of the listed pages. This keeps
+	// the feed unchanged across rebuilds unless a listed page's dates change. Use a fixed
+	// time for empty feeds for the same reason. Items are ordered by when they were listed,
+	// so the feed's creation time is the latest creation time of any item.
+	feed.Created = time.Unix(0, 0).UTC()
+	for i, it := range feed.Items {
+		if i == 0 || it.Created.After(feed.Created) {
+			feed.Created = it.Created
+		}
+		for _, t := range []time.Time{it.Created, it.Updated} {
+			if t.After(feed.Updated) {
+				feed.Updated = t
+			}
+		}
 	}
-
-	atom, err := feed.ToAtom()
-	if err != nil {
-		return err
+	if feed.Updated.IsZero() {
+		feed.Updated = feed.Created
 	}
+	return feed
+}
+
+// writeFeedFile creates a file at p, passes it to write, and sets its modification time to mtime.
+func writeFeedFile(p string, write func(io.Writer) error, mtime time.Time) error {
 	f, err := os.Create(p)
 	if err != nil {
 		return err
 	}
-	if _, err := f.WriteString(atom); err != nil {
+	if err := write(f); err != nil {
 		f.Close()
 		return err
 	}
-	return f.Close()
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Chtimes(p, mtime, mtime)
+}
+
+// feedItemID returns the ID to use for fi in Atom and JSON feeds.
+// This matches the tag URI that gorilla/feeds generates for Atom entries without IDs.
+func feedItemID(fi *render.PageFeedInfo) string {
+	host, path := fi.AbsURL, "/invalid.html"
+	if u, err := url.Parse(fi.AbsURL); err == nil {
+		host, path = u.Host, u.Path
+	}
+	return fmt.Sprintf("tag:%s,%s:%s", host, fi.Created.UTC().Format("2006-01-02"), path)
 }
@@ -0,0 +1,58 @@
+// Copyright 2023 Daniel Erat.
+// All rights reserved.
+
+package build
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/derat/intransigence/render"
+)
+
+// fingerprintFiles renames static files and generated images in the output dir out that are
+// matched by si.FingerprintStatic to include hashes of their contents, matching the paths
+// that were used in pages and iframes. sources is updated to use the new paths. Identical
+// fingerprinted copies left over from earlier builds into out are reused.
+func fingerprintFiles(out string, si *render.SiteInfo, sources fileSources) error {
+	var rels []string
+	for rel, src := range sources {
+		if (src.typ == sourceStatic || src.typ == sourceGenImage) && si.ShouldFingerprint(rel) {
+			rels = append(rels, rel)
+		}
+	}
+	sort.Strings(rels)
+
+	for _, rel := range rels {
+		p := filepath.Join(out, rel)
+		b, err := ioutil.ReadFile(p)
+		if err != nil {
+			return err
+		}
+		frel := render.FingerprintPath(rel, b)
+		fp := filepath.Join(out, frel)
+		if _, ok := sources[frel]; ok {
+			return fmt.Errorf("fingerprinted %v conflicts with output file %v", rel, frel)
+		}
+		// The fingerprinted file may be left over from an earlier build into the same dir.
+		if eb, err := ioutil.ReadFile(fp); err == nil {
+			if !bytes.Equal(eb, b) {
+				return fmt.Errorf("fingerprinted %v conflicts with existing output file %v", rel, frel)
+			}
+			if err := os.Remove(p); err != nil {
+				return err
+			}
+		} else if !os.IsNotExist(err) {
+			return err
+		} else if err := os.Rename(p, fp); err != nil {
+			return err
+		}
+		sources[frel] = sources[rel]
+		delete(sources, rel)
+	}
+	return nil
+}
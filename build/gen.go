@@ -6,18 +6,26 @@ package build
 import (
 	"bytes"
 	"fmt"
+	"image"
+	"image/jpeg"
+	"image/png"
 	"io"
 	"io/ioutil"
+	"math"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"regexp"
 	"sort"
+	"strings"
 	"time"
 
+	"golang.org/x/image/draw"
 	"golang.org/x/net/html"
 
 	"github.com/derat/htmlpretty"
 	"github.com/derat/intransigence/render"
+	"github.com/derat/intransigence/scss"
 )
 
 const (
@@ -26,75 +34,136 @@ const (
 
 	indent    = "  "
 	wrapWidth = 120
+
+	jpegQuality = 90 // quality for scaled JPEG images
 )
 
-// generatePages renders non-AMP and AMP versions of all normal pages and writes them
-// to the appropriate subdirectory under out. The generated files' paths are returned.
-// The returned feed info structs are sorted newest-to-oldest.
-func generatePages(si *render.SiteInfo, out string, pretty bool,
-	exeTime time.Time) ([]string, []render.PageFeedInfo, error) {
+// generatePages renders non-AMP and AMP versions of all normal pages (including additional
+// pages of paginated pages) and writes them to the appropriate subdirectory under out.
+// The generated files' paths are returned.
+// The returned feed info structs are sorted newest-to-oldest (see render.PageFeedInfo.Listed),
+// and the returned page metadata is keyed by generated files' paths relative to out.
+// Up to jobs pages are rendered in parallel. If cache is non-nil, it is used to
+// reuse previously-generated pages whose inputs haven't changed.
+func generatePages(si *render.SiteInfo, out string, pretty bool, exeTime time.Time, jobs int,
+	cache *buildCache) ([]string, []render.PageFeedInfo, map[string]*render.PageMeta, error) {
 	ps, err := filepath.Glob(filepath.Join(si.PageDir(), "*.md"))
 	if err != nil {
-		return nil, nil, fmt.Errorf("failed to enumerate pages: %v", err)
+		return nil, nil, nil, fmt.Errorf("failed to enumerate pages: %v", err)
 	}
 
-	defer clearStatus()
-	var outPaths []string
-	var feedInfos []render.PageFeedInfo
+	// Read all of the pages' page blocks first so they can be listed by "pagelist" blocks.
+	mds := make([][]byte, len(ps))
+	summaries := make([]*render.PageSummary, len(ps))
 	for i, p := range ps {
-		statusf("Generating pages: [%d/%d]", i, len(ps))
-		md, err := ioutil.ReadFile(p)
-		if err != nil {
-			return nil, nil, err
+		if mds[i], err = ioutil.ReadFile(p); err != nil {
+			return nil, nil, nil, err
 		}
+		if summaries[i], err = render.ReadPageSummary(*si, pageBase(p), mds[i]); err != nil {
+			return nil, nil, nil, fmt.Errorf("failed to read %s: %v", filepath.Base(p), err)
+		}
+	}
+	psi := si.WithPages(summaries)
+
+	// Results are saved by index so the returned slices are ordered consistently.
+	pageOutPaths := make([][]string, len(ps))
+	pageMetas := make([][]*render.PageMeta, len(ps)) // parallel to pageOutPaths
+	pageFeedInfos := make([]*render.PageFeedInfo, len(ps))
+
+	if err := runTasks(jobs, len(ps), "Generating pages", func(i int) error {
+		p, md := ps[i], mds[i]
 		pi, err := os.Stat(p)
 		if err != nil {
-			return nil, nil, err
+			return err
 		}
+		base := pageBase(p)
 
-		base := filepath.Base(p)
-		base = base[:len(base)-len(".md")]
-
-		build := func(dest string, amp bool) error {
-			outPaths = append(outPaths, dest)
-			b, fi, err := render.Page(*si, base, md, amp)
+		build := func(name string, amp bool, num int) (*render.PageMeta, error) {
+			dest := filepath.Join(out, name)
+			pageOutPaths[i] = append(pageOutPaths[i], dest)
+			hit, meta, err := cache.reuse(name, dest)
 			if err != nil {
-				return fmt.Errorf("failed to render %s: %v", filepath.Base(dest), err)
-			}
-			if fi != nil && !amp {
-				feedInfos = append(feedInfos, *fi)
+				return nil, err
 			}
-			if pretty {
-				if b, err = prettyPrintDoc(bytes.NewReader(b)); err != nil {
-					return fmt.Errorf("failed to pretty-print %s: %v", filepath.Base(dest), err)
+			if !hit {
+				var deps render.Deps
+				var b []byte
+				if b, meta, err = render.PageNum(psi.WithDeps(&deps), base, md, amp, num); err != nil {
+					return nil, fmt.Errorf("failed to render %s: %v", name, err)
+				}
+				if pretty {
+					if b, err = prettyPrintDoc(bytes.NewReader(b)); err != nil {
+						return nil, fmt.Errorf("failed to pretty-print %s: %v", name, err)
+					}
+				}
+				if err := ioutil.WriteFile(dest, b, fileMode); err != nil {
+					return nil, err
+				}
+				if err := cache.update(name, dest, append(deps.Paths(), p), meta); err != nil {
+					return nil, err
 				}
 			}
-			if err := ioutil.WriteFile(dest, b, fileMode); err != nil {
-				return err
+			pageMetas[i] = append(pageMetas[i], meta)
+			if meta != nil && meta.Feed != nil && !amp {
+				pageFeedInfos[i] = meta.Feed
 			}
 			// Copy the Markdown file's mtime and atime.
-			return os.Chtimes(dest, maxTime(getAtime(pi), exeTime), maxTime(pi.ModTime(), exeTime))
+			return meta, os.Chtimes(dest, maxTime(getAtime(pi), exeTime), maxTime(pi.ModTime(), exeTime))
 		}
 
-		if err := build(filepath.Join(out, base+render.HTMLExt), false /* amp */); err != nil {
-			return nil, nil, err
+		for _, name := range []string{base + render.HTMLExt, base + render.AMPExt} {
+			amp := strings.HasSuffix(name, render.AMPExt)
+			meta, err := build(name, amp, 1)
+			if err != nil {
+				return err
+			}
+			// Also write additional pages if the page is paginated.
+			for num := 2; meta != nil && num <= meta.PageCount; num++ {
+				if _, err := build(render.PageNumFile(name, num), amp, num); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	}); err != nil {
+		return nil, nil, nil, err
+	}
+
+	var outPaths []string
+	var feedInfos []render.PageFeedInfo
+	metas := make(map[string]*render.PageMeta)
+	for i := range ps {
+		outPaths = append(outPaths, pageOutPaths[i]...)
+		for j, p := range pageOutPaths[i] {
+			rel := p[len(out)+1:]
+			if _, ok := metas[rel]; ok {
+				return nil, nil, nil, fmt.Errorf("multiple pages written to %v", rel)
+			}
+			metas[rel] = pageMetas[i][j]
 		}
-		if err := build(filepath.Join(out, base+render.AMPExt), true /* amp */); err != nil {
-			return nil, nil, err
+		if fi := pageFeedInfos[i]; fi != nil {
+			feedInfos = append(feedInfos, *fi)
 		}
 	}
 
-	sort.Slice(feedInfos, func(i, j int) bool {
-		return feedInfos[i].Created.After(feedInfos[j].Created)
+	// Use a stable sort so pages with the same date stay in filename order.
+	sort.SliceStable(feedInfos, func(i, j int) bool {
+		return feedInfos[i].Listed().After(feedInfos[j].Listed())
 	})
 
-	return outPaths, feedInfos, nil
+	return outPaths, feedInfos, metas, nil
+}
+
+// pageBase returns the base name of the Markdown page file at p, e.g. "foo" for "pages/foo.md".
+func pageBase(p string) string {
+	return strings.TrimSuffix(filepath.Base(p), ".md")
 }
 
 // generateIframes renders all iframe pages and writes them to the appropriate subdirectory under out.
-// The generated files' paths are returned.
+// The generated files' paths are returned. Up to jobs iframes are rendered in parallel.
+// If cache is non-nil, it is used to reuse previously-generated iframes whose inputs haven't changed.
 func generateIframes(si *render.SiteInfo, out string, pretty bool,
-	exeTime time.Time) ([]string, error) {
+	exeTime time.Time, jobs int, cache *buildCache) ([]string, error) {
 	ps, err := filepath.Glob(filepath.Join(si.IframeDir(), "*.yaml"))
 	if err != nil {
 		return nil, fmt.Errorf("failed to enumerate iframe data: %v", err)
@@ -102,38 +171,48 @@ func generateIframes(si *render.SiteInfo, out string, pretty bool,
 	if err := os.MkdirAll(filepath.Join(out, render.IframeOutDir), dirMode); err != nil {
 		return nil, err
 	}
-	var outPaths []string
-	for _, p := range ps {
+	outPaths := make([]string, len(ps))
+	if err := runTasks(jobs, len(ps), "Generating iframes", func(i int) error {
+		p := ps[i]
 		data, err := ioutil.ReadFile(p)
 		if err != nil {
-			return nil, err
+			return err
 		}
 		fi, err := os.Stat(p)
 		if err != nil {
-			return nil, err
+			return err
 		}
 
 		base := filepath.Base(p)
 		base = base[:len(base)-len(".yaml")]
-		dest := filepath.Join(out, render.IframeOutDir, base+render.HTMLExt)
-		outPaths = append(outPaths, dest)
+		name := filepath.Join(render.IframeOutDir, base+render.HTMLExt)
+		dest := filepath.Join(out, name)
+		outPaths[i] = dest
 
-		b, err := render.Iframe(*si, data)
-		if err != nil {
-			return nil, fmt.Errorf("failed to render iframe %q: %v", base, err)
-		}
-		if pretty {
-			if b, err = prettyPrintDoc(bytes.NewReader(b)); err != nil {
-				return nil, fmt.Errorf("failed to pretty-print iframe %s: %v", filepath.Base(dest), err)
+		if hit, _, err := cache.reuse(name, dest); err != nil {
+			return err
+		} else if !hit {
+			var deps render.Deps
+			b, err := render.Iframe(si.WithDeps(&deps), data)
+			if err != nil {
+				return fmt.Errorf("failed to render iframe %q: %v", base, err)
+			}
+			if pretty {
+				if b, err = prettyPrintDoc(bytes.NewReader(b)); err != nil {
+					return fmt.Errorf("failed to pretty-print iframe %s: %v", filepath.Base(dest), err)
+				}
+			}
+			if err := ioutil.WriteFile(dest, b, fileMode); err != nil {
+				return err
+			}
+			if err := cache.update(name, dest, append(deps.Paths(), p), nil); err != nil {
+				return err
 			}
-		}
-		if err := ioutil.WriteFile(dest, b, fileMode); err != nil {
-			return nil, err
 		}
 		// Copy the data file's mtime and atime.
-		if err := os.Chtimes(dest, maxTime(getAtime(fi), exeTime), maxTime(fi.ModTime(), exeTime)); err != nil {
-			return nil, err
-		}
+		return os.Chtimes(dest, maxTime(getAtime(fi), exeTime), maxTime(fi.ModTime(), exeTime))
+	}); err != nil {
+		return nil, err
 	}
 	return outPaths, nil
 }
@@ -152,108 +231,320 @@ func prettyPrintDoc(r io.Reader) ([]byte, error) {
 	return b.Bytes(), nil
 }
 
-// generateCSS runs sassc to generate minified CSS of all .scss files in src.
+// generateCSS generates minified CSS of all .scss files in src (except partials like "_foo.scss").
 // The files are written under dst with the .scss extension changed to .css.
-func generateCSS(src, dst string) error {
+// If sassc is true, the sassc executable is used instead of the built-in compiler.
+// Up to jobs files are processed in parallel.
+func generateCSS(src, dst string, sassc bool, jobs int) error {
 	ps, err := filepath.Glob(filepath.Join(src, "*.scss"))
 	if err != nil {
 		return err
 	}
+	var todo []string
+	for _, p := range ps {
+		if !strings.HasPrefix(filepath.Base(p), "_") {
+			todo = append(todo, p)
+		}
+	}
 	if err := os.MkdirAll(dst, 0755); err != nil {
 		return err
 	}
 
-	defer clearStatus()
-	for i, p := range ps {
-		statusf("Generating CSS: [%d/%d]", i, len(ps))
+	return runTasks(jobs, len(todo), "Generating CSS", func(i int) error {
+		p := todo[i]
 		base := filepath.Base(p)
 		dp := filepath.Join(dst, base[:len(base)-4]+"css")
-		if err := exec.Command("sassc", "--style", "compressed", p, dp).Run(); err != nil {
-			return fmt.Errorf("failed running sassc on %v: %v", p, err)
+		if sassc {
+			if err := exec.Command("sassc", "--style", "compressed", p, dp).Run(); err != nil {
+				return fmt.Errorf("failed running sassc on %v: %v", p, err)
+			}
+			return copyTimes(p, dp)
 		}
-		if err := copyTimes(p, dp); err != nil {
+
+		css, files, err := scss.CompileFile(p)
+		if err != nil {
+			return fmt.Errorf("failed compiling SCSS: %v", err)
+		}
+		if err := ioutil.WriteFile(dp, []byte(css), fileMode); err != nil {
 			return err
 		}
-	}
-	return nil
+		// Use the times from the most-recently-modified file so imported files are accounted for.
+		newest, newestTime := p, time.Time{}
+		for _, f := range files {
+			fi, err := os.Stat(f)
+			if err != nil {
+				return err
+			}
+			if fi.ModTime().After(newestTime) {
+				newest, newestTime = f, fi.ModTime()
+			}
+		}
+		return copyTimes(newest, dp)
+	})
 }
 
-// generateWebP runs cwebp to generate WebP versions of all GIF, JPEG, and PNG images under src.
-// The files are written under dst and are regenerated if stale.
-func generateWebP(src, dst string) error {
-	// Get mtimes for orig images and WebP files. Keys are paths relative to src and dst.
-	imgTimes := make(map[string]time.Time)
-	if err := filepath.Walk(src, func(p string, fi os.FileInfo, err error) error {
+// generateResizedImages writes scaled versions of static images requested by "image"
+// code blocks in pages under si.StaticGenDir. Scaled images are regenerated if their
+// mtimes don't match the original images' mtimes, and previously-scaled versions of
+// static images that are no longer requested are deleted. Up to jobs images are processed in parallel.
+func generateResizedImages(si *render.SiteInfo, jobs int) error {
+	ps, err := filepath.Glob(filepath.Join(si.PageDir(), "*.md"))
+	if err != nil {
+		return fmt.Errorf("failed to enumerate pages: %v", err)
+	}
+	// Keys are original image paths and values are the requested widths.
+	reqs := make(map[string]map[int]struct{})
+	for _, p := range ps {
+		md, err := ioutil.ReadFile(p)
 		if err != nil {
 			return err
 		}
-		if fi.Mode()&os.ModeType != 0 {
-			return nil
+		rs, err := render.PageImageResizes(md)
+		if err != nil {
+			return fmt.Errorf("%v: %v", filepath.Base(p), err)
+		}
+		for _, r := range rs {
+			if reqs[r.Path] == nil {
+				reqs[r.Path] = make(map[int]struct{})
+			}
+			for _, w := range r.Widths {
+				reqs[r.Path][w] = struct{}{}
+			}
 		}
-		switch filepath.Ext(p) {
-		case ".gif", ".jpg", ".jpeg", ".png":
-			imgTimes[p[len(src)+1:]] = fi.ModTime()
+	}
+
+	src, dst := si.StaticDir(), si.StaticGenDir()
+	type job struct {
+		ip     string // orig image path
+		widths []int  // stale widths
+	}
+	var todo []job
+	want := make(map[string]struct{}) // scaled image paths relative to dst
+	for ip, ws := range reqs {
+		fi, err := os.Stat(filepath.Join(src, ip))
+		if err != nil {
+			return err
+		}
+		j := job{ip: ip}
+		for w := range ws {
+			rp := render.ResizedImagePath(ip, w)
+			want[rp] = struct{}{}
+			if ri, err := os.Stat(filepath.Join(dst, rp)); err != nil || !ri.ModTime().Equal(fi.ModTime()) {
+				j.widths = append(j.widths, w)
+			}
+		}
+		if len(j.widths) > 0 {
+			sort.Ints(j.widths)
+			todo = append(todo, j)
+		}
+	}
+	// Process images in a consistent order so errors are reported deterministically.
+	sort.Slice(todo, func(i, j int) bool { return todo[i].ip < todo[j].ip })
+
+	if err := runTasks(jobs, len(todo), "Resizing images", func(i int) error {
+		ip := todo[i].ip
+		for _, w := range todo[i].widths {
+			op := filepath.Join(dst, render.ResizedImagePath(ip, w))
+			if err := os.MkdirAll(filepath.Dir(op), 0755); err != nil {
+				return err
+			}
+			if err := resizeImage(filepath.Join(src, ip), op, w); err != nil {
+				return fmt.Errorf("failed resizing %v to %d: %v", ip, w, err)
+			}
+			if err := copyTimes(filepath.Join(src, ip), op); err != nil {
+				return err
+			}
 		}
 		return nil
 	}); err != nil {
 		return err
 	}
 
+	// Delete scaled images that are no longer requested. Only files that look like
+	// scaled versions of existing static images are deleted so that other files
+	// under dst are left alone.
+	return filepath.Walk(dst, func(p string, fi os.FileInfo, err error) error {
+		if os.IsNotExist(err) && p == dst {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		if fi.Mode()&os.ModeType != 0 {
+			return nil
+		}
+		rp := p[len(dst)+1:]
+		if _, ok := want[rp]; ok {
+			return nil
+		}
+		ms := resizedImageRegexp.FindStringSubmatch(rp)
+		if ms == nil {
+			return nil
+		}
+		if _, err := os.Stat(filepath.Join(src, ms[1]+ms[2])); os.IsNotExist(err) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		return os.Remove(p)
+	})
+}
+
+// resizedImageRegexp matches paths produced by render.ResizedImagePath for JPEG and PNG
+// images. The first submatch contains the original path without its extension and the
+// second submatch contains the extension.
+var resizedImageRegexp = regexp.MustCompile(`^(.+)-\d+(\.(?:jpe?g|png))$`)
+
+// resizeImage scales the JPEG or PNG image at ip to width w and writes it to op.
+func resizeImage(ip, op string, w int) error {
+	f, err := os.Open(ip)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	img, _, err := image.Decode(f)
+	if err != nil {
+		return err
+	}
+	sb := img.Bounds()
+	if w > sb.Dx() {
+		return fmt.Errorf("original image is only %d pixels wide", sb.Dx())
+	}
+	h := int(math.Round(float64(sb.Dy()) * float64(w) / float64(sb.Dx())))
+	di := image.NewNRGBA(image.Rect(0, 0, w, h))
+	draw.CatmullRom.Scale(di, di.Bounds(), img, sb, draw.Src, nil)
+
+	var b bytes.Buffer
+	switch filepath.Ext(op) {
+	case ".jpg", ".jpeg":
+		err = jpeg.Encode(&b, di, &jpeg.Options{Quality: jpegQuality})
+	case ".png":
+		err = png.Encode(&b, di)
+	default:
+		err = fmt.Errorf("unsupported extension %q", filepath.Ext(op))
+	}
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(op, b.Bytes(), fileMode)
+}
+
+// generateWebP runs cwebp to generate WebP versions of all GIF, JPEG, and PNG images under srcs.
+// The files are written under dst and are regenerated if stale.
+// Up to jobs images are converted in parallel.
+func generateWebP(srcs []string, dst string, jobs int) error {
+	return convertImages(srcs, dst, []string{".gif", ".jpg", ".jpeg", ".png"}, render.WebPExt,
+		"Generating WebP images", jobs, func(ip, wp string) error {
+			switch filepath.Ext(ip) {
+			case ".gif":
+				if err := exec.Command("gif2webp", ip, "-o", wp).Run(); err != nil {
+					return fmt.Errorf("failed running gif2webp on %v: %v", ip, err)
+				}
+			default:
+				// https://chromium.googlesource.com/webm/libwebp/+/refs/heads/0.4.1/src/enc/config.c#52
+				preset := "text"
+				if ext := filepath.Ext(ip); ext == ".jpg" || ext == ".jpeg" {
+					preset = "photo"
+				}
+				if err := exec.Command("cwebp", "-preset", preset, ip, "-o", wp).Run(); err != nil {
+					return fmt.Errorf("failed running cwebp on %v: %v", ip, err)
+				}
+			}
+			return nil
+		})
+}
+
+// generateAVIF runs avifenc to generate AVIF versions of all JPEG and PNG images under srcs.
+// The files are written under dst and are regenerated if stale.
+// Up to jobs images are converted in parallel.
+func generateAVIF(srcs []string, dst string, jobs int) error {
+	return convertImages(srcs, dst, []string{".jpg", ".jpeg", ".png"}, render.AVIFExt,
+		"Generating AVIF images", jobs, func(ip, ap string) error {
+			if err := exec.Command("avifenc", ip, ap).Run(); err != nil {
+				return fmt.Errorf("failed running avifenc on %v: %v", ip, err)
+			}
+			return nil
+		})
+}
+
+// convertImages calls conv to convert all images under srcs with extensions in srcExts
+// to files with extension dstExt under dst. Converted files are regenerated if stale,
+// and converted files corresponding to no-longer-present images are deleted.
+// desc is used in status messages, and up to jobs images are converted in parallel.
+func convertImages(srcs []string, dst string, srcExts []string, dstExt, desc string, jobs int,
+	conv func(ip, op string) error) error {
+	// Get mtimes for orig images and converted files.
+	// Keys are paths relative to srcs and dst, and values are full paths and mtimes.
+	type srcImg struct {
+		p  string
+		mt time.Time
+	}
+	imgs := make(map[string]srcImg)
+	for _, src := range srcs {
+		if err := filepath.Walk(src, func(p string, fi os.FileInfo, err error) error {
+			if os.IsNotExist(err) && p == src {
+				return nil
+			} else if err != nil {
+				return err
+			}
+			if fi.Mode()&os.ModeType != 0 {
+				return nil
+			}
+			ext := filepath.Ext(p)
+			for _, se := range srcExts {
+				if ext == se {
+					imgs[p[len(src)+1:]] = srcImg{p, fi.ModTime()}
+					break
+				}
+			}
+			return nil
+		}); err != nil {
+			return err
+		}
+	}
+
 	if err := os.MkdirAll(dst, 0755); err != nil {
 		return err
 	}
-	webPTimes := make(map[string]time.Time)
+	outTimes := make(map[string]time.Time)
 	if err := filepath.Walk(dst, func(p string, fi os.FileInfo, err error) error {
 		if err != nil {
 			return err
 		}
-		if fi.Mode()&os.ModeType == 0 && filepath.Ext(p) == render.WebPExt {
-			webPTimes[p[len(dst)+1:]] = fi.ModTime()
+		if fi.Mode()&os.ModeType == 0 && filepath.Ext(p) == dstExt {
+			outTimes[p[len(dst)+1:]] = fi.ModTime()
 		}
 		return nil
 	}); err != nil {
 		return err
 	}
 
-	todo := make(map[string]string) // orig image path -> WebP path
-	for ip, it := range imgTimes {
-		wp := ip[:len(ip)-len(filepath.Ext(ip))] + render.WebPExt
-		if wt, ok := webPTimes[wp]; !ok || wt.Before(it) {
-			todo[filepath.Join(src, ip)] = filepath.Join(dst, wp)
+	type job struct{ ip, op string } // orig image path and converted path
+	var todo []job
+	for ip, img := range imgs {
+		op := ip[:len(ip)-len(filepath.Ext(ip))] + dstExt
+		if ot, ok := outTimes[op]; !ok || ot.Before(img.mt) {
+			todo = append(todo, job{img.p, filepath.Join(dst, op)})
 		}
-		delete(webPTimes, wp)
+		delete(outTimes, op)
 	}
+	// Process images in a consistent order so errors are reported deterministically.
+	sort.Slice(todo, func(i, j int) bool { return todo[i].ip < todo[j].ip })
 
-	num := 0
-	defer clearStatus()
-	for ip, wp := range todo {
-		statusf("Generating WebP images: [%d/%d]", num, len(todo))
-		if err := os.MkdirAll(filepath.Dir(wp), 0755); err != nil {
+	if err := runTasks(jobs, len(todo), desc, func(i int) error {
+		ip, op := todo[i].ip, todo[i].op
+		if err := os.MkdirAll(filepath.Dir(op), 0755); err != nil {
 			return err
 		}
-		switch filepath.Ext(ip) {
-		case ".gif":
-			if err := exec.Command("gif2webp", ip, "-o", wp).Run(); err != nil {
-				return fmt.Errorf("failed running gif2webp on %v: %v", ip, err)
-			}
-		default:
-			// https://chromium.googlesource.com/webm/libwebp/+/refs/heads/0.4.1/src/enc/config.c#52
-			preset := "text"
-			if ext := filepath.Ext(ip); ext == ".jpg" || ext == ".jpeg" {
-				preset = "photo"
-			}
-			if err := exec.Command("cwebp", "-preset", preset, ip, "-o", wp).Run(); err != nil {
-				return fmt.Errorf("failed running cwebp on %v: %v", ip, err)
-			}
-		}
-		if err := copyTimes(ip, wp); err != nil {
+		if err := conv(ip, op); err != nil {
 			return err
 		}
-		num++
+		return copyTimes(ip, op)
+	}); err != nil {
+		return err
 	}
 
-	// Delete any WebP files corresponding to no-longer-present images.
-	for p := range webPTimes {
+	// Delete any converted files corresponding to no-longer-present images.
+	for p := range outTimes {
 		if err := os.Remove(filepath.Join(dst, p)); err != nil {
 			return err
 		}
@@ -0,0 +1,241 @@
+// Copyright 2023 Daniel Erat.
+// All rights reserved.
+
+package build
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+
+	"github.com/derat/validate"
+	"golang.org/x/net/html"
+)
+
+// structuralValidator is a streamValidator that performs basic structural checks on HTML
+// documents without using any external tools or services. It reports duplicate IDs, unclosed
+// elements, stray end tags, some invalid nesting, and duplicate or obsolete attributes.
+type structuralValidator struct{}
+
+func (v *structuralValidator) validateStream(ctx context.Context, r io.Reader) ([]validate.Issue, error) {
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	return checkHTMLStructure(b), nil
+}
+
+// voidElements lists elements that can't have content or end tags.
+var voidElements = map[string]bool{
+	"area": true, "base": true, "br": true, "col": true, "embed": true, "hr": true, "img": true,
+	"input": true, "link": true, "meta": true, "source": true, "track": true, "wbr": true,
+}
+
+// optionalEndElements lists elements whose end tags may be omitted.
+var optionalEndElements = map[string]bool{
+	"body": true, "colgroup": true, "dd": true, "dt": true, "head": true, "html": true, "li": true,
+	"optgroup": true, "option": true, "p": true, "rp": true, "rt": true, "tbody": true, "td": true,
+	"tfoot": true, "th": true, "thead": true, "tr": true,
+}
+
+// impliedEnds maps from elements to elements whose end tags are implied by their start tags.
+// For example, "<li>" implies "</li>" if an <li> element is open.
+var impliedEnds = map[string][]string{
+	"dd":       {"dd", "dt"},
+	"dt":       {"dd", "dt"},
+	"li":       {"li"},
+	"optgroup": {"optgroup", "option"},
+	"option":   {"option"},
+	"rp":       {"rp", "rt"},
+	"rt":       {"rp", "rt"},
+	"tbody":    {"tbody", "thead", "tr", "td", "th"},
+	"td":       {"td", "th"},
+	"tfoot":    {"tbody", "thead", "tr", "td", "th"},
+	"th":       {"td", "th"},
+	"tr":       {"tr", "td", "th"},
+}
+
+// closesP lists elements whose start tags close an open <p> element.
+var closesP = map[string]bool{
+	"address": true, "article": true, "aside": true, "blockquote": true, "details": true,
+	"div": true, "dl": true, "fieldset": true, "figcaption": true, "figure": true, "footer": true,
+	"form": true, "h1": true, "h2": true, "h3": true, "h4": true, "h5": true, "h6": true,
+	"header": true, "hr": true, "main": true, "menu": true, "nav": true, "ol": true, "p": true,
+	"pre": true, "section": true, "table": true, "ul": true,
+}
+
+// requiredParents maps from elements to the elements that may contain them.
+var requiredParents = map[string][]string{
+	"figcaption": {"figure"},
+	"li":         {"ul", "ol", "menu"},
+	"dt":         {"dl", "div"},
+	"dd":         {"dl", "div"},
+	"source":     {"picture", "video", "audio"},
+	"td":         {"tr"},
+	"th":         {"tr"},
+	"tr":         {"table", "thead", "tbody", "tfoot"},
+	"summary":    {"details"},
+}
+
+// noNesting lists interactive elements that may not contain each other.
+var noNesting = map[string]bool{"a": true, "button": true}
+
+// obsoleteAttrs maps from obsolete presentational attributes to the elements they're obsolete on.
+var obsoleteAttrs = map[string][]string{
+	"align": {"caption", "col", "colgroup", "div", "h1", "h2", "h3", "h4", "h5", "h6", "hr", "iframe",
+		"img", "input", "legend", "object", "p", "table", "tbody", "td", "tfoot", "th", "thead", "tr"},
+	"bgcolor":      {"body", "table", "td", "th", "tr"},
+	"border":       {"img", "object"},
+	"cellpadding":  {"table"},
+	"cellspacing":  {"table"},
+	"clear":        {"br"},
+	"frameborder":  {"iframe"},
+	"height":       {"table", "td", "th", "tr"},
+	"language":     {"script"},
+	"marginheight": {"iframe"},
+	"marginwidth":  {"iframe"},
+	"nowrap":       {"td", "th"},
+	"scrolling":    {"iframe"},
+	"valign":       {"col", "colgroup", "tbody", "td", "tfoot", "th", "thead", "tr"},
+	"width":        {"col", "colgroup", "hr", "pre", "table", "td", "th"},
+}
+
+// checkHTMLStructure checks the HTML document in b and returns any issues that were found.
+func checkHTMLStructure(b []byte) []validate.Issue {
+	type openElement struct {
+		name      string
+		line, col int
+	}
+	var stack []openElement
+	var issues []validate.Issue
+	ids := make(map[string]int) // line numbers of IDs
+
+	var line, col int // position of start of current token
+	add := func(format string, args ...interface{}) {
+		issues = append(issues, validate.Issue{Line: line, Col: col, Message: fmt.Sprintf(format, args...)})
+	}
+	// isOpen returns the index of the innermost open element named name, or -1 if none is open.
+	isOpen := func(name string) int {
+		for i := len(stack) - 1; i >= 0; i-- {
+			if stack[i].name == name {
+				return i
+			}
+		}
+		return -1
+	}
+	// closeTo pops elements above index i from stack, reporting ones that needed end tags.
+	closeTo := func(i int) {
+		for _, el := range stack[i+1:] {
+			if !optionalEndElements[el.name] {
+				issues = append(issues, validate.Issue{Line: el.line, Col: el.col,
+					Message: fmt.Sprintf("Unclosed element %s.", el.name)})
+			}
+		}
+		stack = stack[:i+1]
+	}
+
+	walkHTMLTokens(b, func(z *html.Tokenizer, tt html.TokenType, tokLine, tokCol int) {
+		line, col = tokLine, tokCol
+		switch tt {
+		case html.StartTagToken, html.SelfClosingTagToken:
+			tn, hasAttr := z.TagName()
+			name := string(tn)
+
+			// Handle end tags that are implied by this start tag.
+			for len(stack) > 0 && contains(impliedEnds[name], stack[len(stack)-1].name) {
+				stack = stack[:len(stack)-1]
+			}
+			if closesP[name] && len(stack) > 0 && stack[len(stack)-1].name == "p" {
+				stack = stack[:len(stack)-1]
+			}
+
+			if parents, ok := requiredParents[name]; ok && len(stack) > 0 {
+				if parent := stack[len(stack)-1].name; !contains(parents, parent) {
+					add("Element %s not allowed as child of element %s in this context.", name, parent)
+				}
+			}
+			if noNesting[name] {
+				for _, el := range stack {
+					if noNesting[el.name] {
+						add("Element %s not allowed as descendant of element %s.", name, el.name)
+						break
+					}
+				}
+			}
+
+			seen := make(map[string]bool)
+			for hasAttr {
+				var k, val []byte
+				k, val, hasAttr = z.TagAttr()
+				key := string(k)
+				if seen[key] {
+					add("Duplicate attribute %s.", key)
+				}
+				seen[key] = true
+				if key == "id" {
+					if val := string(val); val == "" {
+						add("Bad value \"\" for attribute id on element %s: An ID must not be the empty string.", name)
+					} else if first, ok := ids[val]; ok {
+						add("Duplicate ID %s (first used on line %d).", val, first)
+					} else {
+						ids[val] = line
+					}
+				}
+				if contains(obsoleteAttrs[key], name) {
+					add("The %s attribute on the %s element is obsolete. Use CSS instead.", key, name)
+				}
+			}
+
+			if tt == html.StartTagToken && !voidElements[name] {
+				stack = append(stack, openElement{name, line, col})
+			}
+		case html.EndTagToken:
+			tn, _ := z.TagName()
+			name := string(tn)
+			if voidElements[name] {
+				add("Stray end tag %s.", name)
+			} else if i := isOpen(name); i == -1 {
+				add("Stray end tag %s.", name)
+			} else {
+				closeTo(i)
+				stack = stack[:i]
+			}
+		}
+	})
+	closeTo(-1)
+	return issues
+}
+
+// walkHTMLTokens tokenizes the HTML document in b and calls fn with each token.
+// z is positioned at the token, and line and col contain the 1-based position of its start.
+func walkHTMLTokens(b []byte, fn func(z *html.Tokenizer, tt html.TokenType, line, col int)) {
+	z := html.NewTokenizer(bytes.NewReader(b))
+	line, col := 1, 1
+	for {
+		tt := z.Next()
+		if tt == html.ErrorToken {
+			return
+		}
+		// Compute the position after the token before fn consumes the token's data.
+		raw := z.Raw()
+		nextLine, nextCol := line, col+len(raw)
+		if n := bytes.Count(raw, []byte{'\n'}); n > 0 {
+			nextLine += n
+			nextCol = len(raw) - bytes.LastIndexByte(raw, '\n')
+		}
+		fn(z, tt, line, col)
+		line, col = nextLine, nextCol
+	}
+}
+
+// contains returns true if vals contains v.
+func contains(vals []string, v string) bool {
+	for _, s := range vals {
+		if s == v {
+			return true
+		}
+	}
+	return false
+}
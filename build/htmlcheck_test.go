@@ -0,0 +1,49 @@
+// Copyright 2023 Daniel Erat.
+// All rights reserved.
+
+package build
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func TestCheckHTMLStructure(t *testing.T) {
+	for _, tc := range []struct {
+		doc  string
+		want []string // "line:col message"
+	}{
+		{`<!DOCTYPE html>
+<html><head><title>OK</title></head>
+<body><p>a<p>b<ul><li>c<li>d</ul>
+<table><tr><td>1<td>2<tr><td>3</table>
+<img src="a.png" alt=""><br></body></html>`, nil},
+		{"<div id=\"a\">\n<span id=\"a\">x</span></div>", []string{
+			"2:1 Duplicate ID a (first used on line 1).",
+		}},
+		{"<div><span>x</div>", []string{"1:6 Unclosed element span."}},
+		{"<div>x</div></span>", []string{"1:13 Stray end tag span."}},
+		{"<section><b>x", []string{"1:1 Unclosed element section.", "1:10 Unclosed element b."}},
+		{"<p><div>x</div></p>", []string{"1:16 Stray end tag p."}},
+		{"<a href=\"#\"><a href=\"#\">x</a></a>", []string{
+			"1:13 Element a not allowed as descendant of element a.",
+		}},
+		{"<div><li>x</li></div>", []string{
+			"1:6 Element li not allowed as child of element div in this context.",
+		}},
+		{"<table><tr><td align=\"left\" class=\"a\" class=\"b\">x</td></tr></table>", []string{
+			"1:12 The align attribute on the td element is obsolete. Use CSS instead.",
+			"1:12 Duplicate attribute class.",
+		}},
+		{"<br></br>", []string{"1:5 Stray end tag br."}},
+	} {
+		var got []string
+		for _, is := range checkHTMLStructure([]byte(tc.doc)) {
+			got = append(got, fmt.Sprintf("%d:%d %s", is.Line, is.Col, is.Message))
+		}
+		if !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("checkHTMLStructure(%q) = %q; want %q", tc.doc, got, tc.want)
+		}
+	}
+}
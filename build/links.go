@@ -0,0 +1,241 @@
+// Copyright 2023 Daniel Erat.
+// All rights reserved.
+
+package build
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// brokenLink describes an internal link in a generated page that doesn't resolve.
+type brokenLink struct {
+	page   string // path of page containing the link, relative to the output dir
+	link   string // href, src, or srcset URL
+	text   string // link text or a description of the linking element
+	reason string // human-readable description of the problem
+}
+
+func (bl *brokenLink) String() string {
+	return fmt.Sprintf("%s: link %q (%s) %s", bl.page, bl.link, bl.text, bl.reason)
+}
+
+// linkChecker checks that internal links in generated pages resolve to files in the output dir.
+type linkChecker struct {
+	out     string                     // output dir
+	baseURL string                     // render.SiteInfo.BaseURL
+	ids     map[string]map[string]bool // IDs in pages keyed by out-relative path
+}
+
+// checkLinks checks the href, src, and srcset attributes in the HTML files at paths
+// (which must be within out) and returns any internal links that don't resolve to files
+// within out. Links with fragments must also match an element ID in the target page.
+// URLs starting with baseURL are treated as internal links.
+func checkLinks(out, baseURL string, paths []string) ([]brokenLink, error) {
+	lc := linkChecker{out: out, baseURL: baseURL, ids: make(map[string]map[string]bool)}
+	paths = append([]string(nil), paths...)
+	sort.Strings(paths)
+	var broken []brokenLink
+	for _, p := range paths {
+		bls, err := lc.checkPage(p[len(out)+1:])
+		if err != nil {
+			return nil, fmt.Errorf("%v: %v", p, err)
+		}
+		broken = append(broken, bls...)
+	}
+	return broken, nil
+}
+
+// checkPage checks links in the page at the out-relative path rel.
+func (lc *linkChecker) checkPage(rel string) ([]brokenLink, error) {
+	root, err := lc.parse(rel)
+	if err != nil {
+		return nil, err
+	}
+
+	var broken []brokenLink
+	forEachLink(root, func(n *html.Node, link string) {
+		if reason := lc.check(rel, link); reason != "" {
+			broken = append(broken, brokenLink{rel, link, linkText(n), reason})
+		}
+	})
+	return broken, nil
+}
+
+// forEachLink calls fn for each URL in href, src, and srcset attributes under root.
+func forEachLink(root *html.Node, fn func(n *html.Node, link string)) {
+	var walk func(*html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.ElementNode {
+			for _, a := range n.Attr {
+				switch a.Key {
+				case "href", "src":
+					fn(n, a.Val)
+				case "srcset":
+					for _, link := range srcsetURLs(a.Val) {
+						fn(n, link)
+					}
+				}
+			}
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(root)
+}
+
+// parseHTMLFile parses the HTML file at p.
+func parseHTMLFile(p string) (*html.Node, error) {
+	f, err := os.Open(p)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return html.Parse(f)
+}
+
+// check checks link from the page at the out-relative path rel.
+// An empty string is returned if the link is valid or external;
+// otherwise, a description of the problem is returned.
+func (lc *linkChecker) check(rel, link string) string {
+	dir := path.Dir(filepath.ToSlash(rel))
+	abs := lc.baseURL != "" && strings.HasPrefix(link, lc.baseURL)
+	if abs {
+		link = link[len(lc.baseURL):]
+		dir = "."
+	}
+
+	u, err := url.Parse(link)
+	if err != nil {
+		return "is unparseable"
+	}
+	if u.Scheme != "" || u.Host != "" {
+		return "" // external
+	}
+	var target string // out-relative path of linked file
+	switch {
+	case abs && u.Path == "":
+		target = "index.html"
+	case u.Path == "":
+		target = filepath.ToSlash(rel) // fragment-only link
+	case strings.HasPrefix(u.Path, "/"):
+		target = path.Clean(u.Path[1:])
+	default:
+		target = path.Join(dir, u.Path)
+	}
+	if target == ".." || strings.HasPrefix(target, "../") {
+		return "escapes the output dir"
+	}
+	if target == "." || strings.HasSuffix(u.Path, "/") {
+		target = path.Join(target, "index.html")
+	}
+
+	fi, err := os.Stat(filepath.Join(lc.out, filepath.FromSlash(target)))
+	if err != nil {
+		return "has missing target " + target
+	} else if fi.IsDir() {
+		target = path.Join(target, "index.html")
+		if _, err := os.Stat(filepath.Join(lc.out, filepath.FromSlash(target))); err != nil {
+			return "has missing target " + target
+		}
+	}
+
+	// "#top" and "#" scroll to the top of the document even if there's no matching element.
+	if u.Fragment == "" || u.Fragment == "top" || !isHTMLFile(target) {
+		return ""
+	}
+	ids, err := lc.getIDs(target)
+	if err != nil {
+		return fmt.Sprintf("has unreadable target %v: %v", target, err)
+	}
+	if !ids[u.Fragment] {
+		return fmt.Sprintf("has fragment missing from %v", target)
+	}
+	return ""
+}
+
+// getIDs returns the element IDs (and anchor names) in the page at the out-relative path rel.
+func (lc *linkChecker) getIDs(rel string) (map[string]bool, error) {
+	if ids, ok := lc.ids[rel]; ok {
+		return ids, nil
+	}
+	root, err := lc.parse(rel)
+	if err != nil {
+		return nil, err
+	}
+	ids := make(map[string]bool)
+	var walk func(*html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.ElementNode {
+			for _, a := range n.Attr {
+				if a.Key == "id" || (a.Key == "name" && n.Data == "a") {
+					ids[a.Val] = true
+				}
+			}
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(root)
+	lc.ids[rel] = ids
+	return ids, nil
+}
+
+// parse parses the HTML file at the out-relative path rel.
+func (lc *linkChecker) parse(rel string) (*html.Node, error) {
+	return parseHTMLFile(filepath.Join(lc.out, filepath.FromSlash(rel)))
+}
+
+// isHTMLFile returns true if p appears to be an HTML file.
+func isHTMLFile(p string) bool {
+	ext := path.Ext(p)
+	return ext == ".html" || ext == ".htm"
+}
+
+// srcsetURLs returns the URLs from the supplied srcset attribute value,
+// e.g. "a.png 100w, b.png 200w".
+func srcsetURLs(srcset string) []string {
+	var urls []string
+	for _, cand := range strings.Split(srcset, ",") {
+		if fields := strings.Fields(cand); len(fields) > 0 {
+			urls = append(urls, fields[0])
+		}
+	}
+	return urls
+}
+
+// linkText returns a short description of the linking element n,
+// e.g. its text for <a> elements or its alt text for images.
+func linkText(n *html.Node) string {
+	var b strings.Builder
+	var walk func(*html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.TextNode {
+			b.WriteString(n.Data)
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	if n.Data == "a" {
+		walk(n)
+	}
+	if text := strings.Join(strings.Fields(b.String()), " "); text != "" {
+		return fmt.Sprintf("%q", text)
+	}
+	for _, a := range n.Attr {
+		if a.Key == "alt" && a.Val != "" {
+			return fmt.Sprintf("<%s> %q", n.Data, a.Val)
+		}
+	}
+	return "<" + n.Data + ">"
+}
@@ -0,0 +1,70 @@
+// Copyright 2023 Daniel Erat.
+// All rights reserved.
+
+package build
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestCheckLinks(t *testing.T) {
+	dir, err := ioutil.TempDir("", "links_test.")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	write := func(p, data string) {
+		p = filepath.Join(dir, p)
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(p, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("index.html", `<!DOCTYPE html><html><body><h1 id="top-heading">Index</h1>
+<a href="foo.html">Foo</a>
+<a href="foo.html#sec">Foo section</a>
+<a href="foo.html#missing">Missing <b>section</b></a>
+<a href="bar.html">Bar</a>
+<a href="#top-heading">Top heading</a>
+<a href="#top">Top</a>
+<a href="#nowhere">Nowhere</a>
+<a href="https://www.example.org/">Home</a>
+<a href="https://www.example.org/sub/#name">Sub</a>
+<a href="https://www.example.org/gone.html">Gone</a>
+<a href="https://other.example.com/missing.html">External</a>
+<a href="mailto:user@example.org">Email</a>
+<img src="img.png" srcset="img.png 100w, img-200.png 200w" alt="Image">
+<img src="data:image/gif;base64,R0lGODlhAQABAAAAACw=" alt="Data">
+</body></html>`)
+	write("foo.html", `<html><body><h2 id="sec">Section</h2><a href="../up.html">Up</a></body></html>`)
+	write("sub/index.html", `<html><body><a name="name"></a><a href="../index.html#top-heading">Back</a></body></html>`)
+	write("img.png", "")
+
+	paths := []string{
+		filepath.Join(dir, "sub/index.html"),
+		filepath.Join(dir, "index.html"),
+		filepath.Join(dir, "foo.html"),
+	}
+	broken, err := checkLinks(dir, "https://www.example.org/", paths)
+	if err != nil {
+		t.Fatal("checkLinks failed:", err)
+	}
+	want := []brokenLink{
+		{"foo.html", "../up.html", `"Up"`, "escapes the output dir"},
+		{"index.html", "foo.html#missing", `"Missing section"`, "has fragment missing from foo.html"},
+		{"index.html", "bar.html", `"Bar"`, "has missing target bar.html"},
+		{"index.html", "#nowhere", `"Nowhere"`, "has fragment missing from index.html"},
+		{"index.html", "https://www.example.org/gone.html", `"Gone"`, "has missing target gone.html"},
+		{"index.html", "img-200.png", `<img> "Image"`, "has missing target img-200.png"},
+	}
+	if !reflect.DeepEqual(broken, want) {
+		t.Errorf("checkLinks returned %v; want %v", broken, want)
+	}
+}
@@ -0,0 +1,189 @@
+// Copyright 2023 Daniel Erat.
+// All rights reserved.
+
+package build
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/derat/intransigence/render"
+)
+
+// Source types recorded in the build manifest.
+const (
+	sourcePage        = "page"         // Markdown file in pages dir
+	sourceIframe      = "iframe"       // YAML file in iframes dir
+	sourceStatic      = "static"       // file in static dir
+	sourceExtraStatic = "extra_static" // file in render.SiteInfo.ExtraStaticDirs source dir
+	sourceGenImage    = "image"        // scaled, WebP, or AVIF image generated in gen/static dir
+	sourceSitemap     = "sitemap"      // generated sitemap
+	sourceFeed        = "feed"         // generated feed
+	sourceTag         = "tag"          // generated tag page or feed
+	sourceCompressed  = "compressed"   // precompressed copy of another output file
+	sourceLiveReload  = "live_reload"  // token file used by live-reload script
+	sourceUnknown     = "unknown"      // file left over from an earlier build into the same dir
+)
+
+// fileSource describes where a file in the output dir came from.
+type fileSource struct {
+	typ  string // one of the source* constants
+	path string // source path relative to the site dir (or to the output dir for sourceCompressed)
+}
+
+// fileSources records where files in the output dir came from.
+// Keys are paths relative to the output dir.
+type fileSources map[string]fileSource
+
+// add records that the output files at out-relative paths in rels came from typ.
+// If pathFunc is non-nil, it is used to get each file's source path.
+func (fs fileSources) add(typ string, rels []string, pathFunc func(rel string) string) {
+	for _, rel := range rels {
+		src := fileSource{typ: typ}
+		if pathFunc != nil {
+			src.path = pathFunc(rel)
+		}
+		fs[rel] = src
+	}
+}
+
+// addDir records that all regular files under the directory src (relative to the site dir
+// at siteDir) were copied to the directory dst (relative to the output dir).
+// src may also be a regular file, in which case dst should be its out-relative path.
+// If filter is non-nil, only files for which it returns true are recorded.
+func (fs fileSources) addDir(typ, siteDir, src, dst string, filter func(p string) bool) error {
+	base := filepath.Join(siteDir, src)
+	return filepath.Walk(base, func(p string, fi os.FileInfo, err error) error {
+		if os.IsNotExist(err) && p == base {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		if !fi.Mode().IsRegular() || (filter != nil && !filter(p)) {
+			return nil
+		}
+		var rel string // empty if src is a file
+		if p != base {
+			rel = p[len(base)+1:]
+		}
+		fs[filepath.Join(dst, rel)] = fileSource{typ: typ, path: filepath.Join(src, rel)}
+		return nil
+	})
+}
+
+// manifestEntry describes a single output file in the build manifest.
+type manifestEntry struct {
+	Size        int64  `json:"size"`
+	SHA256      string `json:"sha256"` // hex-encoded
+	ContentType string `json:"content_type"`
+	Source      string `json:"source"`                // one of the source* constants
+	SourcePath  string `json:"source_path,omitempty"` // see fileSource.path
+}
+
+// writeManifest writes a JSON build manifest describing all files in the output dir out
+// to the out-relative path name. Each file's source is looked up in sources, except
+// for precompressed copies of other files, which are detected automatically. Other files
+// (e.g. ones left over from an earlier build into the same dir) are listed as sourceUnknown.
+func writeManifest(out, name string, sources fileSources) error {
+	dp := filepath.Join(out, name)
+	if _, ok := sources[name]; ok {
+		return fmt.Errorf("%v conflicts with existing output file", name)
+	}
+
+	files := make(map[string]manifestEntry)
+	if err := filepath.Walk(out, func(p string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !fi.Mode().IsRegular() {
+			return nil
+		}
+		rel := p[len(out)+1:]
+		if rel == name {
+			return nil
+		}
+		src, ok := sources[rel]
+		if !ok {
+			for _, enc := range encodings {
+				if orig := strings.TrimSuffix(rel, enc.ext); orig != rel {
+					if _, ok = sources[orig]; ok {
+						src = fileSource{typ: sourceCompressed, path: orig}
+						break
+					}
+				}
+			}
+		}
+		if !ok {
+			src = fileSource{typ: sourceUnknown}
+		}
+
+		b, err := ioutil.ReadFile(p)
+		if err != nil {
+			return err
+		}
+		sum := sha256.Sum256(b)
+		files[rel] = manifestEntry{
+			Size:        fi.Size(),
+			SHA256:      hex.EncodeToString(sum[:]),
+			ContentType: contentType(p, b),
+			Source:      src.typ,
+			SourcePath:  src.path,
+		}
+		return nil
+	}); err != nil {
+		return err
+	}
+
+	// Marshaling sorts map keys, so the output is deterministic.
+	b, err := json.MarshalIndent(struct {
+		Files map[string]manifestEntry `json:"files"`
+	}{files}, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(dp, append(b, '\n'), fileMode)
+}
+
+// contentTypes maps from extensions to MIME types. It's consulted before mime.TypeByExtension,
+// whose results depend on system files, so that manifests are consistent across machines.
+var contentTypes = map[string]string{
+	".css":         "text/css; charset=utf-8",
+	".gif":         "image/gif",
+	".htm":         "text/html; charset=utf-8",
+	".html":        "text/html; charset=utf-8",
+	".ico":         "image/x-icon",
+	".jpeg":        "image/jpeg",
+	".jpg":         "image/jpeg",
+	".js":          "text/javascript; charset=utf-8",
+	".json":        "application/json",
+	".png":         "image/png",
+	".svg":         "image/svg+xml",
+	".txt":         "text/plain; charset=utf-8",
+	".webmanifest": "application/manifest+json",
+	".xml":         "text/xml; charset=utf-8",
+	".br":          "application/x-br",
+	".gz":          "application/gzip",
+	".zst":         "application/zstd",
+	render.AVIFExt: "image/avif",
+	render.WebPExt: "image/webp",
+}
+
+// contentType returns the MIME type of the file at p containing b.
+func contentType(p string, b []byte) string {
+	ext := strings.ToLower(filepath.Ext(p))
+	if ct, ok := contentTypes[ext]; ok {
+		return ct
+	}
+	if ct := mime.TypeByExtension(ext); ct != "" {
+		return ct
+	}
+	return http.DetectContentType(b)
+}
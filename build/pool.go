@@ -0,0 +1,85 @@
+// Copyright 2023 Daniel Erat.
+// All rights reserved.
+
+package build
+
+import (
+	"runtime"
+	"sync"
+)
+
+// defaultJobs returns the number of tasks to run in parallel if the user didn't specify a value.
+func defaultJobs() int {
+	return runtime.NumCPU()
+}
+
+// runTasks calls fn for each integer in [0, num), running up to jobs calls in parallel.
+// If jobs is non-positive, defaultJobs is used.
+// desc (e.g. "Generating pages") is used to display progress via statusf.
+//
+// If one or more calls return errors, no additional calls are started and the error from
+// the lowest-numbered failing call is returned. Since tasks are started in order, this is
+// the same error that would be returned if the tasks were run serially.
+func runTasks(jobs, num int, desc string, fn func(i int) error) error {
+	if jobs <= 0 {
+		jobs = defaultJobs()
+	}
+	if jobs > num {
+		jobs = num
+	}
+
+	type result struct {
+		i   int
+		err error
+	}
+	taskCh := make(chan int)
+	resCh := make(chan result)
+
+	var wg sync.WaitGroup
+	wg.Add(jobs)
+	for j := 0; j < jobs; j++ {
+		go func() {
+			defer wg.Done()
+			for i := range taskCh {
+				resCh <- result{i, fn(i)}
+			}
+		}()
+	}
+	go func() {
+		wg.Wait()
+		close(resCh)
+	}()
+
+	defer clearStatus()
+	statusf("%s: [0/%d]", desc, num)
+
+	var errIdx = -1
+	var firstErr error
+	var next, done int
+	for done < num {
+		// Only send more tasks if nothing has failed yet.
+		var sendCh chan<- int
+		if next < num && firstErr == nil {
+			sendCh = taskCh
+		}
+		select {
+		case sendCh <- next:
+			next++
+		case res := <-resCh:
+			done++
+			statusf("%s: [%d/%d]", desc, done, num)
+			if res.err != nil && (errIdx < 0 || res.i < errIdx) {
+				errIdx, firstErr = res.i, res.err
+			}
+		}
+		// Once an error has been seen, stop waiting for tasks that will never be sent.
+		if firstErr != nil && done == next {
+			break
+		}
+	}
+	close(taskCh)
+	for range resCh {
+		// Drain any results from tasks that were still in flight.
+	}
+	return firstErr
+}
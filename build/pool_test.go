@@ -0,0 +1,58 @@
+// Copyright 2023 Daniel Erat.
+// All rights reserved.
+
+package build
+
+import (
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRunTasks(t *testing.T) {
+	const num = 50
+	var done [num]int32
+	var running, maxRunning int32
+	if err := runTasks(4, num, "Testing", func(i int) error {
+		n := atomic.AddInt32(&running, 1)
+		for {
+			m := atomic.LoadInt32(&maxRunning)
+			if n <= m || atomic.CompareAndSwapInt32(&maxRunning, m, n) {
+				break
+			}
+		}
+		time.Sleep(time.Millisecond)
+		atomic.AddInt32(&done[i], 1)
+		atomic.AddInt32(&running, -1)
+		return nil
+	}); err != nil {
+		t.Fatal("runTasks failed:", err)
+	}
+	for i, n := range done {
+		if n != 1 {
+			t.Errorf("Task %d ran %d time(s); want 1", i, n)
+		}
+	}
+	if maxRunning > 4 {
+		t.Errorf("%d tasks ran in parallel; want at most 4", maxRunning)
+	}
+}
+
+func TestRunTasks_Error(t *testing.T) {
+	// The lowest-numbered failing task's error should be returned even if a
+	// later task fails first.
+	err := runTasks(8, 20, "Testing", func(i int) error {
+		switch i {
+		case 3:
+			time.Sleep(20 * time.Millisecond)
+			return fmt.Errorf("task %d failed", i)
+		case 5:
+			return fmt.Errorf("task %d failed", i)
+		}
+		return nil
+	})
+	if want := "task 3 failed"; err == nil || err.Error() != want {
+		t.Errorf("runTasks returned %v; want %q", err, want)
+	}
+}
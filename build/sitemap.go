@@ -7,48 +7,24 @@ import (
 	"encoding/xml"
 	"io"
 	"os"
+	"sort"
+	"strings"
 
 	"github.com/derat/intransigence/render"
 )
 
-// writeSitemap generates a sitemap listing all normal pages in si and writes it to path p.
-func writeSitemap(p string, si *render.SiteInfo) error {
+// writeSitemap generates a sitemap listing the pages described by metas (keyed by paths
+// relative to the output dir, as returned by generatePages) and writes it to path p.
+// AMP pages and pages without sitemap information are omitted.
+func writeSitemap(p string, metas map[string]*render.PageMeta) error {
 	var sm sitemap
-
-	// Recursively walk nav items and add all pages.
-	addedIndex := false
-	var add func(it *render.NavItem) error
-	add = func(it *render.NavItem) error {
-		if it.IsBarePage() {
-			if it.URL == render.IndexPage {
-				addedIndex = true
-			}
-			url, err := si.AbsURL(it.URL)
-			if err != nil {
-				return err
-			}
-			sm.add(url, changesWeekly)
-		}
-		for _, c := range it.Children {
-			if err := add(c); err != nil {
-				return err
-			}
-		}
-		return nil
-	}
-	for _, it := range si.NavItems {
-		if err := add(it); err != nil {
-			return err
+	for rel, meta := range metas {
+		if strings.HasSuffix(rel, render.AMPExt) || meta == nil || meta.Sitemap == nil {
+			continue
 		}
+		sm.add(meta.Sitemap)
 	}
-
-	if !addedIndex {
-		url, err := si.AbsURL(render.IndexPage)
-		if err != nil {
-			return err
-		}
-		sm.add(url, changesWeekly)
-	}
+	sort.Slice(sm.URLs, func(i, j int) bool { return sm.URLs[i].Loc < sm.URLs[j].Loc })
 
 	f, err := os.Create(p)
 	if err != nil {
@@ -63,13 +39,29 @@ func writeSitemap(p string, si *render.SiteInfo) error {
 
 // sitemap holds the contents of a sitemap XML document.
 type sitemap struct {
-	XMLName string `xml:"http://www.sitemaps.org/schemas/sitemap/0.9 urlset"`
-	URLs    []sitemapURL
+	XMLName    string `xml:"http://www.sitemaps.org/schemas/sitemap/0.9 urlset"`
+	ImageXMLNS string `xml:"xmlns:image,attr,omitempty"`
+	URLs       []sitemapURL
 }
 
-// add adds an entry to s.
-func (s *sitemap) add(loc string, cf changeFreq) {
-	s.URLs = append(s.URLs, sitemapURL{Loc: loc, ChangeFreq: string(cf)})
+// sitemapImageXMLNS is the namespace used for image information in sitemaps.
+// See https://developers.google.com/search/docs/crawling-indexing/sitemaps/image-sitemaps.
+const sitemapImageXMLNS = "http://www.google.com/schemas/sitemap-image/1.1"
+
+// sitemapDateLayout is used to format <lastmod> dates.
+const sitemapDateLayout = "2006-01-02"
+
+// add adds an entry describing the page described by info to s.
+func (s *sitemap) add(info *render.PageSitemapInfo) {
+	u := sitemapURL{Loc: info.AbsURL, ChangeFreq: info.ChangeFreq, Priority: info.Priority}
+	if !info.LastMod.IsZero() {
+		u.LastMod = info.LastMod.Format(sitemapDateLayout)
+	}
+	for _, img := range info.Images {
+		u.Images = append(u.Images, sitemapImage{Loc: img})
+		s.ImageXMLNS = sitemapImageXMLNS
+	}
+	s.URLs = append(s.URLs, u)
 }
 
 // write writes s to w as XML.
@@ -88,16 +80,17 @@ func (s *sitemap) write(w io.Writer) error {
 	return err
 }
 
-// changeFreq describes how frequently a URL in a sitemap is expected to change.
-type changeFreq string
-
-const (
-	changesWeekly changeFreq = "weekly"
-)
-
 // sitemapURL is an entry in a sitemap.
 type sitemapURL struct {
-	XMLName    string `xml:"url"`
-	Loc        string `xml:"loc"`
-	ChangeFreq string `xml:"changefreq"`
+	XMLName    string         `xml:"url"`
+	Loc        string         `xml:"loc"`
+	LastMod    string         `xml:"lastmod,omitempty"`
+	ChangeFreq string         `xml:"changefreq,omitempty"`
+	Priority   string         `xml:"priority,omitempty"`
+	Images     []sitemapImage `xml:"image:image"`
+}
+
+// sitemapImage describes an image in a sitemap entry.
+type sitemapImage struct {
+	Loc string `xml:"image:loc"`
 }
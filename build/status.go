@@ -7,6 +7,7 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"sync"
 )
 
 // statusDest is the io.Writer used by statusf and logf.
@@ -15,11 +16,17 @@ var statusDest = os.Stderr
 // statusLine is the status text most recently written via statusf.
 var statusLine string
 
+// statusMu serializes writes to statusDest so statusf and logf can be called
+// from multiple goroutines.
+var statusMu sync.Mutex
+
 // statusf replaces the status line with the supplied format string and args.
 func statusf(format string, args ...interface{}) {
-	clearStatus()
+	statusMu.Lock()
+	defer statusMu.Unlock()
+	clearStatusLocked()
 	statusLine = fmt.Sprintf(format, args...)
-	writeStatus()
+	writeStatusLocked()
 }
 
 // logf writes the supplied format string and args and rewrites the status line after it.
@@ -28,16 +35,24 @@ func logf(format string, args ...interface{}) {
 	if len(format) > 0 && format[len(format)-1] != '\n' {
 		format += "\n"
 	}
-	clearStatus()
+	statusMu.Lock()
+	defer statusMu.Unlock()
+	clearStatusLocked()
 	fmt.Fprintf(statusDest, format, args...)
-	writeStatus()
+	writeStatusLocked()
 }
 
-func writeStatus() {
+func clearStatus() {
+	statusMu.Lock()
+	defer statusMu.Unlock()
+	clearStatusLocked()
+}
+
+func writeStatusLocked() {
 	io.WriteString(statusDest, statusLine)
 }
 
-func clearStatus() {
+func clearStatusLocked() {
 	// https://unix.stackexchange.com/questions/26576/how-to-delete-line-with-echo
 	io.WriteString(statusDest, "\x1b[2K\r")
 }
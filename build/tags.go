@@ -0,0 +1,111 @@
+// Copyright 2023 Daniel Erat.
+// All rights reserved.
+
+package build
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/derat/intransigence/render"
+)
+
+// collectTags returns the non-AMP pages described by metas (keyed by paths relative to
+// the output dir, as returned by generatePages), grouped by the tags in their page blocks.
+// An error is returned if multiple tags would be written to the same files.
+func collectTags(metas map[string]*render.PageMeta) (map[string][]*render.PageSummary, error) {
+	rels := make([]string, 0, len(metas))
+	for rel := range metas {
+		rels = append(rels, rel)
+	}
+	sort.Strings(rels)
+
+	tagged := make(map[string][]*render.PageSummary)
+	files := make(map[string]string) // tag page filenames to tags
+	for _, rel := range rels {
+		meta := metas[rel]
+		if strings.HasSuffix(rel, render.AMPExt) || meta == nil || meta.Summary == nil {
+			continue
+		}
+		for _, tag := range meta.Summary.Tags {
+			if _, ok := tagged[tag]; !ok {
+				fn, err := render.TagPageFile(tag)
+				if err != nil {
+					return nil, fmt.Errorf("%v: %v", rel, err)
+				}
+				if other, ok := files[fn]; ok {
+					return nil, fmt.Errorf("tags %q and %q both use %v", other, tag, fn)
+				}
+				files[fn] = tag
+			}
+			tagged[tag] = append(tagged[tag], meta.Summary)
+		}
+	}
+	return tagged, nil
+}
+
+// generateTagPages renders non-AMP and AMP versions of a page for each tag in tagged
+// (see collectTags), along with a page listing all tags, and writes them to out.
+// metas contains the pages returned by generatePages and is used to detect conflicts.
+// The generated files' paths are returned, along with page metadata keyed by the
+// files' paths relative to out. Nothing is generated if tagged is empty.
+func generateTagPages(si *render.SiteInfo, out string, pretty bool,
+	tagged map[string][]*render.PageSummary, metas map[string]*render.PageMeta) (
+	[]string, map[string]*render.PageMeta, error) {
+	if len(tagged) == 0 {
+		return nil, nil, nil
+	}
+
+	type job struct {
+		name   string
+		render func(amp bool) ([]byte, *render.PageMeta, error)
+	}
+	jobs := []job{{render.TagIndexPage, func(amp bool) ([]byte, *render.PageMeta, error) {
+		return render.TagIndex(*si, tagged, amp)
+	}}}
+	for tag, pages := range tagged {
+		tag, pages := tag, pages
+		fn, err := render.TagPageFile(tag)
+		if err != nil {
+			return nil, nil, err
+		}
+		jobs = append(jobs, job{fn, func(amp bool) ([]byte, *render.PageMeta, error) {
+			return render.TagPage(*si, tag, pages, amp)
+		}})
+	}
+	sort.Slice(jobs, func(i, j int) bool { return jobs[i].name < jobs[j].name })
+
+	var outPaths []string
+	tagMetas := make(map[string]*render.PageMeta)
+	for _, j := range jobs {
+		for _, amp := range []bool{false, true} {
+			name := j.name
+			if amp {
+				name = strings.TrimSuffix(name, render.HTMLExt) + render.AMPExt
+			}
+			if _, ok := metas[name]; ok {
+				return nil, nil, fmt.Errorf("generated %v conflicts with existing page", name)
+			}
+			b, meta, err := j.render(amp)
+			if err != nil {
+				return nil, nil, fmt.Errorf("failed to render %s: %v", name, err)
+			}
+			if pretty {
+				if b, err = prettyPrintDoc(bytes.NewReader(b)); err != nil {
+					return nil, nil, fmt.Errorf("failed to pretty-print %s: %v", name, err)
+				}
+			}
+			dest := filepath.Join(out, name)
+			if err := ioutil.WriteFile(dest, b, fileMode); err != nil {
+				return nil, nil, err
+			}
+			outPaths = append(outPaths, dest)
+			tagMetas[name] = meta
+		}
+	}
+	return outPaths, tagMetas, nil
+}
@@ -4,14 +4,20 @@
 package build
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
+	"net/url"
 	"os"
+	"os/exec"
+	"path"
 	"path/filepath"
 	"regexp"
 	"strings"
+	"time"
 
 	"github.com/derat/intransigence/render"
 	"github.com/derat/validate"
@@ -47,23 +53,161 @@ var cssIgnore = []*regexp.Regexp{
 	regexp.MustCompile(`background-image image-set\(.*\) is not a background-image value`),
 }
 
-// validateFiles validates files at the supplied paths.
-func validateFiles(ctx context.Context, paths []string) error {
+// ignoreRule describes a rule for ignoring validation issues.
+type ignoreRule struct {
+	typ     string         // type of validation, e.g. "HTML"
+	re      *regexp.Regexp // matches issue messages
+	files   string         // path.Match pattern matching file paths; empty to match all files
+	matched int            // number of issues matched by the rule
+}
+
+// builtinRules returns rules of type typ for the built-in regexps in res.
+func builtinRules(typ string, res []*regexp.Regexp) []*ignoreRule {
+	rules := make([]*ignoreRule, len(res))
+	for i, re := range res {
+		rules[i] = &ignoreRule{typ: typ, re: re}
+	}
+	return rules
+}
+
+// validationTypes maps from types used in render.ValidationIgnore to the types used in reports.
+var validationTypes = map[string]string{"html": "HTML", "amp": "AMP", "css": "CSS", "a11y": "A11y"}
+
+// ignoreDateLayout is the layout used for render.ValidationIgnore.Expires.
+const ignoreDateLayout = "2006-01-02"
+
+// newIgnoreRules converts rules from site.yaml into ignoreRules.
+// Rules that expired before now are logged and omitted.
+func newIgnoreRules(rules []render.ValidationIgnore, now time.Time) ([]*ignoreRule, error) {
+	var ret []*ignoreRule
+	for i, r := range rules {
+		typ, ok := validationTypes[strings.ToLower(r.Type)]
+		if !ok {
+			return nil, fmt.Errorf("validation ignore rule %d has bad type %q", i, r.Type)
+		}
+		re, err := regexp.Compile(r.Message)
+		if err != nil {
+			return nil, fmt.Errorf("validation ignore rule %d has bad message regexp: %v", i, err)
+		}
+		if _, err := path.Match(r.Files, ""); err != nil {
+			return nil, fmt.Errorf("validation ignore rule %d has bad files pattern %q: %v", i, r.Files, err)
+		}
+		rule := &ignoreRule{typ: typ, re: re, files: r.Files}
+		if r.Expires != "" {
+			exp, err := time.ParseInLocation(ignoreDateLayout, r.Expires, now.Location())
+			if err != nil {
+				return nil, fmt.Errorf("validation ignore rule %d has bad expiry date %q", i, r.Expires)
+			}
+			// Apply the rule through the end of the expiry date.
+			if !now.Before(exp.AddDate(0, 0, 1)) {
+				logf("Skipping validation ignore rule %v that expired on %v\n", rule, r.Expires)
+				continue
+			}
+		}
+		ret = append(ret, rule)
+	}
+	return ret, nil
+}
+
+// matches returns true if r matches an issue with message msg in the file at slash-separated path fn.
+func (r *ignoreRule) matches(fn, msg string) bool {
+	if r.files != "" {
+		if ok, _ := path.Match(r.files, fn); !ok {
+			if strings.Contains(r.files, "/") {
+				return false
+			}
+			if ok, _ := path.Match(r.files, path.Base(fn)); !ok {
+				return false
+			}
+		}
+	}
+	return r.re.MatchString(msg)
+}
+
+func (r *ignoreRule) String() string {
+	s := fmt.Sprintf("%s %q", r.typ, r.re.String())
+	if r.files != "" {
+		s += " for " + r.files
+	}
+	return s
+}
+
+// Validator backends that can be selected via render.SiteInfo.Validator or Options.Validator.
+const (
+	// W3CValidator uses github.com/derat/validate, which sends HTML and CSS to the W3C's
+	// online validators and runs amphtml-validator locally for AMP pages.
+	W3CValidator = "w3c"
+	// VNUValidator runs a locally-installed copy of the Nu Html Checker (vnu.jar) for HTML and
+	// CSS and amphtml-validator for AMP pages.
+	VNUValidator = "vnu"
+	// BuiltinValidator performs structural checks on HTML and AMP pages without using any external
+	// tools or services. CSS isn't checked.
+	BuiltinValidator = "builtin"
+)
+
+// validatorBackend contains the validators used for different types of files.
+// Each is a streamValidator or filesValidator, or nil if that type of file shouldn't be checked.
+type validatorBackend struct {
+	name           string // one of the *Validator constants
+	html, amp, css interface{}
+	a11y           interface{} // checks HTML and AMP files for accessibility problems
+}
+
+// newValidatorBackend returns the backend identified by name (one of the *Validator constants).
+// vnuPath is used for VNUValidator.
+func newValidatorBackend(name, vnuPath string) (*validatorBackend, error) {
+	switch name {
+	case W3CValidator, "":
+		return &validatorBackend{name: W3CValidator, html: &htmlValidator{}, amp: &ampValidator{},
+			css: &cssValidator{}}, nil
+	case VNUValidator:
+		return &validatorBackend{name: name, html: &vnuValidator{vnuPath, false}, amp: &ampValidator{},
+			css: &vnuValidator{vnuPath, true}}, nil
+	case BuiltinValidator:
+		return &validatorBackend{name: name, html: &structuralValidator{}, amp: &structuralValidator{}}, nil
+	default:
+		return nil, fmt.Errorf("unknown validator %q", name)
+	}
+}
+
+// validateFiles validates files at the supplied paths using backend. Results for files whose
+// contents are unchanged are taken from cache (which may be nil), and new results are added to it.
+// codeContrast contains descriptions of low-contrast code colors (see
+// render.SiteInfo.CodeContrastIssues), which are reported as A11y issues attributed to site.yaml.
+// Issues matched by the built-in rules or by extra are ignored, and a warning is logged for each
+// rule in extra that doesn't match any issues. The returned report describes all issues that were
+// found, including ignored ones, and is non-nil even if an error is returned due to unignored issues.
+func validateFiles(ctx context.Context, paths []string, backend *validatorBackend, cache *validateCache,
+	extra []*ignoreRule, codeContrast []string) (*validateReport, error) {
 	// AMP files are rejected by validate.HTML with e.g. "Attribute amp not allowed on
 	// element html at this point.", so build up separate lists of files.
-	var htmlPaths, ampPaths, cssPaths []string
+	var htmlPaths, ampPaths, cssPaths, a11yPaths []string
 	var baseDir string // longest common prefix among paths
 	for _, p := range paths {
 		var err error
 		if p, err = filepath.Abs(p); err != nil {
-			return err
+			return nil, err
 		}
 		if strings.HasSuffix(p, render.AMPExt) {
-			ampPaths = append(ampPaths, p)
-			cssPaths = append(cssPaths, p)
+			if backend.amp != nil {
+				ampPaths = append(ampPaths, p)
+			}
+			if backend.css != nil {
+				cssPaths = append(cssPaths, p)
+			}
+			if backend.a11y != nil {
+				a11yPaths = append(a11yPaths, p)
+			}
 		} else if strings.HasSuffix(p, render.HTMLExt) {
-			htmlPaths = append(htmlPaths, p)
-			cssPaths = append(cssPaths, p)
+			if backend.html != nil {
+				htmlPaths = append(htmlPaths, p)
+			}
+			if backend.css != nil {
+				cssPaths = append(cssPaths, p)
+			}
+			if backend.a11y != nil {
+				a11yPaths = append(a11yPaths, p)
+			}
 		}
 		for pre := filepath.Dir(p); ; pre = filepath.Dir(pre) {
 			if baseDir == "" || strings.HasPrefix(baseDir, pre) {
@@ -73,65 +217,129 @@ func validateFiles(ctx context.Context, paths []string) error {
 		}
 	}
 
+	// Skip files that were already validated with their current contents.
+	type cachedResult struct {
+		typ string
+		res validateResult
+	}
+	var cached []cachedResult
+	uncached := func(typ string, paths []string) ([]string, error) {
+		var todo []string
+		for _, p := range paths {
+			if issues, ok, err := cache.get(backend.name, typ, p); err != nil {
+				return nil, err
+			} else if ok {
+				cached = append(cached, cachedResult{typ, validateResult{p: p, issues: issues}})
+			} else {
+				todo = append(todo, p)
+			}
+		}
+		return todo, nil
+	}
+	var htmlTodo, ampTodo, cssTodo, a11yTodo []string
+	for _, t := range []struct {
+		typ   string
+		paths []string
+		todo  *[]string
+	}{
+		{"HTML", htmlPaths, &htmlTodo},
+		{"AMP", ampPaths, &ampTodo},
+		{"CSS", cssPaths, &cssTodo},
+		{"A11y", a11yPaths, &a11yTodo},
+	} {
+		var err error
+		if *t.todo, err = uncached(t.typ, t.paths); err != nil {
+			return nil, err
+		}
+	}
+
 	// Perform validation tasks in parallel.
-	htmlCh := startValidation(ctx, htmlPaths, &htmlValidator{})
-	ampCh := startValidation(ctx, ampPaths, &ampValidator{})
-	cssCh := startValidation(ctx, cssPaths, &cssValidator{})
+	htmlCh := startValidation(ctx, htmlTodo, backend.html)
+	ampCh := startValidation(ctx, ampTodo, backend.amp)
+	cssCh := startValidation(ctx, cssTodo, backend.css)
+	a11yCh := startValidation(ctx, a11yTodo, backend.a11y)
 
+	ignore := map[string][]*ignoreRule{
+		"HTML": builtinRules("HTML", htmlIgnore),
+		"AMP":  builtinRules("AMP", ampIgnore),
+		"CSS":  builtinRules("CSS", cssIgnore),
+	}
+	for _, r := range extra {
+		ignore[r.typ] = append(ignore[r.typ], r)
+	}
+
+	report := validateReport{Validator: backend.name, Issues: []validateIssue{}}
+	rel := func(p string) string { return filepath.ToSlash(p[len(baseDir)+1:]) } // strip common dir
 	var failed bool
-	var htmlRes, ampRes, cssRes int
+	if len(codeContrast) > 0 {
+		var issues []validate.Issue
+		for _, s := range codeContrast {
+			issues = append(issues, validate.Issue{Message: "Low contrast in " + s + "."})
+		}
+		failed = !report.add("A11y", siteFile, validateResult{issues: issues}, ignore["A11y"])
+	}
+	for _, c := range cached {
+		failed = !report.add(c.typ, rel(c.res.p), c.res, ignore[c.typ]) || failed
+	}
+	// add records a new result of type typ.
+	add := func(typ string, res validateResult) error {
+		if res.err == nil {
+			if err := cache.put(backend.name, typ, res.p, res.issues); err != nil {
+				return err
+			}
+		}
+		failed = !report.add(typ, rel(res.p), res, ignore[typ]) || failed
+		return nil
+	}
+
+	htmlRes := len(htmlPaths) - len(htmlTodo)
+	ampRes := len(ampPaths) - len(ampTodo)
+	cssRes := len(cssPaths) - len(cssTodo)
+	a11yRes := len(a11yPaths) - len(a11yTodo)
 	defer clearStatus()
-	for htmlRes < len(htmlPaths) || ampRes < len(ampPaths) || cssRes < len(cssPaths) {
-		statusf("Validating pages: HTML [%d/%d], AMP [%d/%d], CSS [%d/%d]",
-			htmlRes, len(htmlPaths), ampRes, len(ampPaths), cssRes, len(cssPaths))
+	for htmlRes < len(htmlPaths) || ampRes < len(ampPaths) || cssRes < len(cssPaths) ||
+		a11yRes < len(a11yPaths) {
+		statusf("Validating pages: HTML [%d/%d], AMP [%d/%d], CSS [%d/%d], A11y [%d/%d]",
+			htmlRes, len(htmlPaths), ampRes, len(ampPaths), cssRes, len(cssPaths),
+			a11yRes, len(a11yPaths))
+		var err error
 		select {
 		case res := <-htmlCh:
-			failed = !printValidateResult("HTML", baseDir, res, htmlIgnore) || failed
+			err = add("HTML", res)
 			htmlRes++
 		case res := <-ampCh:
-			failed = !printValidateResult("AMP", baseDir, res, ampIgnore) || failed
+			err = add("AMP", res)
 			ampRes++
 		case res := <-cssCh:
-			failed = !printValidateResult("CSS", baseDir, res, cssIgnore) || failed
+			err = add("CSS", res)
 			cssRes++
+		case res := <-a11yCh:
+			err = add("A11y", res)
+			a11yRes++
 		}
-	}
-	if failed {
-		return errors.New("validation failed")
-	}
-	return nil
-}
-
-// printValidateResult prints issues from res if they are not excluded by a regexp in ignore.
-// vname describes the type of validation being performed, e.g. "HTML".
-// baseDir contains a common prefix that is removed from file paths.
-// Returns true if no problems were found.
-func printValidateResult(vname, baseDir string, res validateResult, ignore []*regexp.Regexp) bool {
-	good := true
-	// Filter out ignored issues.
-	var issues []validate.Issue
-	for _, is := range res.issues {
-		ignored := false
-		for _, ig := range ignore {
-			if ig.MatchString(is.Message) {
-				ignored = true
-				break
-			}
-		}
-		if !ignored {
-			issues = append(issues, is)
+		if err != nil {
+			return nil, err
 		}
 	}
-	fn := res.p[len(baseDir)+1:] // strip off common dir plus slash
-	if res.err != nil {
-		logf("%s: %s validator failed: %v\n", fn, vname, res.err)
-		good = false
+	report.sort()
+
+	// Warn about rules that didn't match anything so they can be removed.
+	checked := map[string]bool{
+		"HTML": len(htmlPaths) > 0,
+		"AMP":  len(ampPaths) > 0,
+		"CSS":  len(cssPaths) > 0,
+		"A11y": len(a11yPaths) > 0 || len(codeContrast) > 0,
+	}
+	for _, r := range extra {
+		if r.matched == 0 && checked[r.typ] && ctx.Err() == nil {
+			logf("Validation ignore rule %v didn't match any issues\n", r)
+		}
 	}
-	for _, is := range issues {
-		logf("%s: %s %d:%d %s\n", fn, vname, is.Line, is.Col, is.Message)
-		good = false
+
+	if failed {
+		return &report, errors.New("validation failed")
 	}
-	return good
+	return &report, nil
 }
 
 // streamValidator validates the supplied data and returns a list of issues.
@@ -176,10 +384,13 @@ type validateResult struct {
 }
 
 // startValidation asynchronously validates the supplied paths.
-// v is a streamValidator or filesValidator.
+// v is a streamValidator or filesValidator, or nil if paths is empty.
 // Results are streamed to the returned channel.
 func startValidation(ctx context.Context, paths []string, v interface{}) <-chan validateResult {
 	ch := make(chan validateResult, len(paths))
+	if len(paths) == 0 {
+		return ch
+	}
 	go func() {
 		switch tv := v.(type) {
 		case streamValidator:
@@ -212,3 +423,70 @@ func validateFile(ctx context.Context, p string, v streamValidator) ([]validate.
 	defer f.Close()
 	return v.validateStream(ctx, f)
 }
+
+// vnuValidator is a filesValidator for running a local copy of the Nu Html Checker.
+type vnuValidator struct {
+	path string // path to vnu.jar or to a vnu executable
+	css  bool   // report only CSS issues rather than only non-CSS issues
+}
+
+// vnuCSSPrefix prefixes the messages of CSS issues reported by the Nu Html Checker.
+const vnuCSSPrefix = "CSS: "
+
+func (v *vnuValidator) validateFiles(ctx context.Context, files []string) (map[string][]validate.Issue, error) {
+	args := []string{"--format", "json", "--stdout", "--exit-zero-always"}
+	var cmd *exec.Cmd
+	if strings.HasSuffix(v.path, ".jar") {
+		cmd = exec.CommandContext(ctx, "java", append(append([]string{"-jar", v.path}, args...), files...)...)
+	} else {
+		cmd = exec.CommandContext(ctx, v.path, append(args, files...)...)
+	}
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("%v: %v", err, strings.TrimSpace(stderr.String()))
+	}
+	return parseVNUOutput(out, v.css)
+}
+
+// parseVNUOutput parses JSON output from the Nu Html Checker and returns issues keyed by
+// file path. If css is true, only CSS issues are returned; otherwise, only non-CSS issues are.
+func parseVNUOutput(b []byte, css bool) (map[string][]validate.Issue, error) {
+	var out struct {
+		Messages []struct {
+			Type        string `json:"type"`
+			SubType     string `json:"subType"`
+			URL         string `json:"url"`
+			LastLine    int    `json:"lastLine"`
+			FirstColumn int    `json:"firstColumn"`
+			Message     string `json:"message"`
+		} `json:"messages"`
+	}
+	if err := json.Unmarshal(b, &out); err != nil {
+		return nil, fmt.Errorf("bad output: %v", err)
+	}
+	issues := make(map[string][]validate.Issue)
+	for _, msg := range out.Messages {
+		switch {
+		case msg.Type == "non-document-error":
+			return nil, fmt.Errorf("%v: %v", msg.URL, msg.Message)
+		case msg.Type == "info" && msg.SubType != "warning":
+			continue
+		}
+		text := strings.TrimPrefix(msg.Message, vnuCSSPrefix)
+		if (text != msg.Message) != css {
+			continue
+		}
+		u, err := url.Parse(msg.URL)
+		if err != nil {
+			return nil, fmt.Errorf("bad URL %q: %v", msg.URL, err)
+		}
+		issues[u.Path] = append(issues[u.Path], validate.Issue{
+			Line:    msg.LastLine,
+			Col:     msg.FirstColumn,
+			Message: text,
+		})
+	}
+	return issues, nil
+}
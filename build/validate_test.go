@@ -0,0 +1,290 @@
+// Copyright 2023 Daniel Erat.
+// All rights reserved.
+
+package build
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/derat/intransigence/render"
+	"github.com/derat/validate"
+)
+
+func TestVNUValidator(t *testing.T) {
+	dir, err := ioutil.TempDir("", "validate_test.")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// Write a fake vnu executable that prints canned JSON output.
+	a, b := filepath.Join(dir, "a.html"), filepath.Join(dir, "b.html")
+	exe := filepath.Join(dir, "vnu")
+	if err := ioutil.WriteFile(exe, []byte(fmt.Sprintf(`#!/bin/sh
+cat <<EOF
+{"messages":[
+  {"type":"error","url":"file:%s","lastLine":3,"firstColumn":5,"message":"Stray end tag div."},
+  {"type":"info","subType":"warning","url":"file:%s","lastLine":4,"firstColumn":1,"message":"Consider adding a lang attribute."},
+  {"type":"info","url":"file:%s","lastLine":5,"firstColumn":1,"message":"Trailing slash on void elements has no effect."},
+  {"type":"error","url":"file:%s","lastLine":7,"firstColumn":2,"message":"CSS: color: Bad value."}
+]}
+EOF
+`, a, a, a, b)), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	files := []string{a, b}
+	for _, tc := range []struct {
+		css  bool
+		want map[string][]string
+	}{
+		{false, map[string][]string{a: {"3:5 Stray end tag div.", "4:1 Consider adding a lang attribute."}}},
+		{true, map[string][]string{b: {"7:2 color: Bad value."}}},
+	} {
+		res, err := (&vnuValidator{exe, tc.css}).validateFiles(context.Background(), files)
+		if err != nil {
+			t.Fatalf("validateFiles with css=%v failed: %v", tc.css, err)
+		}
+		got := make(map[string][]string)
+		for p, issues := range res {
+			for _, is := range issues {
+				got[p] = append(got[p], fmt.Sprintf("%d:%d %s", is.Line, is.Col, is.Message))
+			}
+		}
+		if !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("validateFiles with css=%v returned %q; want %q", tc.css, got, tc.want)
+		}
+	}
+}
+
+func TestValidateReport(t *testing.T) {
+	report := validateReport{Validator: BuiltinValidator}
+	ignore := []*ignoreRule{{typ: "HTML", re: regexp.MustCompile(`^Ignored`)}}
+	if !report.add("HTML", "b.html", validateResult{}, ignore) {
+		t.Error("add reported problems for file without issues")
+	}
+	if report.add("HTML", "a.html", validateResult{issues: []validate.Issue{
+		{Line: 4, Col: 2, Message: "Bad thing."},
+		{Line: 1, Col: 3, Message: "Ignored thing."},
+	}}, ignore) {
+		t.Error("add didn't report problems for file with unignored issue")
+	}
+	if report.add("CSS", "a.html", validateResult{err: errors.New("broken")}, nil) {
+		t.Error("add didn't report problems for failed validator")
+	}
+	report.sort()
+
+	want := []validateIssue{
+		{Type: "CSS", File: "a.html", Message: "broken", Failed: true},
+		{Type: "HTML", File: "a.html", Line: 1, Col: 3, Message: "Ignored thing.", IgnoredBy: "^Ignored"},
+		{Type: "HTML", File: "a.html", Line: 4, Col: 2, Message: "Bad thing."},
+	}
+	if !reflect.DeepEqual(report.Issues, want) {
+		t.Errorf("Report has issues %+v; want %+v", report.Issues, want)
+	}
+
+	var jb bytes.Buffer
+	if err := report.writeJSON(&jb); err != nil {
+		t.Fatal("writeJSON failed:", err)
+	}
+	var got validateReport
+	if err := json.Unmarshal(jb.Bytes(), &got); err != nil {
+		t.Fatal("Failed unmarshaling JSON report:", err)
+	} else if !reflect.DeepEqual(got, report) {
+		t.Errorf("JSON report unmarshaled to %+v; want %+v", got, report)
+	}
+
+	var xb bytes.Buffer
+	if err := report.writeJUnit(&xb); err != nil {
+		t.Fatal("writeJUnit failed:", err)
+	}
+	for _, s := range []string{
+		`<testsuites name="validate (builtin)" tests="4" failures="1" errors="1" skipped="1">`,
+		`<testsuite name="CSS" tests="1" failures="0" errors="1" skipped="0">`,
+		`<error message="broken" type="validator_failed"></error>`,
+		`<testcase name="a.html:1:3" classname="HTML" file="a.html" line="1">`,
+		`<skipped message="Ignored thing. (ignored by ^Ignored)"></skipped>`,
+		`<failure message="Bad thing." type="HTML"></failure>`,
+		`<testcase name="b.html" classname="HTML" file="b.html"></testcase>`,
+	} {
+		if !strings.Contains(xb.String(), s) {
+			t.Errorf("JUnit report doesn't contain %q:\n%s", s, xb.String())
+		}
+	}
+}
+
+// fakeValidator is a streamValidator that returns an issue for each line of the validated data.
+type fakeValidator struct{}
+
+func (v *fakeValidator) validateStream(ctx context.Context, r io.Reader) ([]validate.Issue, error) {
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	var issues []validate.Issue
+	for i, ln := range strings.Split(strings.TrimSpace(string(b)), "\n") {
+		issues = append(issues, validate.Issue{Line: i + 1, Col: 1, Message: ln})
+	}
+	return issues, nil
+}
+
+func TestIgnoreRules(t *testing.T) {
+	now := time.Date(2023, 6, 15, 12, 0, 0, 0, time.Local)
+	for _, r := range []render.ValidationIgnore{
+		{Type: "xml", Message: "foo"},
+		{Type: "html", Message: "("},
+		{Type: "html", Message: "foo", Files: "["},
+		{Type: "html", Message: "foo", Expires: "June 1"},
+	} {
+		if _, err := newIgnoreRules([]render.ValidationIgnore{r}, now); err == nil {
+			t.Errorf("newIgnoreRules unexpectedly accepted %+v", r)
+		}
+	}
+
+	rules, err := newIgnoreRules([]render.ValidationIgnore{
+		{Type: "HTML", Message: "^Unused"},
+		{Type: "html", Message: "^Sub", Files: "sub/*.html"},
+		{Type: "html", Message: "^Base", Files: "b.html", Expires: "2023-06-15"},
+		{Type: "html", Message: "^Expired", Expires: "2023-06-14"},
+		{Type: "css", Message: "^Base"},
+	}, now)
+	if err != nil {
+		t.Fatal("newIgnoreRules failed:", err)
+	}
+	if len(rules) != 4 {
+		t.Fatalf("newIgnoreRules returned %d rule(s); want 4 (expired rule omitted)", len(rules))
+	}
+
+	dir, err := ioutil.TempDir("", "validate_test.")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if err := os.MkdirAll(filepath.Join(dir, "sub"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	var paths []string
+	for fn, data := range map[string]string{
+		"a.html":     "Sub a\nBase a\n",
+		"sub/b.html": "Sub b\nBase b\nExpired b\n",
+	} {
+		p := filepath.Join(dir, fn)
+		if err := ioutil.WriteFile(p, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+		paths = append(paths, p)
+	}
+
+	backend := &validatorBackend{name: "fake", html: &fakeValidator{}}
+	report, err := validateFiles(context.Background(), paths, backend, nil, rules, nil)
+	if err == nil {
+		t.Error("validateFiles unexpectedly succeeded")
+	}
+	var got []string
+	for _, is := range report.Issues {
+		got = append(got, fmt.Sprintf("%s %d %q", is.File, is.Line, is.IgnoredBy))
+	}
+	if want := []string{
+		`a.html 1 ""`,
+		`a.html 2 ""`,
+		`sub/b.html 1 "^Sub"`,
+		`sub/b.html 2 "^Base"`,
+		`sub/b.html 3 ""`,
+	}; !reflect.DeepEqual(got, want) {
+		t.Errorf("validateFiles reported %q; want %q", got, want)
+	}
+	for i, want := range []int{0, 1, 1, 0} {
+		if rules[i].matched != want {
+			t.Errorf("Rule %v matched %d issue(s); want %d", rules[i], rules[i].matched, want)
+		}
+	}
+}
+
+// countingValidator is a streamValidator that wraps fakeValidator and counts calls.
+type countingValidator struct {
+	fakeValidator
+	calls int
+}
+
+func (v *countingValidator) validateStream(ctx context.Context, r io.Reader) ([]validate.Issue, error) {
+	v.calls++
+	return v.fakeValidator.validateStream(ctx, r)
+}
+
+func TestValidateCache(t *testing.T) {
+	dir, err := ioutil.TempDir("", "validate_test.")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	a, b := filepath.Join(dir, "a.html"), filepath.Join(dir, "b.html")
+	write := func(p, data string) {
+		if err := ioutil.WriteFile(p, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write(a, "Issue a\n")
+	write(b, "Issue b\n")
+
+	// run validates a and b using a cache with the supplied key and returns the number of
+	// validated files and the reported issues.
+	run := func(key string, force bool) (int, []string) {
+		cache, err := loadValidateCache(dir, key, force)
+		if err != nil {
+			t.Fatal("loadValidateCache failed:", err)
+		}
+		v := &countingValidator{}
+		backend := &validatorBackend{name: "fake", html: v}
+		report, _ := validateFiles(context.Background(), []string{a, b}, backend, cache, nil, nil)
+		if err := cache.save(); err != nil {
+			t.Fatal("save failed:", err)
+		}
+		var issues []string
+		for _, is := range report.Issues {
+			issues = append(issues, is.File+" "+is.Message)
+		}
+		return v.calls, issues
+	}
+
+	for _, tc := range []struct {
+		desc   string
+		update string // new contents for b
+		key    string
+		force  bool
+		calls  int
+		issues []string
+	}{
+		{"initial", "", "1", false, 2, []string{"a.html Issue a", "b.html Issue b"}},
+		{"unchanged", "", "1", false, 0, []string{"a.html Issue a", "b.html Issue b"}},
+		{"changed", "Changed b\n", "1", false, 1, []string{"a.html Issue a", "b.html Changed b"}},
+		{"reverted", "Issue b\n", "1", false, 1, []string{"a.html Issue a", "b.html Issue b"}},
+		{"forced", "", "1", true, 2, []string{"a.html Issue a", "b.html Issue b"}},
+		{"new key", "", "2", false, 2, []string{"a.html Issue a", "b.html Issue b"}},
+		{"after new key", "", "2", false, 0, []string{"a.html Issue a", "b.html Issue b"}},
+	} {
+		if tc.update != "" {
+			write(b, tc.update)
+		}
+		calls, issues := run(tc.key, tc.force)
+		if calls != tc.calls {
+			t.Errorf("%s: validated %d file(s); want %d", tc.desc, calls, tc.calls)
+		}
+		if !reflect.DeepEqual(issues, tc.issues) {
+			t.Errorf("%s: got issues %q; want %q", tc.desc, issues, tc.issues)
+		}
+	}
+}
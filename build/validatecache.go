@@ -0,0 +1,161 @@
+// Copyright 2023 Daniel Erat.
+// All rights reserved.
+
+package build
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/derat/validate"
+)
+
+const validateCacheFile = "validate.json" // file under cacheSubdir containing validation results
+
+// validateCacheVersion is included in the validation cache's key. It must be incremented
+// whenever the format of cached results changes.
+const validateCacheVersion = 1
+
+// validateCache records the results of validating files so that files whose contents
+// haven't changed don't need to be validated again in later builds.
+// Its methods are not safe for concurrent use, and a nil *validateCache never reports hits.
+type validateCache struct {
+	// Key identifies the executable and configuration used to validate files.
+	// If it changes, all entries are discarded.
+	Key string `json:"key"`
+	// Entries contains the issues that were found in files, keyed by the string returned by
+	// entryKey. Files without any issues have empty slices.
+	Entries map[string][]validate.Issue `json:"entries"`
+
+	siteDir  string              // site dir containing cacheSubdir
+	used     map[string]struct{} // keys from Entries used during the current build
+	hashes   map[string]string   // memoized results from hash, keyed by path
+	modified bool                // Entries has been changed
+}
+
+// loadValidateCache loads the validation cache from siteDir.
+// If force is true or the cache doesn't exist or was written with a different key,
+// an empty cache is returned.
+func loadValidateCache(siteDir, key string, force bool) (*validateCache, error) {
+	c := &validateCache{
+		Key:     key,
+		Entries: make(map[string][]validate.Issue),
+		siteDir: siteDir,
+		used:    make(map[string]struct{}),
+		hashes:  make(map[string]string),
+	}
+	if force {
+		c.modified = true
+		return c, nil
+	}
+	b, err := ioutil.ReadFile(filepath.Join(siteDir, cacheSubdir, validateCacheFile))
+	if os.IsNotExist(err) {
+		return c, nil
+	} else if err != nil {
+		return nil, err
+	}
+	var old validateCache
+	if err := json.Unmarshal(b, &old); err != nil {
+		logf("Ignoring bad validation cache: %v\n", err)
+		c.modified = true
+		return c, nil
+	}
+	if old.Key != key {
+		c.modified = true
+		return c, nil
+	}
+	for k, issues := range old.Entries {
+		c.Entries[k] = issues
+	}
+	return c, nil
+}
+
+// entryKey returns the key used in Entries for the file at p when validated by
+// validator (a backend name) for type typ (e.g. "HTML").
+func (c *validateCache) entryKey(validator, typ, p string) (string, error) {
+	h, ok := c.hashes[p]
+	if !ok {
+		b, err := ioutil.ReadFile(p)
+		if err != nil {
+			return "", err
+		}
+		sum := sha256.Sum256(b)
+		h = hex.EncodeToString(sum[:])
+		c.hashes[p] = h
+	}
+	return validator + "/" + typ + ":" + h, nil
+}
+
+// get returns the cached issues for the file at p.
+// The boolean return value is false if the file's current contents haven't been validated.
+func (c *validateCache) get(validator, typ, p string) ([]validate.Issue, bool, error) {
+	if c == nil {
+		return nil, false, nil
+	}
+	key, err := c.entryKey(validator, typ, p)
+	if err != nil {
+		return nil, false, err
+	}
+	issues, ok := c.Entries[key]
+	if ok {
+		c.used[key] = struct{}{}
+	}
+	return issues, ok, nil
+}
+
+// put records the issues that were found in the file at p.
+func (c *validateCache) put(validator, typ, p string, issues []validate.Issue) error {
+	if c == nil {
+		return nil
+	}
+	key, err := c.entryKey(validator, typ, p)
+	if err != nil {
+		return err
+	}
+	if issues == nil {
+		issues = []validate.Issue{}
+	}
+	c.Entries[key] = issues
+	c.used[key] = struct{}{}
+	c.modified = true
+	return nil
+}
+
+// save removes entries that weren't used during the current build and writes the cache to disk.
+func (c *validateCache) save() error {
+	if c == nil {
+		return nil
+	}
+	for k := range c.Entries {
+		if _, ok := c.used[k]; !ok {
+			delete(c.Entries, k)
+			c.modified = true
+		}
+	}
+	if !c.modified {
+		return nil
+	}
+
+	b, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return err
+	}
+	dir := filepath.Join(c.siteDir, cacheSubdir)
+	if err := os.MkdirAll(dir, dirMode); err != nil {
+		return err
+	}
+	// Write to a temp file first so a partially-written cache won't be loaded.
+	tp := filepath.Join(dir, validateCacheFile+".tmp")
+	if err := ioutil.WriteFile(tp, append(b, '\n'), fileMode); err != nil {
+		return err
+	}
+	if err := os.Rename(tp, filepath.Join(dir, validateCacheFile)); err != nil {
+		return err
+	}
+	c.modified = false
+	return nil
+}
@@ -0,0 +1,231 @@
+// Copyright 2023 Daniel Erat.
+// All rights reserved.
+
+package build
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+)
+
+// validateIssue describes an issue reported while validating a file.
+type validateIssue struct {
+	Type      string `json:"type"` // type of validation, e.g. "HTML" or "CSS"
+	File      string `json:"file"` // path relative to the validated files' common dir
+	Line      int    `json:"line"`
+	Col       int    `json:"column"`
+	Message   string `json:"message"`
+	Failed    bool   `json:"validator_failed,omitempty"` // validator itself failed; Message has error
+	IgnoredBy string `json:"ignored_by,omitempty"`       // regexp that suppressed the issue
+}
+
+// validatedFile identifies a file that was validated.
+type validatedFile struct {
+	Type string `json:"type"`
+	File string `json:"file"`
+}
+
+// validateReport describes the results of validating files.
+type validateReport struct {
+	Validator string          `json:"validator"` // backend name, e.g. W3CValidator
+	Files     []validatedFile `json:"files"`
+	Issues    []validateIssue `json:"issues"` // includes ignored issues
+}
+
+// add records res and logs issues from it that are not matched by a rule in ignore.
+// vname describes the type of validation being performed, e.g. "HTML".
+// fn contains the slash-separated path of the validated file to report.
+// Returns true if no problems were found.
+func (r *validateReport) add(vname, fn string, res validateResult, ignore []*ignoreRule) bool {
+	good := true
+	r.Files = append(r.Files, validatedFile{vname, fn})
+	if res.err != nil {
+		logf("%s: %s validator failed: %v\n", fn, vname, res.err)
+		r.Issues = append(r.Issues, validateIssue{Type: vname, File: fn, Message: res.err.Error(), Failed: true})
+		good = false
+	}
+	for _, is := range res.issues {
+		vi := validateIssue{Type: vname, File: fn, Line: is.Line, Col: is.Col, Message: is.Message}
+		for _, ig := range ignore {
+			if ig.matches(fn, is.Message) {
+				vi.IgnoredBy = ig.re.String()
+				ig.matched++
+				break
+			}
+		}
+		if vi.IgnoredBy == "" {
+			logf("%s: %s %d:%d %s\n", fn, vname, is.Line, is.Col, is.Message)
+			good = false
+		}
+		r.Issues = append(r.Issues, vi)
+	}
+	return good
+}
+
+// sort sorts r's files and issues by type, file, and position.
+func (r *validateReport) sort() {
+	sort.Slice(r.Files, func(i, j int) bool {
+		a, b := r.Files[i], r.Files[j]
+		if a.Type != b.Type {
+			return a.Type < b.Type
+		}
+		return a.File < b.File
+	})
+	sort.SliceStable(r.Issues, func(i, j int) bool {
+		a, b := r.Issues[i], r.Issues[j]
+		switch {
+		case a.Type != b.Type:
+			return a.Type < b.Type
+		case a.File != b.File:
+			return a.File < b.File
+		case a.Line != b.Line:
+			return a.Line < b.Line
+		default:
+			return a.Col < b.Col
+		}
+	})
+}
+
+// writeFiles writes r as JSON to prefix+".json" and as JUnit XML to prefix+".xml".
+func (r *validateReport) writeFiles(prefix string) error {
+	for _, f := range []struct {
+		ext   string
+		write func(io.Writer) error
+	}{
+		{".json", r.writeJSON},
+		{".xml", r.writeJUnit},
+	} {
+		w, err := os.Create(prefix + f.ext)
+		if err != nil {
+			return err
+		}
+		if err := f.write(w); err != nil {
+			w.Close()
+			return err
+		}
+		if err := w.Close(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeJSON writes r to w as JSON.
+func (r *validateReport) writeJSON(w io.Writer) error {
+	b, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(append(b, '\n'))
+	return err
+}
+
+// JUnit XML types used by writeJUnit.
+type junitSuites struct {
+	XMLName  xml.Name     `xml:"testsuites"`
+	Name     string       `xml:"name,attr"`
+	Tests    int          `xml:"tests,attr"`
+	Failures int          `xml:"failures,attr"`
+	Errors   int          `xml:"errors,attr"`
+	Skipped  int          `xml:"skipped,attr"`
+	Suites   []junitSuite `xml:"testsuite"`
+}
+
+type junitSuite struct {
+	Name     string      `xml:"name,attr"`
+	Tests    int         `xml:"tests,attr"`
+	Failures int         `xml:"failures,attr"`
+	Errors   int         `xml:"errors,attr"`
+	Skipped  int         `xml:"skipped,attr"`
+	Cases    []junitCase `xml:"testcase"`
+}
+
+type junitCase struct {
+	Name      string       `xml:"name,attr"`
+	ClassName string       `xml:"classname,attr"`
+	File      string       `xml:"file,attr,omitempty"`
+	Line      int          `xml:"line,attr,omitempty"`
+	Failure   *junitResult `xml:"failure,omitempty"`
+	Error     *junitResult `xml:"error,omitempty"`
+	Skipped   *junitResult `xml:"skipped,omitempty"`
+}
+
+type junitResult struct {
+	Message string `xml:"message,attr"`
+	Type    string `xml:"type,attr,omitempty"`
+}
+
+// writeJUnit writes r to w as JUnit XML. Each type of validation is written as a test suite.
+// Each issue is written as a failed test case (or a skipped one if it was ignored),
+// and each file without any issues is written as a passing test case.
+func (r *validateReport) writeJUnit(w io.Writer) error {
+	root := junitSuites{Name: "validate (" + r.Validator + ")"}
+	suites := make(map[string]*junitSuite)
+	var types []string
+	getSuite := func(typ string) *junitSuite {
+		s, ok := suites[typ]
+		if !ok {
+			s = &junitSuite{Name: typ}
+			suites[typ] = s
+			types = append(types, typ)
+		}
+		return s
+	}
+
+	hasIssues := make(map[validatedFile]bool)
+	for _, is := range r.Issues {
+		s := getSuite(is.Type)
+		tc := junitCase{
+			Name:      fmt.Sprintf("%s:%d:%d", is.File, is.Line, is.Col),
+			ClassName: is.Type,
+			File:      is.File,
+			Line:      is.Line,
+		}
+		switch {
+		case is.Failed:
+			tc.Name = is.File
+			tc.Error = &junitResult{Message: is.Message, Type: "validator_failed"}
+			s.Errors++
+		case is.IgnoredBy != "":
+			tc.Skipped = &junitResult{Message: fmt.Sprintf("%s (ignored by %s)", is.Message, is.IgnoredBy)}
+			s.Skipped++
+		default:
+			tc.Failure = &junitResult{Message: is.Message, Type: is.Type}
+			s.Failures++
+		}
+		s.Cases = append(s.Cases, tc)
+		hasIssues[validatedFile{is.Type, is.File}] = true
+	}
+	for _, f := range r.Files {
+		if !hasIssues[f] {
+			s := getSuite(f.Type)
+			s.Cases = append(s.Cases, junitCase{Name: f.File, ClassName: f.Type, File: f.File})
+		}
+	}
+
+	sort.Strings(types)
+	for _, typ := range types {
+		s := suites[typ]
+		s.Tests = len(s.Cases)
+		root.Tests += s.Tests
+		root.Failures += s.Failures
+		root.Errors += s.Errors
+		root.Skipped += s.Skipped
+		root.Suites = append(root.Suites, *s)
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(&root); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
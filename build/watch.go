@@ -0,0 +1,100 @@
+// Copyright 2023 Daniel Erat.
+// All rights reserved.
+
+package build
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// watchInterval is the interval at which Watch checks for changes to the site's source files.
+const watchInterval = 500 * time.Millisecond
+
+// watchPaths contains the paths of files and dirs (relative to the site dir) that are
+// checked for changes by Watch.
+var watchPaths = []string{
+	siteFile,
+	"iframes",
+	"inline",
+	"pages",
+	"static",
+	"templates",
+}
+
+// Watch builds the site in dir and serves the output over HTTP at serverAddr.
+// The site is rebuilt whenever any of its source files change, and open non-AMP pages are
+// reloaded after each rebuild. Build failures are logged rather than returned.
+// out, flags, and opts are passed to Build, but Prompt and Serve are ignored.
+// Watch runs until ctx is cancelled or the server fails.
+func Watch(ctx context.Context, dir, out string, flags Flags, opts *Options) error {
+	serveDir := out
+	if serveDir == "" {
+		serveDir = filepath.Join(dir, outSubdir)
+	}
+	flags = (flags | LiveReload) &^ (Prompt | Serve)
+
+	srv, sch := startServer(serveDir, serverAddr)
+	logf("Serving %v at %v", serveDir, serverAddr)
+
+	var last string
+	for {
+		snap, err := snapshotFiles(dir, watchPaths)
+		if err != nil {
+			srv.Shutdown(ctx)
+			return fmt.Errorf("failed checking for changes: %v", err)
+		}
+		if snap != last {
+			last = snap
+			start := time.Now()
+			if err := Build(ctx, dir, out, flags, opts); err != nil {
+				logf("Build failed: %v", err)
+			} else {
+				logf("Built site in %v", time.Now().Sub(start).Round(time.Millisecond))
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			srv.Shutdown(context.Background())
+			<-sch
+			return ctx.Err()
+		case err := <-sch:
+			if err == http.ErrServerClosed {
+				err = nil
+			}
+			return err
+		case <-time.After(watchInterval):
+		}
+	}
+}
+
+// snapshotFiles returns a string describing the current state of the supplied files
+// (relative to dir) and the files within any dirs. Nonexistent paths are ignored.
+// The returned string changes whenever a file is added, removed, or modified.
+func snapshotFiles(dir string, paths []string) (string, error) {
+	hash := sha256.New()
+	for _, p := range paths {
+		if err := filepath.Walk(filepath.Join(dir, p), func(p string, fi os.FileInfo, err error) error {
+			if os.IsNotExist(err) {
+				return nil
+			} else if err != nil {
+				return err
+			}
+			if fi.Mode()&os.ModeType != 0 {
+				return nil
+			}
+			fmt.Fprintf(hash, "%s\x00%d\x00%d\x00", p[len(dir):], fi.Size(), fi.ModTime().UnixNano())
+			return nil
+		}); err != nil {
+			return "", err
+		}
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
@@ -0,0 +1,65 @@
+// Copyright 2023 Daniel Erat.
+// All rights reserved.
+
+package build
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestSnapshotFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "watch_test.")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	paths := []string{"site.yaml", "pages", "missing"}
+	snap := func() string {
+		s, err := snapshotFiles(dir, paths)
+		if err != nil {
+			t.Fatal("snapshotFiles failed:", err)
+		}
+		return s
+	}
+	write := func(p, data string) {
+		p = filepath.Join(dir, p)
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(p, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	write("site.yaml", "base_url: https://example.org/\n")
+	write("pages/index.md", "Hello\n")
+	orig := snap()
+	if s := snap(); s != orig {
+		t.Errorf("Snapshot changed from %v to %v without any changes", orig, s)
+	}
+
+	// Files in unwatched dirs shouldn't affect the snapshot.
+	write("out/index.html", "<p>Hello</p>\n")
+	if s := snap(); s != orig {
+		t.Errorf("Snapshot changed from %v to %v after writing unwatched file", orig, s)
+	}
+
+	write("pages/cats.md", "Meow\n")
+	added := snap()
+	if added == orig {
+		t.Error("Snapshot unchanged after adding file")
+	}
+
+	old := time.Now().Add(-time.Hour)
+	if err := os.Chtimes(filepath.Join(dir, "site.yaml"), old, old); err != nil {
+		t.Fatal(err)
+	}
+	if s := snap(); s == added {
+		t.Error("Snapshot unchanged after modifying file")
+	}
+}
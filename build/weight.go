@@ -0,0 +1,284 @@
+// Copyright 2023 Daniel Erat.
+// All rights reserved.
+
+package build
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/derat/intransigence/render"
+	"golang.org/x/net/html"
+)
+
+// ampCustomStyleLimit is the maximum size in bytes of the CSS in an AMP page's
+// <style amp-custom> element. See https://amp.dev/documentation/guides-and-tutorials/learn/spec/amphtml/#stylesheets.
+const ampCustomStyleLimit = 75000
+
+// maxWeightContributors is the maximum number of contributors listed for an exceeded budget.
+const maxWeightContributors = 3
+
+// pageWeight describes the sizes of a generated page and of the images that it uses.
+type pageWeight struct {
+	page      string // slash-separated path relative to output dir
+	html      int    // size of HTML document
+	css       int    // CSS in <style> elements
+	ampCustom int    // CSS in <style amp-custom> element
+	js        int    // JS in <script> elements without src attributes
+	images    int    // total size of images in imgs
+	imgs      []weightItem
+}
+
+// weightItem describes something that contributes to a page's weight.
+type weightItem struct {
+	name string
+	size int
+}
+
+// checkPageWeights measures the pages at the supplied out-relative paths and returns their
+// weights (sorted by path) along with descriptions of any exceeded budgets. metas contains
+// metadata from rendering the pages and is used to list the largest sources of inline CSS and JS.
+func checkPageWeights(out string, pages []string, metas map[string]*render.PageMeta,
+	budgets render.PageBudgets) ([]*pageWeight, []string, error) {
+	pages = append([]string{}, pages...)
+	sort.Strings(pages)
+
+	var weights []*pageWeight
+	var exceeded []string
+	for _, rel := range pages {
+		w, err := measurePage(out, rel)
+		if err != nil {
+			return nil, nil, fmt.Errorf("%v: %v", rel, err)
+		}
+		weights = append(weights, w)
+
+		var inline []render.InlineSource
+		if meta := metas[rel]; meta != nil {
+			inline = meta.Inline
+		}
+		check := func(desc string, size, limit int, largest []weightItem) {
+			if limit <= 0 || size <= limit {
+				return
+			}
+			msg := fmt.Sprintf("%s: %s is %d bytes; limit is %d", w.page, desc, size, limit)
+			if len(largest) > 0 {
+				msg += " (largest: " + describeWeightItems(largest) + ")"
+			}
+			exceeded = append(exceeded, msg)
+		}
+		if strings.HasSuffix(rel, render.AMPExt) {
+			check("AMP custom CSS", w.ampCustom, ampCustomStyleLimit, inlineItems(inline, "css"))
+		}
+		check("HTML", w.html, budgets.HTML, inlineItems(inline, ""))
+		check("inline CSS", w.css, budgets.InlineCSS, inlineItems(inline, "css"))
+		check("inline JS", w.js, budgets.InlineJS, inlineItems(inline, "js"))
+		check("image data", w.images, budgets.Images, largestItems(w.imgs))
+	}
+	return weights, exceeded, nil
+}
+
+// inlineItems returns the largest sources from inline with the supplied type
+// ("css" or "js", or empty for all types).
+func inlineItems(inline []render.InlineSource, typ string) []weightItem {
+	var items []weightItem
+	for _, src := range inline {
+		if typ == "" || src.Type == typ {
+			items = append(items, weightItem{src.Name, src.Size})
+		}
+	}
+	return largestItems(items)
+}
+
+// largestItems returns up to maxWeightContributors of the largest items from items.
+func largestItems(items []weightItem) []weightItem {
+	items = append([]weightItem{}, items...)
+	sort.SliceStable(items, func(i, j int) bool { return items[i].size > items[j].size })
+	if len(items) > maxWeightContributors {
+		items = items[:maxWeightContributors]
+	}
+	return items
+}
+
+// describeWeightItems returns a comma-separated list describing items.
+func describeWeightItems(items []weightItem) string {
+	strs := make([]string, len(items))
+	for i, it := range items {
+		strs[i] = fmt.Sprintf("%s %d", it.name, it.size)
+	}
+	return strings.Join(strs, ", ")
+}
+
+// writeWeightTable writes a table describing weights to w.
+func writeWeightTable(w io.Writer, weights []*pageWeight) error {
+	pw := len("Page")
+	for _, wt := range weights {
+		if len(wt.page) > pw {
+			pw = len(wt.page)
+		}
+	}
+	if _, err := fmt.Fprintf(w, "%-*s %8s %8s %8s %8s\n", pw, "Page", "HTML", "CSS", "JS", "Images"); err != nil {
+		return err
+	}
+	for _, wt := range weights {
+		if _, err := fmt.Fprintf(w, "%-*s %8d %8d %8d %8d\n",
+			pw, wt.page, wt.html, wt.css, wt.js, wt.images); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// measurePage measures the page at the out-relative path rel.
+func measurePage(out, rel string) (*pageWeight, error) {
+	b, err := ioutil.ReadFile(filepath.Join(out, rel))
+	if err != nil {
+		return nil, err
+	}
+	root, err := html.Parse(strings.NewReader(string(b)))
+	if err != nil {
+		return nil, err
+	}
+
+	w := pageWeight{page: filepath.ToSlash(rel), html: len(b)}
+	dir := path.Dir(w.page)
+	seen := make(map[string]struct{}) // out-relative image paths
+	addImage := func(n *html.Node) {
+		p := chooseImage(n, dir)
+		if p == "" {
+			return
+		}
+		if _, ok := seen[p]; ok {
+			return
+		}
+		seen[p] = struct{}{}
+		if fi, err := os.Stat(filepath.Join(out, filepath.FromSlash(p))); err == nil {
+			w.imgs = append(w.imgs, weightItem{p, int(fi.Size())})
+			w.images += int(fi.Size())
+		}
+	}
+
+	var walk func(*html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.ElementNode {
+			switch n.Data {
+			case "style":
+				size := len(nodeText(n))
+				w.css += size
+				if _, ok := getAttr(n, "amp-custom"); ok {
+					w.ampCustom += size
+				}
+			case "script":
+				typ, _ := getAttr(n, "type")
+				if _, ok := getAttr(n, "src"); !ok && !strings.Contains(typ, "json") {
+					w.js += len(nodeText(n))
+				}
+			case "picture":
+				// Use the first <source> (i.e. the preferred format) if present.
+				var img *html.Node
+				for c := n.FirstChild; c != nil; c = c.NextSibling {
+					if c.Type != html.ElementNode {
+						continue
+					}
+					if c.Data == "source" {
+						img = c
+						break
+					}
+					if c.Data == "img" && img == nil {
+						img = c
+					}
+				}
+				if img != nil {
+					addImage(img)
+				}
+				return // don't descend into the <img>
+			case "img":
+				addImage(n)
+			case "amp-img":
+				// Fallback images are only loaded if the main image can't be displayed.
+				if _, ok := getAttr(n, "fallback"); !ok {
+					addImage(n)
+				}
+			}
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(root)
+	return &w, nil
+}
+
+// chooseImage returns the out-relative path of the image that would be loaded for n,
+// an <img>, <amp-img>, or <source> element in a page in dir. An empty string is returned
+// for external and data: URLs.
+func chooseImage(n *html.Node, dir string) string {
+	src, _ := getAttr(n, "src")
+	if srcset, ok := getAttr(n, "srcset"); ok {
+		// Get the displayed width from the sizes or width attribute.
+		var width int
+		if sizes, ok := getAttr(n, "sizes"); ok && strings.HasSuffix(sizes, "px") {
+			width, _ = strconv.Atoi(strings.TrimSuffix(sizes, "px"))
+		}
+		if width == 0 {
+			ws, _ := getAttr(n, "width")
+			width, _ = strconv.Atoi(ws)
+		}
+		// Choose the narrowest candidate that's at least as wide as the displayed image,
+		// or the widest candidate if none are wide enough.
+		best, bestWidth := "", 0
+		for _, cand := range strings.Split(srcset, ",") {
+			fields := strings.Fields(cand)
+			if len(fields) == 0 {
+				continue
+			}
+			cw := 1 // treat density descriptors and missing descriptors as narrow
+			if len(fields) > 1 && strings.HasSuffix(fields[1], "w") {
+				cw, _ = strconv.Atoi(strings.TrimSuffix(fields[1], "w"))
+			}
+			if best == "" || (bestWidth < width && cw > bestWidth) || (cw >= width && cw < bestWidth) {
+				best, bestWidth = fields[0], cw
+			}
+		}
+		if best != "" {
+			src = best
+		}
+	}
+
+	u, err := url.Parse(src)
+	if err != nil || src == "" || u.Scheme != "" || u.Host != "" || u.Path == "" {
+		return ""
+	}
+	if strings.HasPrefix(u.Path, "/") {
+		return path.Clean(u.Path[1:])
+	}
+	return path.Join(dir, u.Path)
+}
+
+// getAttr returns the value of n's attribute named key.
+func getAttr(n *html.Node, key string) (string, bool) {
+	for _, a := range n.Attr {
+		if a.Key == key {
+			return a.Val, true
+		}
+	}
+	return "", false
+}
+
+// nodeText returns the concatenated contents of n's text children.
+func nodeText(n *html.Node) string {
+	var b strings.Builder
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if c.Type == html.TextNode {
+			b.WriteString(c.Data)
+		}
+	}
+	return b.String()
+}
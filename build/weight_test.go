@@ -0,0 +1,116 @@
+// Copyright 2023 Daniel Erat.
+// All rights reserved.
+
+package build
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/derat/intransigence/render"
+)
+
+func TestCheckPageWeights(t *testing.T) {
+	out, err := ioutil.TempDir("", "weight_test.")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(out)
+
+	write := func(p string, size int, data string) {
+		p = filepath.Join(out, p)
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if data == "" {
+			data = strings.Repeat("x", size)
+		}
+		if err := ioutil.WriteFile(p, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("img/a-100.webp", 100, "")
+	write("img/a-200.webp", 200, "")
+	write("img/a-100.jpg", 1000, "")
+	write("img/b.png", 50, "")
+	write("img/fallback.png", 5000, "")
+
+	css := strings.Repeat("a", 40)
+	write("page.html", 0, `<!DOCTYPE html><html><head><style>`+css+`</style>`+
+		`<script>var a=1;</script><script type="application/ld+json">{}</script>`+
+		`<script src="x.js"></script></head><body>`+
+		`<picture><source type="image/webp" sizes="150px" srcset="img/a-100.webp 100w, img/a-200.webp 200w">`+
+		`<img src="img/a-100.jpg" sizes="150px" srcset="img/a-100.jpg 100w" width="150" height="150" alt="A"></picture>`+
+		`<img src="img/b.png" width="10" height="10" alt="B"><img src="img/b.png" width="10" height="10" alt="B">`+
+		`<img src="data:image/gif;base64,R0lGODlhAQABAAAAACw=" alt="Data">`+
+		`<img src="https://www.example.org/c.png" alt="C"></body></html>`)
+	amp := `<!DOCTYPE html><html amp><head><style amp-boilerplate>body{}</style>` +
+		`<style amp-custom>` + strings.Repeat("b", ampCustomStyleLimit+1) + `</style></head><body>` +
+		`<amp-img src="img/b.png" width="10" height="10" alt="B">` +
+		`<amp-img fallback src="img/fallback.png" width="10" height="10" alt="B"></amp-img></amp-img></body></html>`
+	write("page.amp.html", 0, amp)
+
+	metas := map[string]*render.PageMeta{
+		"page.html": {Inline: []render.InlineSource{
+			{Name: "base.css (built-in)", Type: "css", Size: 10},
+			{Name: "inline/base.css", Type: "css", Size: 30},
+			{Name: "base.js (built-in)", Type: "js", Size: 8},
+		}},
+		"page.amp.html": {Inline: []render.InlineSource{
+			{Name: "amp.css (built-in)", Type: "css", Size: 5},
+			{Name: "code highlighting", Type: "css", Size: ampCustomStyleLimit - 4},
+		}},
+	}
+	weights, exceeded, err := checkPageWeights(out, []string{"page.html", "page.amp.html"}, metas,
+		render.PageBudgets{InlineCSS: 39, InlineJS: 8, Images: 250})
+	if err != nil {
+		t.Fatal("checkPageWeights failed:", err)
+	}
+
+	type weight struct {
+		page                        string
+		html, css, ampCustom, js, i int
+	}
+	var got []weight
+	for _, w := range weights {
+		got = append(got, weight{w.page, w.html, w.css, w.ampCustom, w.js, w.images})
+	}
+	if want := []weight{
+		{"page.amp.html", len(amp), ampCustomStyleLimit + 7, ampCustomStyleLimit + 1, 0, 50},
+		{"page.html", weights[1].html, 40, 0, 8, 250},
+	}; !reflect.DeepEqual(got, want) {
+		t.Errorf("checkPageWeights returned weights %+v; want %+v", got, want)
+	}
+
+	if want := []string{
+		"page.amp.html: AMP custom CSS is 75001 bytes; limit is 75000 " +
+			"(largest: code highlighting 74996, amp.css (built-in) 5)",
+		"page.amp.html: inline CSS is 75007 bytes; limit is 39 " +
+			"(largest: code highlighting 74996, amp.css (built-in) 5)",
+		"page.html: inline CSS is 40 bytes; limit is 39 " +
+			"(largest: inline/base.css 30, base.css (built-in) 10)",
+	}; !reflect.DeepEqual(exceeded, want) {
+		t.Errorf("checkPageWeights returned exceeded budgets:\n%s\nwant:\n%s",
+			strings.Join(exceeded, "\n"), strings.Join(want, "\n"))
+	}
+
+	var b strings.Builder
+	if err := writeWeightTable(&b, weights); err != nil {
+		t.Fatal("writeWeightTable failed:", err)
+	}
+	lines := strings.Split(strings.TrimSpace(b.String()), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("writeWeightTable wrote %d line(s); want 3:\n%s", len(lines), b.String())
+	}
+	if want := "Page              HTML      CSS       JS   Images"; lines[0] != want {
+		t.Errorf("writeWeightTable wrote header %q; want %q", lines[0], want)
+	}
+	if want := fmt.Sprintf("page.html     %8d       40        8      250", weights[1].html); lines[2] != want {
+		t.Errorf("writeWeightTable wrote row %q; want %q", lines[2], want)
+	}
+}
@@ -5,9 +5,13 @@ package main
 
 import (
 	"context"
+	"encoding/json"
 	"flag"
 	"fmt"
+	"io/ioutil"
 	"os"
+	"runtime"
+	"strings"
 
 	"github.com/derat/intransigence/build"
 	"github.com/derat/intransigence/render"
@@ -20,14 +24,30 @@ func main() {
 		os.Exit(1)
 	}
 	flag.StringVar(&dir, "dir", dir, "Site directory (defaults to working dir)")
+	checkExternal := flag.Bool("check-external", false, "Check links to other sites and report dead, redirected, and timed-out links")
+	compare := flag.String("compare", "", "Build into temp dir and compare against specified dir")
+	deploy := flag.String("deploy", "", "Sync output to specified dir after building")
+	deployDryRun := flag.Bool("deploy-dry-run", false, "List changes that -deploy would make without making them")
+	deployKeepStale := flag.Bool("deploy-keep-stale", false, "Don't delete stale files with -deploy")
+	deployOverwrite := flag.Bool("deploy-overwrite", false, "Allow -deploy into a non-empty dir that wasn't written by an earlier deploy")
+	diffAllow := flag.String("diff-allow", "", "Comma-separated path.Match patterns of paths allowed to change with -compare")
+	diffIgnoreSpace := flag.Bool("diff-ignore-space", false, "Omit whitespace-only changes from -prompt and -compare diffs")
+	diffReport := flag.String("diff-report", "", "Write JSON report to specified file with -compare (compares against -out or out if -compare is empty)")
+	externalTTL := flag.Duration("external-ttl", build.DefaultExternalTTL, "Maximum age of cached results for -check-external")
+	jobs := flag.Int("jobs", runtime.NumCPU(), "Maximum number of files to generate in parallel")
+	incremental := flag.Bool("incremental", true, "Reuse unchanged pages and iframes from the build cache")
 	out := flag.String("out", "", "Destination directory (site is built under -dir if empty)")
 	pretty := flag.Bool("pretty", true, "Pretty-print HTML")
 	prompt := flag.Bool("prompt", true, "Prompt with a diff before replacing dest dir (only if -out is empty)")
+	revalidate := flag.Bool("revalidate", false, "Validate all generated files instead of reusing cached results")
 	serve := flag.Bool("serve", true, "Serve output over HTTP while displaying diff")
 	thumb := flag.String("thumbnail", "", "Generate base64-encoded GIF thumbnail for specified image file")
 	thumbWidth := flag.Int("thumbnail-height", 4, "Height in pixels for -thumbnail")
 	thumbHeight := flag.Int("thumbnail-width", 4, "Width in pixels for -thumbnail")
 	validate := flag.Bool("validate", true, "Validate generated files")
+	validateReport := flag.String("validate-report", "", "Write JSON and JUnit XML validation reports to specified path plus .json and .xml")
+	validator := flag.String("validator", "", `Validator to use ("w3c", "vnu", or "builtin"; overrides site.yaml)`)
+	watch := flag.Bool("watch", false, "Serve output and rebuild when source files change")
 	flag.Parse()
 
 	if flag.NArg() != 0 {
@@ -50,20 +70,115 @@ func main() {
 	}
 
 	var flags build.Flags
+	if *checkExternal {
+		flags |= build.CheckExternal
+	}
+	if *diffIgnoreSpace {
+		flags |= build.DiffIgnoreSpace
+	}
+	if *incremental {
+		flags |= build.Incremental
+	}
 	if *pretty {
 		flags |= build.PrettyPrint
 	}
 	if *prompt {
 		flags |= build.Prompt
 	}
+	if *revalidate {
+		flags |= build.Revalidate
+	}
 	if *serve {
 		flags |= build.Serve
 	}
 	if *validate {
 		flags |= build.Validate
 	}
-	if err := build.Build(context.Background(), dir, *out, flags); err != nil {
+	opts := build.Options{Jobs: *jobs, ExternalTTL: *externalTTL, Validator: *validator,
+		ValidateReport: *validateReport}
+	if *watch {
+		if err := build.Watch(context.Background(), dir, *out, flags, &opts); err != nil {
+			fmt.Fprintln(os.Stderr, "Failed watching site:", err)
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+	if *compare != "" || *diffReport != "" {
+		os.Exit(runCompare(dir, *compare, *out, *diffReport, *diffAllow, flags, &opts))
+	}
+	if err := build.Build(context.Background(), dir, *out, flags, &opts); err != nil {
 		fmt.Fprintln(os.Stderr, "Failed to build site:", err)
 		os.Exit(1)
 	}
+
+	if *deploy != "" {
+		src := *out
+		if src == "" {
+			src = build.OutDir(dir)
+		}
+		var dflags build.DeployFlags
+		if *deployDryRun {
+			dflags |= build.DryRun
+		}
+		if *deployKeepStale {
+			dflags |= build.KeepStale
+		}
+		if *deployOverwrite {
+			dflags |= build.Overwrite
+		}
+		res, err := build.Deploy(src, *deploy, dflags)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Failed to deploy site:", err)
+			os.Exit(1)
+		}
+		for _, p := range res.Copied {
+			fmt.Println("copy  ", p)
+		}
+		for _, p := range res.Deleted {
+			fmt.Println("delete", p)
+		}
+		verb := "Deployed"
+		if *deployDryRun {
+			verb = "Would deploy"
+		}
+		fmt.Printf("%v %d changed and %d stale file(s) (%d unchanged)\n",
+			verb, len(res.Copied), len(res.Deleted), res.Unchanged)
+	}
+}
+
+// runCompare builds the site in dir and compares it against ref (or out, if ref is empty).
+// A text summary is written to stdout, and a JSON report is written to report if non-empty.
+// allow contains comma-separated patterns that are passed to build.Compare.
+// The process's exit code is returned.
+func runCompare(dir, ref, out, report, allow string, flags build.Flags, opts *build.Options) int {
+	if ref == "" {
+		ref = out
+	}
+	var pats []string
+	if allow != "" {
+		pats = strings.Split(allow, ",")
+	}
+	rep, err := build.Compare(context.Background(), dir, ref, flags, opts, pats)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Failed to compare site:", err)
+		return 1
+	}
+	if err := rep.WriteText(os.Stdout); err != nil {
+		fmt.Fprintln(os.Stderr, "Failed writing summary:", err)
+		return 1
+	}
+	if report != "" {
+		b, err := json.MarshalIndent(rep, "", "  ")
+		if err == nil {
+			err = ioutil.WriteFile(report, append(b, '\n'), 0644)
+		}
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Failed writing report:", err)
+			return 1
+		}
+	}
+	if len(rep.Unexpected) > 0 {
+		return 1
+	}
+	return 0
 }
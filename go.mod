@@ -4,9 +4,11 @@ go 1.14
 
 require (
 	github.com/alecthomas/chroma/v2 v2.2.1-0.20220831122056-dbb09a52a860
+	github.com/andybalholm/brotli v1.0.5
 	github.com/derat/htmlpretty v0.0.0-20220617151937-72210e608e0f
 	github.com/derat/validate v0.0.0-20220207210801-9c9d0eb6729e
 	github.com/gorilla/feeds v1.1.1
+	github.com/klauspost/compress v1.15.15
 	github.com/kr/pretty v0.3.0 // indirect
 	github.com/otiai10/copy v1.7.0
 	github.com/pmezard/go-difflib v1.0.0
@@ -7,6 +7,7 @@ import (
 	"bytes"
 	"fmt"
 	"io"
+	"math"
 	"strings"
 
 	"github.com/alecthomas/chroma/v2"
@@ -30,17 +31,22 @@ var chromaTokenMap = map[chroma.TokenType]chroma.TokenType{
 	chroma.NameVariableMagic:  chroma.NameVariable,  // e.g. Python __doc__
 }
 
+// minCodeContrast is the minimum contrast ratio between code text and its background.
+// See https://www.w3.org/TR/WCAG21/#contrast-minimum.
+const minCodeContrast = 4.5
+
 // getCodeCSS generates CSS class definitions for the named Chroma style.
 // baseStyle should contain the Chroma style that is passed to writeCode().
 // If selPrefix is non-empty (e.g. "body.dark "), it will be prefixed to each selector.
 // Colors will be adjusted to have a brightness within minBrightness and maxBrightness
 // in the range [0, 1]. If forcePlain is true, bold, italic, and underline formatting
-// will be removed from all style entries.
+// will be removed from all style entries. Descriptions of adjusted colors that don't
+// have enough contrast against their backgrounds are also returned.
 func getCodeCSS(style, baseStyle, selPrefix string, minBrightness, maxBrightness float64,
-	forcePlain bool) (string, error) {
+	forcePlain bool) (css string, lowContrast []string, err error) {
 	cs := styles.Get(style)
 	if cs == nil {
-		return "", fmt.Errorf("couldn't find chroma style %q", style)
+		return "", nil, fmt.Errorf("couldn't find chroma style %q", style)
 	}
 
 	// Build a new style with the token types defined in the base style.
@@ -49,7 +55,7 @@ func getCodeCSS(style, baseStyle, selPrefix string, minBrightness, maxBrightness
 	bs := cs
 	if baseStyle != style {
 		if bs = styles.Get(baseStyle); bs == nil {
-			return "", fmt.Errorf("couldn't find base chroma style %q", baseStyle)
+			return "", nil, fmt.Errorf("couldn't find base chroma style %q", baseStyle)
 		}
 	}
 
@@ -71,14 +77,14 @@ func getCodeCSS(style, baseStyle, selPrefix string, minBrightness, maxBrightness
 		}
 		sb.Add(tt, se.String())
 	}
-	var err error
 	if cs, err = sb.Build(); err != nil {
-		return "", err
+		return "", nil, err
 	}
+	lowContrast = checkCodeContrast(cs, bs.Types())
 
 	var b bytes.Buffer
 	if err := chromaFmt.WriteCSS(&b, cs); err != nil {
-		return "", err
+		return "", nil, err
 	}
 	s := b.String()
 	if selPrefix != "" {
@@ -89,7 +95,60 @@ func getCodeCSS(style, baseStyle, selPrefix string, minBrightness, maxBrightness
 		// this once per page).
 		s = strings.ReplaceAll(s, " .chroma ", selPrefix+" .chroma ")
 	}
-	return minifyData(s, ".css")
+	css, err = minifyData(s, ".css")
+	return css, lowContrast, err
+}
+
+// checkCodeContrast returns descriptions of the text colors used for types in cs that have
+// contrast ratios below minCodeContrast against their backgrounds.
+func checkCodeContrast(cs *chroma.Style, types []chroma.TokenType) []string {
+	type colors struct{ fg, bg chroma.Colour }
+	var pairs []colors                            // in order of first use
+	names := make(map[colors][]string)            // token type names keyed by color pair
+	defBG := cs.Get(chroma.Background).Background // default background color
+	for _, tt := range types {
+		se := cs.Get(tt)
+		c := colors{se.Colour, se.Background}
+		if !c.bg.IsSet() {
+			c.bg = defBG
+		}
+		if !c.fg.IsSet() || !c.bg.IsSet() || contrastRatio(c.fg, c.bg) >= minCodeContrast {
+			continue
+		}
+		if _, ok := names[c]; !ok {
+			pairs = append(pairs, c)
+		}
+		names[c] = append(names[c], tt.String())
+	}
+	var descs []string
+	for _, c := range pairs {
+		descs = append(descs, fmt.Sprintf("color %v (%s) has contrast ratio %.2f:1 against %v; want at least %.1f:1",
+			c.fg, strings.Join(names[c], ", "), contrastRatio(c.fg, c.bg), c.bg, minCodeContrast))
+	}
+	return descs
+}
+
+// contrastRatio returns the WCAG contrast ratio between a and b, in the range [1, 21].
+// See https://www.w3.org/TR/WCAG21/#dfn-contrast-ratio.
+func contrastRatio(a, b chroma.Colour) float64 {
+	la, lb := luminance(a), luminance(b)
+	if la < lb {
+		la, lb = lb, la
+	}
+	return (la + 0.05) / (lb + 0.05)
+}
+
+// luminance returns c's relative luminance in the range [0, 1].
+// See https://www.w3.org/TR/WCAG21/#dfn-relative-luminance.
+func luminance(c chroma.Colour) float64 {
+	lin := func(v uint8) float64 {
+		f := float64(v) / 255
+		if f <= 0.03928 {
+			return f / 12.92
+		}
+		return math.Pow((f+0.055)/1.055, 2.4)
+	}
+	return 0.2126*lin(c.Red()) + 0.7152*lin(c.Green()) + 0.0722*lin(c.Blue())
 }
 
 // writeCode performs syntax highlighting on the supplied code and writes the corresponding HTML
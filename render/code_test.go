@@ -0,0 +1,38 @@
+// Copyright 2023 Daniel Erat.
+// All rights reserved.
+
+package render
+
+import (
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/alecthomas/chroma/v2"
+)
+
+func TestContrastRatio(t *testing.T) {
+	for _, tc := range []struct {
+		a, b string
+		want float64
+	}{
+		{"#000000", "#ffffff", 21},
+		{"#ffffff", "#000000", 21},
+		{"#777777", "#777777", 1},
+		{"#767676", "#ffffff", 4.54},
+	} {
+		if got := contrastRatio(chroma.ParseColour(tc.a), chroma.ParseColour(tc.b)); math.Abs(got-tc.want) > 0.01 {
+			t.Errorf("contrastRatio(%v, %v) = %0.3f; want %0.2f", tc.a, tc.b, got, tc.want)
+		}
+	}
+}
+
+func TestGetCodeCSS_LowContrast(t *testing.T) {
+	_, low, err := getCodeCSS("github", "github", "", 0, codeMaxBrightnessLight, false)
+	if err != nil {
+		t.Fatal("getCodeCSS failed:", err)
+	}
+	if len(low) != 1 || !strings.HasPrefix(low[0], "color #009926 (LiteralStringRegex) has contrast ratio 3.76:1") {
+		t.Errorf("getCodeCSS reported low contrast %q", low)
+	}
+}
@@ -0,0 +1,44 @@
+// Copyright 2023 Daniel Erat.
+// All rights reserved.
+
+package render
+
+import (
+	"sort"
+	"sync"
+)
+
+// Deps records the paths of files that are consulted while rendering a page or iframe.
+// Paths containing '*' are glob patterns whose set of matching files was consulted.
+// A nil *Deps silently discards paths. Deps is safe for concurrent use.
+type Deps struct {
+	mu    sync.Mutex
+	paths map[string]struct{}
+}
+
+// add records the supplied paths.
+func (d *Deps) add(paths ...string) {
+	if d == nil {
+		return
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.paths == nil {
+		d.paths = make(map[string]struct{})
+	}
+	for _, p := range paths {
+		d.paths[p] = struct{}{}
+	}
+}
+
+// Paths returns the recorded paths in ascending order.
+func (d *Deps) Paths() []string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	ps := make([]string, 0, len(d.paths))
+	for p := range d.paths {
+		ps = append(ps, p)
+	}
+	sort.Strings(ps)
+	return ps
+}
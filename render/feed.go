@@ -0,0 +1,115 @@
+// Copyright 2023 Daniel Erat.
+// All rights reserved.
+
+package render
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// urlAttrs lists attributes containing URLs that are rewritten by feedContent.
+var urlAttrs = map[string]bool{"href": true, "src": true, "poster": true, "action": true}
+
+// feedContent extracts the contents of the <main> element from the non-AMP page in doc for use
+// in feed entries. Relative URLs are resolved against base (the page's absolute URL), and AMP-only
+// markup (which is included in comments), AMP elements, inline scripts, and event handlers are removed.
+func feedContent(doc []byte, base string) (string, error) {
+	bu, err := url.Parse(base)
+	if err != nil {
+		return "", err
+	}
+	// Disable scripting so that <noscript> contents (e.g. image fallbacks) are parsed as
+	// elements and their URLs can be resolved.
+	root, err := html.ParseWithOptions(bytes.NewReader(doc), html.ParseOptionEnableScripting(false))
+	if err != nil {
+		return "", err
+	}
+	content := findElement(root, "main")
+	if content == nil {
+		return "", errors.New("no <main> element")
+	}
+
+	resolve := func(s string) (string, error) {
+		u, err := url.Parse(strings.TrimSpace(s))
+		if err != nil {
+			return "", fmt.Errorf("bad URL %q: %v", s, err)
+		}
+		return bu.ResolveReference(u).String(), nil
+	}
+
+	var clean func(n *html.Node) error
+	clean = func(n *html.Node) error {
+		for c := n.FirstChild; c != nil; {
+			next := c.NextSibling
+			if c.Type == html.CommentNode || (c.Type == html.ElementNode &&
+				(c.Data == "script" || strings.HasPrefix(c.Data, "amp-"))) {
+				n.RemoveChild(c)
+				c = next
+				continue
+			}
+			if c.Type == html.ElementNode {
+				var attrs []html.Attribute
+				for _, a := range c.Attr {
+					switch {
+					case strings.HasPrefix(a.Key, "on"):
+						continue
+					case urlAttrs[a.Key]:
+						if a.Val, err = resolve(a.Val); err != nil {
+							return err
+						}
+					case a.Key == "srcset":
+						cands := strings.Split(a.Val, ",")
+						for i, cand := range cands {
+							fields := strings.Fields(cand)
+							if len(fields) == 0 {
+								continue
+							}
+							if fields[0], err = resolve(fields[0]); err != nil {
+								return err
+							}
+							cands[i] = strings.Join(fields, " ")
+						}
+						a.Val = strings.Join(cands, ", ")
+					}
+					attrs = append(attrs, a)
+				}
+				c.Attr = attrs
+				if err := clean(c); err != nil {
+					return err
+				}
+			}
+			c = next
+		}
+		return nil
+	}
+	if err := clean(content); err != nil {
+		return "", err
+	}
+
+	var b bytes.Buffer
+	for c := content.FirstChild; c != nil; c = c.NextSibling {
+		if err := html.Render(&b, c); err != nil {
+			return "", err
+		}
+	}
+	return strings.TrimSpace(b.String()), nil
+}
+
+// findElement returns the first element named name in the tree rooted at n, or nil if none exists.
+func findElement(n *html.Node, name string) *html.Node {
+	if n.Type == html.ElementNode && n.Data == name {
+		return n
+	}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if m := findElement(c, name); m != nil {
+			return m
+		}
+	}
+	return nil
+}
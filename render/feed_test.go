@@ -0,0 +1,47 @@
+// Copyright 2023 Daniel Erat.
+// All rights reserved.
+
+package render
+
+import "testing"
+
+func TestFeedContent(t *testing.T) {
+	const doc = `<!DOCTYPE html>
+<html><head><script>var head = 1;</script></head>
+<body><header><a href="index.html">Home</a></header>
+<main>
+<p><a href="other.html#frag" onclick="go()">Other</a> <a href="#top">Top</a>
+<a href="https://example.com/">External</a></p>
+<!-- AMP-only content
+<p>AMP</p>
+-->
+<picture><source srcset="img/a-100.webp 100w, img/a-200.webp 200w">
+<img src="img/a-100.jpg" alt="A"></picture>
+<script>var body = 1;</script><amp-img src="img/b.png"></amp-img>
+<noscript><img src="img/c.png" alt="C"></noscript>
+</main>
+<footer>Footer</footer>
+</body></html>`
+
+	got, err := feedContent([]byte(doc), "https://www.example.org/sub/page.html")
+	if err != nil {
+		t.Fatal("feedContent failed:", err)
+	}
+	const want = `<p><a href="https://www.example.org/sub/other.html#frag">Other</a> ` +
+		`<a href="https://www.example.org/sub/page.html#top">Top</a>
+<a href="https://example.com/">External</a></p>
+
+<picture><source srcset="https://www.example.org/sub/img/a-100.webp 100w, ` +
+		`https://www.example.org/sub/img/a-200.webp 200w"/>
+<img src="https://www.example.org/sub/img/a-100.jpg" alt="A"/></picture>
+
+<noscript><img src="https://www.example.org/sub/img/c.png" alt="C"/></noscript>`
+	if got != want {
+		t.Errorf("feedContent returned:\n%s\nwant:\n%s", got, want)
+	}
+
+	if _, err := feedContent([]byte("<html><body><p>No main</p></body></html>"),
+		"https://www.example.org/"); err == nil {
+		t.Error("feedContent unexpectedly succeeded for page without <main>")
+	}
+}
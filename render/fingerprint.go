@@ -0,0 +1,125 @@
+// Copyright 2023 Daniel Erat.
+// All rights reserved.
+
+package render
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// fingerprintLen is the number of hex digits from a file's SHA-256 hash that are
+// included in its fingerprinted name.
+const fingerprintLen = 6
+
+// FingerprintPath returns the content-hashed version of the static path p
+// (e.g. "img/logo-460.png") for a file containing data (e.g. "img/logo-460.3f2a9c.png").
+func FingerprintPath(p string, data []byte) string {
+	sum := sha256.Sum256(data)
+	return removeExt(p) + "." + hex.EncodeToString(sum[:])[:fingerprintLen] + filepath.Ext(p)
+}
+
+// fingerprintCache holds fingerprinted paths of static files so that each file
+// only needs to be hashed once per build. It is shared by copies of a SiteInfo.
+type fingerprintCache struct {
+	mu    sync.Mutex
+	paths map[string]string // keys are original static paths
+}
+
+// checkFingerprintPatterns returns an error if any of si.FingerprintStatic's patterns are invalid.
+func (si *SiteInfo) checkFingerprintPatterns() error {
+	for _, pat := range si.FingerprintStatic {
+		if _, err := path.Match(pat, ""); err != nil {
+			return fmt.Errorf("bad fingerprint_static pattern %q: %v", pat, err)
+		}
+	}
+	return nil
+}
+
+// ShouldFingerprint returns true if the static path p (e.g. "img/logo.png") is matched by
+// si.FingerprintStatic. Files copied from si.ExtraStaticDirs are never fingerprinted.
+func (si *SiteInfo) ShouldFingerprint(p string) bool {
+	p = filepath.ToSlash(p)
+	for _, dst := range si.ExtraStaticDirs {
+		if p == dst || strings.HasPrefix(p, dst+"/") {
+			return false
+		}
+	}
+	for _, pat := range si.FingerprintStatic {
+		if ok, _ := path.Match(pat, p); ok {
+			return true
+		}
+		// Match patterns without slashes (e.g. "*.png") against base names.
+		if !strings.Contains(pat, "/") {
+			if ok, _ := path.Match(pat, path.Base(p)); ok {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// staticURL returns the path that should be used to refer to the static file at p
+// (e.g. "img/logo.png") in generated output. If p should be fingerprinted, the
+// fingerprinted path is returned. Otherwise, p is returned unchanged.
+// Callers should check p's existence via CheckStatic first.
+func (si *SiteInfo) staticURL(p string) (string, error) {
+	if p == "" || !si.ShouldFingerprint(p) {
+		return p, nil
+	}
+
+	si.fingerprints.mu.Lock()
+	defer si.fingerprints.mu.Unlock()
+	if fp, ok := si.fingerprints.paths[p]; ok {
+		return fp, nil
+	}
+	// Prefer the generated file since it's copied over the static one.
+	fn := filepath.Join(si.StaticGenDir(), p)
+	b, err := ioutil.ReadFile(fn)
+	if err != nil {
+		fn = filepath.Join(si.StaticDir(), p)
+		if b, err = ioutil.ReadFile(fn); err != nil {
+			return "", fmt.Errorf("failed fingerprinting %v: %v", p, err)
+		}
+	}
+	fp := FingerprintPath(p, b)
+	si.fingerprints.paths[p] = fp
+	return fp, nil
+}
+
+// relStaticURL is like staticURL, but p is relative to the directory dir within the output dir
+// (e.g. "../img/logo.png" for dir "iframes"). The returned path is also relative to dir.
+func (si *SiteInfo) relStaticURL(p, dir string) (string, error) {
+	fp, err := si.staticURL(filepath.Join(dir, p))
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(filepath.Dir(p), filepath.Base(fp)), nil
+}
+
+// srcsetURLs rewrites the static paths in srcset (e.g. "a-100.png 100w, a-200.png 200w")
+// using staticURL.
+func (si *SiteInfo) srcsetURLs(srcset string) (string, error) {
+	if srcset == "" {
+		return "", nil
+	}
+	parts := strings.Split(srcset, ", ")
+	for i, part := range parts {
+		p, desc := part, ""
+		if idx := strings.LastIndexByte(part, ' '); idx != -1 {
+			p, desc = part[:idx], part[idx:]
+		}
+		fp, err := si.staticURL(p)
+		if err != nil {
+			return "", err
+		}
+		parts[i] = fp + desc
+	}
+	return strings.Join(parts, ", "), nil
+}
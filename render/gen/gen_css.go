@@ -0,0 +1,35 @@
+// Copyright 2023 Daniel Erat.
+// All rights reserved.
+
+//go:build ignore
+// +build ignore
+
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/derat/intransigence/scss"
+)
+
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Fprintf(os.Stderr, "Usage: %s [file.scss]...\n", os.Args[0])
+		os.Exit(2)
+	}
+
+	// This matches generateCSS() in the build package.
+	for _, p := range os.Args[1:] {
+		css, _, err := scss.CompileFile(p)
+		if err != nil {
+			log.Fatal("Failed compiling SCSS: ", err)
+		}
+		if err := ioutil.WriteFile(strings.TrimSuffix(p, ".scss")+".css", []byte(css), 0644); err != nil {
+			log.Fatal("Failed writing CSS: ", err)
+		}
+	}
+}
@@ -47,7 +47,7 @@ func Iframe(si SiteInfo, yb []byte) ([]byte, error) {
 		return nil, err
 	}
 
-	tmpl := newTemplater(filepath.Join(si.TemplateDir()), nil)
+	tmpl := newTemplater(filepath.Join(si.TemplateDir()), si.deps, nil)
 
 	var b bytes.Buffer
 	switch {
@@ -16,6 +16,7 @@ import (
 	"io"
 	"os"
 	"path/filepath"
+	"reflect"
 	"sort"
 	"strconv"
 	"strings"
@@ -36,6 +37,7 @@ type imgInfo struct {
 	Height int    `html:"height" yaml:"height"` // 100% height in pixels; inferred if empty
 	Alt    string `html:"alt" yaml:"alt"`       // alt text
 	Lazy   bool   `html:"lazy" yaml:"lazy"`     // whether image should be lazy-loaded
+	Widths []int  `yaml:"widths"`               // widths to scale a single image at Path to
 
 	// These fields are set programatically, mostly by finishImgInfo.
 	ID      string              // DOM ID for image
@@ -45,12 +47,14 @@ type imgInfo struct {
 
 	Src, Srcset                 string // attr values for preferred image
 	FallbackSrc, FallbackSrcset string // attr values for fallback image (if any)
+	AVIFSrcset                  string // attr value for AVIF image (if any; non-AMP only)
 
 	ThumbSrc          template.URL // attr value for thumbnail placeholder image (if any)
 	DefineThumbFilter bool         // true if #thumb-filter SVG filter should be defined
 
 	Sizes      string // 'sizes' attr value (set by finishImgInfo but can be modified after)
-	biggestSrc string // highest-res version of image (set by finishImgInfo)
+	biggestSrc string // highest-res version of image; not fingerprinted (set by finishImgInfo)
+	origSrc    string // Src before fingerprinting (set by finishImgInfo)
 	widths     []int  // ascending widths in pixels of images if multi-res (set by finishImgInfo)
 	layout     string // AMP layout (consumed by finishImgInfo; "responsive" used if empty)
 	noThumb    bool   // avoid generating a thumbnail (consumed by finishImgInfo)
@@ -90,6 +94,15 @@ func (info *imgInfo) finish(si *SiteInfo, amp bool, didThumb *bool) error {
 		return nil
 	}
 
+	// If scaled versions of the image were requested, use the ones generated by the build
+	// (e.g. "files/img-400.jpg" and "files/img-800.jpg" for "files/img.jpg").
+	if len(info.Widths) > 0 {
+		if err := checkResizeWidths(info.Path, info.Widths); err != nil {
+			return err
+		}
+		info.Path = removeExt(info.Path) + "-*" + filepath.Ext(info.Path)
+	}
+
 	if wc := strings.IndexByte(info.Path, '*'); wc == -1 {
 		// There's no wildcard, so there's just one size.
 		if strings.HasSuffix(info.Path, WebPExt) || strings.HasSuffix(info.Path, svgExt) {
@@ -102,6 +115,7 @@ func (info *imgInfo) finish(si *SiteInfo, amp bool, didThumb *bool) error {
 
 		// If the image's display dimensions weren't supplied, get them from the file.
 		if info.Width <= 0 || info.Height <= 0 {
+			si.deps.add(filepath.Join(si.StaticDir(), info.Path))
 			var err error
 			if info.Width, info.Height, err = imageSize(filepath.Join(si.StaticDir(), info.Path)); err != nil {
 				return fmt.Errorf("failed getting %v size: %v", info.Path, err)
@@ -111,10 +125,21 @@ func (info *imgInfo) finish(si *SiteInfo, amp bool, didThumb *bool) error {
 		if info.FallbackSrc != "" {
 			info.FallbackSrcset = fmt.Sprintf("%s %dw", info.FallbackSrc, info.Width)
 		}
+		if useAVIF(si, info.Path) && !amp {
+			avif := removeExt(info.Path) + AVIFExt
+			if err := si.CheckStatic(avif); err != nil {
+				return err
+			}
+			info.AVIFSrcset = fmt.Sprintf("%s %dw", avif, info.Width)
+		}
 	} else {
 		// There's a wildcard, so we have multiple sizes.
 		pre := info.Path[:wc]
 		suf := info.Path[wc+1:]
+		// Record the patterns so that added or removed images will be noticed.
+		wsuf := removeExt(suf) + WebPExt
+		si.deps.add(filepath.Join(si.StaticDir(), pre+"*"+suf), filepath.Join(si.StaticGenDir(), pre+"*"+suf),
+			filepath.Join(si.StaticDir(), pre+"*"+wsuf), filepath.Join(si.StaticGenDir(), pre+"*"+wsuf))
 		var err error
 		var srcset string
 		if srcset, info.widths, err = makeSrcset(si.StaticDir(), pre, suf); err != nil {
@@ -146,11 +171,15 @@ func (info *imgInfo) finish(si *SiteInfo, amp bool, didThumb *bool) error {
 			if p == "" {
 				return errors.New("dimensions could not be determined")
 			}
-			if info.Width, info.Height, err = imageSize(filepath.Join(si.StaticDir(), p)); err != nil {
+			if info.Width, info.Height, err = imageSize(si.staticFile(p)); err != nil {
 				return fmt.Errorf("failed getting %v dimensions: %v", p, err)
 			}
 		}
 
+		if len(info.Widths) > 0 && !reflect.DeepEqual(info.widths, info.Widths) {
+			return fmt.Errorf("found widths %v instead of %v (is the build out of date?)", info.widths, info.Widths)
+		}
+
 		src := fmt.Sprintf("%s%d%s", pre, info.Width, suf)
 		info.biggestSrc = fmt.Sprintf("%s%d%s", pre, info.widths[len(info.widths)-1], suf)
 
@@ -160,7 +189,6 @@ func (info *imgInfo) finish(si *SiteInfo, amp bool, didThumb *bool) error {
 		} else {
 			// Otherwise, make a WebP srcset and use the original images as a fallback.
 			info.Src = removeExt(src) + WebPExt
-			wsuf := removeExt(suf) + WebPExt
 			if info.Srcset, _, err = makeSrcset(si.StaticDir(), pre, wsuf); err != nil {
 				return err
 			} else if info.Srcset == "" {
@@ -174,6 +202,21 @@ func (info *imgInfo) finish(si *SiteInfo, amp bool, didThumb *bool) error {
 			info.FallbackSrc = src
 			info.FallbackSrcset = srcset
 		}
+
+		if useAVIF(si, info.Path) && !amp {
+			asuf := removeExt(suf) + AVIFExt
+			si.deps.add(filepath.Join(si.StaticDir(), pre+"*"+asuf), filepath.Join(si.StaticGenDir(), pre+"*"+asuf))
+			if info.AVIFSrcset, _, err = makeSrcset(si.StaticDir(), pre, asuf); err != nil {
+				return err
+			} else if info.AVIFSrcset == "" {
+				if info.AVIFSrcset, _, err = makeSrcset(si.StaticGenDir(), pre, asuf); err != nil {
+					return err
+				}
+			}
+			if info.AVIFSrcset == "" {
+				return fmt.Errorf("no images matched by prefix %q and suffix %q", pre, asuf)
+			}
+		}
 	}
 
 	if info.Sizes == "" {
@@ -215,8 +258,7 @@ func (info *imgInfo) finish(si *SiteInfo, amp bool, didThumb *bool) error {
 		}
 		// Ignore "webp: invalid format" errors that the webp package seems to return when passed
 		// animated images.
-		if thumb, err := Thumb(filepath.Join(si.StaticDir(), origSrc),
-			thumbnailSize, thumbnailSize); err == nil {
+		if thumb, err := Thumb(si.staticFile(origSrc), thumbnailSize, thumbnailSize); err == nil {
 			info.ThumbSrc = template.URL("data:image/gif;base64," + thumb)
 		} else if err.Error() != "webp: invalid format" {
 			return fmt.Errorf("failed generating thumbnail for %v: %v", origSrc, err)
@@ -228,11 +270,29 @@ func (info *imgInfo) finish(si *SiteInfo, amp bool, didThumb *bool) error {
 		*didThumb = true
 	}
 
+	// Rewrite paths to refer to fingerprinted files if needed.
+	var err error
+	info.origSrc = info.Src
+	if info.Src, err = si.staticURL(info.Src); err != nil {
+		return err
+	}
+	if info.FallbackSrc != "" {
+		if info.FallbackSrc, err = si.staticURL(info.FallbackSrc); err != nil {
+			return err
+		}
+	}
+	for _, ss := range []*string{&info.Srcset, &info.FallbackSrcset, &info.AVIFSrcset} {
+		if *ss, err = si.srcsetURLs(*ss); err != nil {
+			return err
+		}
+	}
+
 	return nil
 }
 
 // finishInlineSVG reads the SVG file at info.Path and writes an inline <svg> element to info.SVG.
 func (info *imgInfo) finishInlineSVG(si *SiteInfo) error {
+	si.deps.add(filepath.Join(si.StaticDir(), info.Path))
 	f, err := os.Open(filepath.Join(si.StaticDir(), info.Path))
 	if err != nil {
 		return err
@@ -332,6 +392,19 @@ func imageSize(p string) (w, h int, err error) {
 	return cfg.Width, cfg.Height, err
 }
 
+// useAVIF returns true if an AVIF version of the image at p should be used.
+// avifenc only accepts JPEG and PNG images.
+func useAVIF(si *SiteInfo, p string) bool {
+	if !si.GenerateAVIF {
+		return false
+	}
+	switch filepath.Ext(p) {
+	case ".jpg", ".jpeg", ".png":
+		return true
+	}
+	return false
+}
+
 // imageType guesses p's MIME type based on its extension.
 // An empty string is returned if the extension is unknown.
 func imageType(p string) string {
@@ -387,8 +460,12 @@ func makeBackgroundImage(si *SiteInfo, img, dir string) ([]string, error) {
 	if err := si.CheckStatic(filepath.Join(dir, img)); err != nil {
 		return nil, err
 	}
+	imgURL, err := si.relStaticURL(img, dir)
+	if err != nil {
+		return nil, err
+	}
 
-	rules = append(rules, fmt.Sprintf("background-image:url(%s)", img))
+	rules = append(rules, fmt.Sprintf("background-image:url(%s)", imgURL))
 
 	// Add the WebP version if it's supported:
 	// https://ole.michelsen.dk/blog/using-webp-images-html-css/
@@ -399,6 +476,10 @@ func makeBackgroundImage(si *SiteInfo, img, dir string) ([]string, error) {
 		if err := si.CheckStatic(filepath.Join(dir, webp)); err != nil {
 			return nil, err
 		}
+		webpURL, err := si.relStaticURL(webp, dir)
+		if err != nil {
+			return nil, err
+		}
 		imgType := imageType(img)
 
 		// TODO: The image-set() landscape is a mess as of mid-2022:
@@ -414,12 +495,25 @@ func makeBackgroundImage(si *SiteInfo, img, dir string) ([]string, error) {
 		// Vendor-prefixed property without type() and with resolution for Chrome.
 		// WebP image comes last since that's the one that Chrome seems to load.
 		rules = append(rules, fmt.Sprintf(
-			`background-image:-webkit-image-set(url(%s) 1x, url(%s) 1x)`, img, webp))
+			`background-image:-webkit-image-set(url(%s) 1x, url(%s) 1x)`, imgURL, webpURL))
 
 		// Proper syntax for browsers that understand it (only Firefox?).
 		// Last so it will override -webkit-image-set.
+		// The AVIF image (if any) is listed first since it's preferred.
+		var avifSrc string
+		if useAVIF(si, img) {
+			avif := img[:len(img)-len(ext)] + AVIFExt
+			if err := si.CheckStatic(filepath.Join(dir, avif)); err != nil {
+				return nil, err
+			}
+			avifURL, err := si.relStaticURL(avif, dir)
+			if err != nil {
+				return nil, err
+			}
+			avifSrc = fmt.Sprintf(`"%s" type("image/avif"), `, avifURL)
+		}
 		rules = append(rules, fmt.Sprintf(
-			`background-image:image-set("%s" type("image/webp"), "%s" type("%s"))`, webp, img, imgType))
+			`background-image:image-set(%s"%s" type("image/webp"), "%s" type("%s"))`, avifSrc, webpURL, imgURL, imgType))
 	}
 
 	return rules, nil
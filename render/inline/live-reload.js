@@ -0,0 +1,16 @@
+// Reloads the page after the site is rebuilt in watch mode. The build writes a
+// new token to the file named by LiveReloadFile in site.go after each build.
+(() => {
+  let token = null;
+  const check = () =>
+    fetch('/.live-reload', { cache: 'no-store' })
+      .then((res) => (res.ok ? res.text() : null))
+      .then((t) => {
+        if (t === null) return;
+        if (token !== null && t !== token) window.location.reload();
+        token = t;
+      })
+      .catch(() => {}) // the output dir may be replaced while we're fetching
+      .finally(() => window.setTimeout(check, 1000));
+  check();
+})();
@@ -6,6 +6,7 @@ package render
 import (
 	"fmt"
 	"regexp"
+	"strings"
 )
 
 const (
@@ -20,11 +21,20 @@ const (
 
 	// FeedFile is the filename for the site's Atom feed.
 	FeedFile = "atom.xml"
+	// RSSFeedFile is the filename for the site's RSS 2.0 feed (see SiteInfo.FeedRSS).
+	RSSFeedFile = "rss.xml"
+	// JSONFeedFile is the filename for the site's JSON Feed (see SiteInfo.FeedJSON).
+	JSONFeedFile = "feed.json"
 )
 
 // pageRegexp matches regular page filenames with an optional fragment.
 var pageRegexp = regexp.MustCompile("^([a-z_]+)" + regexp.QuoteMeta(HTMLExt) + "(#.+)?$")
 
+// tagPageRegexp matches the filenames of generated tag pages (see TagPageFile), which
+// may also contain digits, with an optional fragment.
+var tagPageRegexp = regexp.MustCompile("^(" + regexp.QuoteMeta(tagPagePrefix) + "[a-z0-9_]+)" +
+	regexp.QuoteMeta(HTMLExt) + "(#.+)?$")
+
 // NavItem describes a single item displayed in the site navigation menu.
 type NavItem struct {
 	// Name contains the short, human-readable name for the item that is displayed in the menu.
@@ -104,7 +114,9 @@ func (n *NavItem) VisibleChildren() []*NavItem {
 func splitPage(p string) (base, fragment string) {
 	m := pageRegexp.FindStringSubmatch(p)
 	if m == nil {
-		return "", ""
+		if m = tagPageRegexp.FindStringSubmatch(p); m == nil {
+			return "", ""
+		}
 	}
 	return m[1], m[2]
 }
@@ -115,6 +127,20 @@ func isPage(p string) bool {
 	return base != ""
 }
 
+// PageNumFile returns the filename of the num-th (1-based) page of the paginated page p,
+// an HTML or AMP page like "foo.html" or "foo.amp.html". The first page uses p itself,
+// while e.g. the second page is written to "foo-2.html" or "foo-2.amp.html".
+func PageNumFile(p string, num int) string {
+	if num <= 1 {
+		return p
+	}
+	ext := HTMLExt
+	if strings.HasSuffix(p, AMPExt) {
+		ext = AMPExt
+	}
+	return fmt.Sprintf("%s-%d%s", strings.TrimSuffix(p, ext), num, ext)
+}
+
 // ampPage returns the AMP page corresponding to p, an HTML page.
 // If a fragment is present, it is preserved.
 func ampPage(p string) string {
@@ -14,6 +14,8 @@ func TestNavItem_AMPURL(t *testing.T) {
 		{NavItem{URL: "page" + HTMLExt + "#frag"}, "page" + AMPExt + "#frag"},
 		{NavItem{URL: "mailto:me@example.org"}, "mailto:me@example.org"},
 		{NavItem{ID: indexID}, indexFileBase + AMPExt},
+		{NavItem{URL: "page2" + HTMLExt}, "page2" + HTMLExt},
+		{NavItem{URL: tagPagePrefix + "ipv4" + HTMLExt}, tagPagePrefix + "ipv4" + AMPExt},
 	} {
 		if got := tc.ni.AMPURL(); got != tc.want {
 			t.Errorf("NavItem%+v.AMPURL() = %q; want %q", tc.ni, got, tc.want)
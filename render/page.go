@@ -12,6 +12,7 @@ import (
 	"net/url"
 	"path/filepath"
 	"regexp"
+	"strconv"
 	"strings"
 	"time"
 
@@ -33,27 +34,62 @@ const (
 
 	ampBoilerplatePre = "amp-boilerplate"
 
+	// Blackfriday extensions used when parsing pages.
+	mdExtensions = (bf.CommonExtensions &^ bf.Autolink) | bf.Footnotes
+
 	// WebPExt is the extension for generated WebP image files.
 	WebPExt = ".webp"
+	// AVIFExt is the extension for generated AVIF image files.
+	AVIFExt = ".avif"
 )
 
 // Page renders and returns the page described by the supplied Markdown data.
 // The id parameter specifies the page's default ID, although this can be overriden in the page block.
 // The amp parameter specifies whether the AMP or non-AMP version of the page should be rendered.
-// The returned feed info is nil if the page should not be included in the Atom feed.
-func Page(si SiteInfo, id string, markdown []byte, amp bool) ([]byte, *PageFeedInfo, error) {
+// Metadata about the rendered page is also returned.
+func Page(si SiteInfo, id string, markdown []byte, amp bool) ([]byte, *PageMeta, error) {
+	return PageNum(si, id, markdown, amp, 1)
+}
+
+// PageNum is similar to Page but renders the num-th (1-based) page of a page containing a
+// paginated "pagelist" code block. The number of pages is reported in PageMeta.PageCount,
+// and additional pages should be written to the filenames returned by PageNumFile.
+func PageNum(si SiteInfo, id string, markdown []byte, amp bool, num int) ([]byte, *PageMeta, error) {
 	r := newRenderer(si, id, amp)
-	b := bf.Run(markdown, bf.WithRenderer(r),
-		bf.WithExtensions((bf.CommonExtensions&^bf.Autolink)|bf.Footnotes))
+	r.pageNum = num
+	return renderPage(r, markdown)
+}
+
+// renderPage renders the page described by markdown using r.
+func renderPage(r *renderer, markdown []byte) ([]byte, *PageMeta, error) {
+	si, amp := r.si, r.amp
+	b := bf.Run(markdown, bf.WithRenderer(r), bf.WithExtensions(mdExtensions))
 	if r.err != nil {
 		return nil, nil, r.err
 	}
 
-	var fi *PageFeedInfo
-	if !r.pi.OmitFromFeed && r.pi.Created != "" {
-		fi = &PageFeedInfo{
-			Title: r.pi.Title,
-			Desc:  r.pi.Desc,
+	if r.pageNum > r.pageCount && r.pageNum > 1 {
+		return nil, nil, fmt.Errorf("page %d requested but page only has %d", r.pageNum, r.pageCount)
+	}
+
+	meta := PageMeta{Inline: r.inline}
+	if r.pageCount > 1 {
+		meta.PageNum, meta.PageCount = r.pageNum, r.pageCount
+	}
+	// Additional pages of paginated pages are only included in the sitemap.
+	first := r.pageNum <= 1
+	if first {
+		var err error
+		if meta.Summary, err = r.pi.summary(si); err != nil {
+			return nil, nil, err
+		}
+	}
+	if first && !r.pi.OmitFromFeed && r.pi.Created != "" {
+		fi := &PageFeedInfo{
+			Title:      r.pi.Title,
+			Desc:       r.pi.Desc,
+			UpdateNote: r.pi.UpdateNote,
+			Tags:       r.pi.Tags,
 		}
 		var err error
 		if fi.AbsURL, err = si.AbsURL(r.pi.NavItem.URL); err != nil {
@@ -62,32 +98,214 @@ func Page(si SiteInfo, id string, markdown []byte, amp bool) ([]byte, *PageFeedI
 		if fi.Created, err = time.Parse(dateLayout, r.pi.Created); err != nil {
 			return nil, nil, err
 		}
+		if r.pi.Modified != "" {
+			if fi.Modified, err = time.Parse(dateLayout, r.pi.Modified); err != nil {
+				return nil, nil, err
+			}
+		}
+		if fi.UpdateNote != "" && !fi.Modified.After(fi.Created) {
+			return nil, nil, errors.New("update_note requires modified date after created date")
+		}
+		if !amp {
+			if fi.Content, err = feedContent(b, fi.AbsURL); err != nil {
+				return nil, nil, fmt.Errorf("failed getting feed content: %v", err)
+			}
+		}
+		meta.Feed = fi
+	}
+	if !r.pi.OmitFromSitemap {
+		smi := &PageSitemapInfo{
+			ChangeFreq: r.pi.SitemapChangeFreq,
+			Priority:   r.pi.SitemapPriority,
+			Images:     r.sitemapImages,
+		}
+		var err error
+		if smi.AbsURL, err = si.AbsURL(r.pageURL(r.pageNum, false)); err != nil {
+			return nil, nil, err
+		}
+		if smi.ChangeFreq == "" {
+			smi.ChangeFreq = defaultChangeFreq
+		} else if !validChangeFreqs[smi.ChangeFreq] {
+			return nil, nil, fmt.Errorf("invalid sitemap_changefreq %q", smi.ChangeFreq)
+		}
+		if smi.Priority != "" {
+			if v, err := strconv.ParseFloat(smi.Priority, 64); err != nil || v < 0 || v > 1 {
+				return nil, nil, fmt.Errorf("invalid sitemap_priority %q", smi.Priority)
+			}
+		}
+		// Use the modification date if present and the creation date otherwise.
+		date := r.pi.Modified
+		if date == "" {
+			date = r.pi.Created
+		}
+		if date != "" {
+			if smi.LastMod, err = time.Parse(dateLayout, date); err != nil {
+				return nil, nil, err
+			}
+		}
+		meta.Sitemap = smi
+	}
+
+	return b, &meta, nil
+}
+
+// PageMeta contains metadata about a rendered page.
+// It is saved in the build package's cache, so cacheVersion there must be incremented
+// whenever PageMeta or the types that it contains change.
+type PageMeta struct {
+	// Feed contains information needed to list the page in feeds.
+	// It is nil if the page should not be included in feeds.
+	Feed *PageFeedInfo `json:"feed,omitempty"`
+	// Inline lists the sources of the page's inline CSS and JS in the order they were added.
+	Inline []InlineSource `json:"inline,omitempty"`
+	// Sitemap contains information needed to list the page in the sitemap.
+	// It is nil if the page should not be included in the sitemap.
+	Sitemap *PageSitemapInfo `json:"sitemap,omitempty"`
+	// Summary contains information needed to list the page on other pages.
+	// It is nil for additional pages of paginated pages.
+	Summary *PageSummary `json:"summary,omitempty"`
+	// PageNum contains the 1-based number of this page if the page is paginated.
+	PageNum int `json:"page_num,omitempty"`
+	// PageCount contains the total number of pages if the page is paginated.
+	PageCount int `json:"page_count,omitempty"`
+}
+
+// PageSummary describes a page so that it can be listed on other pages (e.g. tag pages).
+type PageSummary struct {
+	ID        string    // page ID
+	URL       string    // non-AMP page's URL relative to the site's base URL, e.g. "foo.html"
+	Title     string    // page title
+	Desc      string    // page description; empty if SiteInfo.DefaultDesc was used
+	Created   time.Time // zero if the page doesn't have a creation date
+	Modified  time.Time // zero if the page doesn't have a modification date
+	ImagePath string    // structured data image path in static dir (if any)
+	Tags      []string  // tags from the page block
+}
+
+// ReadPageSummary parses the page block at the beginning of the supplied Markdown data
+// and returns a summary of the page without rendering it. The id parameter is the same as for Page.
+func ReadPageSummary(si SiteInfo, id string, markdown []byte) (*PageSummary, error) {
+	ast := bf.New(bf.WithExtensions(mdExtensions)).Parse(markdown)
+	fc := ast.FirstChild
+	if fc == nil || fc.Type != bf.CodeBlock || string(fc.CodeBlockData.Info) != "page" {
+		return nil, errors.New(`page doesn't start with "page" code block`)
+	}
+	pi := pageInfo{ID: id, Desc: si.DefaultDesc}
+	if err := unmarshalYAML(fc.Literal, &pi); err != nil {
+		return nil, fmt.Errorf("failed to parse page info from %q: %v", fc.Literal, err)
+	}
+	if pi.NavItem = findNavItem(&si, pi.ID); pi.NavItem == nil {
+		return nil, fmt.Errorf("no page with ID %q", pi.ID)
+	}
+	return pi.summary(&si)
+}
+
+// summary returns a summary of the page described by pi.
+// pi's page block must have already been parsed and NavItem must be set.
+func (pi *pageInfo) summary(si *SiteInfo) (*PageSummary, error) {
+	sum := &PageSummary{
+		ID:        pi.ID,
+		URL:       pi.NavItem.URL,
+		Title:     pi.Title,
+		ImagePath: pi.ImagePath,
+		Tags:      pi.Tags,
+	}
+	if sum.URL == "" {
+		sum.URL = IndexPage
+	}
+	if pi.Desc != si.DefaultDesc {
+		sum.Desc = pi.Desc
+	}
+	var err error
+	if pi.Created != "" {
+		if sum.Created, err = time.Parse(dateLayout, pi.Created); err != nil {
+			return nil, err
+		}
 	}
+	if pi.Modified != "" {
+		if sum.Modified, err = time.Parse(dateLayout, pi.Modified); err != nil {
+			return nil, err
+		}
+	}
+	return sum, nil
+}
 
-	return b, fi, nil
+// InlineSource describes a source of inline CSS or JS in a page.
+type InlineSource struct {
+	Name string `json:"name"` // e.g. "base.css (built-in)", "inline/base.css", or "page_style"
+	Type string `json:"type"` // "css" or "js"
+	Size int    `json:"size"` // size in bytes
 }
 
-// PageFeedInfo contains metadata about a page that is needed to generate an Atom feed.
+// PageFeedInfo contains metadata about a page that is needed to generate feeds.
 type PageFeedInfo struct {
 	Title   string
 	Desc    string
 	AbsURL  string
 	Created time.Time
+	Content string // page body with absolute URLs; empty for AMP pages
+
+	Modified   time.Time // zero if the page doesn't have a modification date
+	UpdateNote string    // describes a substantive update made on Modified
+	Tags       []string  // tags from the page block
+}
+
+// Updated returns the time at which the page was last modified, or its creation time if
+// it hasn't been modified since then.
+func (fi *PageFeedInfo) Updated() time.Time {
+	if fi.Modified.After(fi.Created) {
+		return fi.Modified
+	}
+	return fi.Created
+}
+
+// Listed returns the time used to order the page in feeds. Pages that have been substantively
+// updated (as indicated by UpdateNote) are ordered by their modification time so they can
+// re-enter feeds, while other pages are ordered by their creation time.
+func (fi *PageFeedInfo) Listed() time.Time {
+	if fi.UpdateNote != "" {
+		return fi.Updated()
+	}
+	return fi.Created
+}
+
+// PageSitemapInfo contains metadata about a page that is needed to list it in the sitemap.
+type PageSitemapInfo struct {
+	AbsURL     string
+	LastMod    time.Time // zero if the page has no dates
+	ChangeFreq string    // e.g. "weekly"
+	Priority   string    // e.g. "0.8"; empty if unset
+	Images     []string  // absolute URLs of images displayed in the page
+}
+
+// defaultChangeFreq is used for PageSitemapInfo.ChangeFreq if sitemap_changefreq isn't set.
+const defaultChangeFreq = "weekly"
+
+// validChangeFreqs contains the values permitted in a sitemap's <changefreq> element.
+var validChangeFreqs = map[string]bool{
+	"always": true, "hourly": true, "daily": true, "weekly": true,
+	"monthly": true, "yearly": true, "never": true,
 }
 
 // pageInfo holds information about the current page that is used by page.tmpl.
 type pageInfo struct {
-	Title           string `yaml:"title"`             // original title
-	ID              string `yaml:"id"`                // NavItem.ID to highlight in navbox (inferred from filename if empty)
-	Desc            string `yaml:"desc"`              // meta description
-	ImagePath       string `yaml:"image_path"`        // path to structured data image in static dir
-	Created         string `yaml:"created"`           // creation date as 'YYYY-MM-DD'
-	Modified        string `yaml:"modified"`          // last-modified date as 'YYYY-MM-DD'
-	HideTitleSuffix bool   `yaml:"hide_title_suffix"` // don't append SiteInfo.TitleSuffix
-	HideBackToTop   bool   `yaml:"hide_back_to_top"`  // hide footer link to jump to top
-	HideDates       bool   `yaml:"hide_dates"`        // hide footer created and modified dates
-	OmitFromFeed    bool   `yaml:"omit_from_feed"`    // omit page from RSS feed
-	PageStyle       string `yaml:"page_style"`        // optional custom page-specific CSS
+	Title           string   `yaml:"title"`             // original title
+	ID              string   `yaml:"id"`                // NavItem.ID to highlight in navbox (inferred from filename if empty)
+	Desc            string   `yaml:"desc"`              // meta description
+	ImagePath       string   `yaml:"image_path"`        // path to structured data image in static dir
+	Created         string   `yaml:"created"`           // creation date as 'YYYY-MM-DD'
+	Modified        string   `yaml:"modified"`          // last-modified date as 'YYYY-MM-DD'
+	UpdateNote      string   `yaml:"update_note"`       // describes substantive update on Modified; re-lists page in feeds
+	Tags            []string `yaml:"tags"`              // tags describing the page's topics
+	HideTitleSuffix bool     `yaml:"hide_title_suffix"` // don't append SiteInfo.TitleSuffix
+	HideBackToTop   bool     `yaml:"hide_back_to_top"`  // hide footer link to jump to top
+	HideDates       bool     `yaml:"hide_dates"`        // hide footer created and modified dates
+	OmitFromFeed    bool     `yaml:"omit_from_feed"`    // omit page from RSS feed
+	PageStyle       string   `yaml:"page_style"`        // optional custom page-specific CSS
+
+	OmitFromSitemap   bool   `yaml:"omit_from_sitemap"`  // omit page from sitemap
+	SitemapChangeFreq string `yaml:"sitemap_changefreq"` // sitemap <changefreq>, e.g. "monthly" (default "weekly")
+	SitemapPriority   string `yaml:"sitemap_priority"`   // sitemap <priority> between 0.0 and 1.0
 
 	SiteInfo *SiteInfo `yaml:"-"` // site-level information
 	NavItem  *NavItem  `yaml:"-"` // nav item corresponding to current page
@@ -100,9 +318,12 @@ type pageInfo struct {
 	MenuButton imgInfo `yaml:"-"` // menu button for AMP
 	DarkButton imgInfo `yaml:"-"` // dark mode button for both non-AMP and AMP
 
-	LinkRel  string `yaml:"-"` // rel attribute for AMP/non-AMP <link>, e.g. "canonical"
-	LinkHref string `yaml:"-"` // href attribute for AMP/non-AMP <link>
-	FeedHref string `yaml:"-"` // href attribute for Atom feed <link>
+	LinkRel      string    `yaml:"-"` // rel attribute for AMP/non-AMP <link>, e.g. "canonical"
+	LinkHref     string    `yaml:"-"` // href attribute for AMP/non-AMP <link>
+	FeedHref     string    `yaml:"-"` // href attribute for Atom feed <link>
+	TagLinks     []tagLink `yaml:"-"` // links to tag pages for Tags
+	RSSFeedHref  string    `yaml:"-"` // href attribute for RSS feed <link> (if any)
+	JSONFeedHref string    `yaml:"-"` // href attribute for JSON Feed <link> (if any)
 
 	HasGraph            bool   `yaml:"-"` // page contains one or more graphs
 	HasMap              bool   `yaml:"-"` // page contains a map
@@ -153,6 +374,15 @@ type renderer struct {
 	lastFigureAlign string // last "align" value used for a figure
 	numMapMarkers   int    // number of boxes with "map_marker"
 	didThumb        bool   // already rendered an image with a thumbnail placeholder
+
+	inline        []InlineSource // sources of inline CSS and JS
+	sitemapImages []string       // absolute URLs of images to list in the sitemap
+
+	defaultNav *NavItem // used for pages that aren't in the nav (e.g. tag pages)
+	feedFile   string   // feed to link to if not FeedFile
+
+	pageNum   int // 1-based number of the page being rendered
+	pageCount int // total number of pages if paginated by a "pagelist" block
 }
 
 func newRenderer(si SiteInfo, id string, amp bool) *renderer {
@@ -162,10 +392,11 @@ func newRenderer(si SiteInfo, id string, amp bool) *renderer {
 		hr: bf.NewHTMLRenderer(bf.HTMLRendererParameters{
 			Flags: bf.FootnoteReturnLinks,
 		}),
-		amp: amp,
+		amp:     amp,
+		pageNum: 1,
 	}
 
-	r.tmpl = newTemplater(filepath.Join(si.TemplateDir()), template.FuncMap{
+	r.tmpl = newTemplater(filepath.Join(si.TemplateDir()), si.deps, template.FuncMap{
 		"amp": func() bool {
 			return r.amp
 		},
@@ -185,6 +416,29 @@ func newRenderer(si SiteInfo, id string, amp bool) *renderer {
 	return &r
 }
 
+// findNavItem returns the item from si.NavItems with the supplied ID, or nil if none exists.
+func findNavItem(si *SiteInfo, id string) *NavItem {
+	for _, n := range si.NavItems {
+		if ni := n.FindID(id); ni != nil {
+			return ni
+		}
+	}
+	return nil
+}
+
+// pageURL returns the URL of the num-th (1-based) page of the page being rendered relative to
+// the site's base URL. If amp is true, the AMP version's URL is returned.
+func (r *renderer) pageURL(num int, amp bool) string {
+	u := r.pi.NavItem.URL
+	if amp {
+		u = r.pi.NavItem.AMPURL()
+	}
+	if u == "" {
+		u = IndexPage
+	}
+	return PageNumFile(u, num)
+}
+
 // setError saves err to r.err if it isn't already set. err is returned.
 // Use this instead of setting r.err directly to avoid overwriting an earlier error.
 func (r *renderer) setError(err error) error {
@@ -259,22 +513,39 @@ func (r *renderer) RenderHeader(w io.Writer, ast *bf.Node) {
 		return
 	}
 
-	for _, n := range r.si.NavItems {
-		if r.pi.NavItem = n.FindID(r.pi.ID); r.pi.NavItem != nil {
-			break
-		}
-	}
-	if r.pi.NavItem == nil {
-		// Add a fake nav item for the index page if it's current and isn't listed.
-		// The Name and URL fields don't need to be set since this item is never rendered.
-		if r.pi.ID == indexID {
-			r.pi.NavItem = &NavItem{ID: indexID}
+	if r.pi.NavItem = findNavItem(r.si, r.pi.ID); r.pi.NavItem == nil {
+		// Use the supplied nav item for generated pages. Otherwise, add a fake nav item for the
+		// index page if it's current and isn't listed. The Name field doesn't need to be set
+		// since this item is never rendered in the nav box, but the URL is used when linking
+		// to the page from the sitemap, feeds, and page summaries.
+		if r.defaultNav != nil {
+			r.pi.NavItem = r.defaultNav
+		} else if r.pi.ID == indexID {
+			r.pi.NavItem = &NavItem{ID: indexID, URL: IndexPage}
 		} else {
 			r.setErrorf("no page with ID %q", r.pi.ID)
 			return
 		}
 	}
 
+	seenTags := make(map[string]struct{}, len(r.pi.Tags))
+	for _, tag := range r.pi.Tags {
+		if _, ok := seenTags[tag]; ok {
+			r.setErrorf("duplicate tag %q", tag)
+			return
+		}
+		seenTags[tag] = struct{}{}
+		fn, err := TagPageFile(tag)
+		if err != nil {
+			r.setError(err)
+			return
+		}
+		if r.amp {
+			fn = ampPage(fn)
+		}
+		r.pi.TagLinks = append(r.pi.TagLinks, tagLink{Name: tag, URL: fn})
+	}
+
 	// Walk the full Markdown AST to determine which features the page uses.
 	ast.Walk(func(node *bf.Node, entering bool) bf.WalkStatus {
 		if !entering {
@@ -299,7 +570,7 @@ func (r *renderer) RenderHeader(w io.Writer, ast *bf.Node) {
 				r.pi.HasMap = true
 				r.pi.MapPlaceholderLight = info.Path
 				r.pi.MapPlaceholderDark = info.PathDark
-			case "clear", "contents", "image", "page", "":
+			case "clear", "contents", "image", "page", "pagelist", "":
 				// Skip other special code blocks and untagged blocks.
 			default:
 				r.pi.HighlightCode = true
@@ -328,6 +599,9 @@ func (r *renderer) RenderHeader(w io.Writer, ast *bf.Node) {
 
 	// Append the title suffix if needed.
 	r.pi.FullTitle = r.pi.Title
+	if r.pageNum > 1 {
+		r.pi.FullTitle += fmt.Sprintf(" (page %d)", r.pageNum)
+	}
 	if !r.pi.HideTitleSuffix {
 		r.pi.FullTitle += r.si.TitleSuffix
 	}
@@ -431,10 +705,26 @@ func (r *renderer) RenderHeader(w io.Writer, ast *bf.Node) {
 	}
 
 	var err error
-	if r.pi.FeedHref, err = r.si.AbsURL(FeedFile); err != nil {
+	feedFile := FeedFile
+	if r.feedFile != "" {
+		feedFile = r.feedFile
+	}
+	if r.pi.FeedHref, err = r.si.AbsURL(feedFile); err != nil {
 		r.setError(err)
 		return
 	}
+	if r.si.FeedRSS {
+		if r.pi.RSSFeedHref, err = r.si.AbsURL(RSSFeedFile); err != nil {
+			r.setError(err)
+			return
+		}
+	}
+	if r.si.FeedJSON {
+		if r.pi.JSONFeedHref, err = r.si.AbsURL(JSONFeedFile); err != nil {
+			r.setError(err)
+			return
+		}
+	}
 
 	// It would be much simpler to just use a map[string]interface{} for this,
 	// but the properties are marshaled in an arbitrary order then, making it
@@ -444,6 +734,7 @@ func (r *renderer) RenderHeader(w io.Writer, ast *bf.Node) {
 		Type:          "Article",
 		Headline:      r.pi.Title,
 		DatePublished: r.pi.Created,
+		Keywords:      strings.Join(r.pi.Tags, ","),
 		Author: structDataAuthor{
 			Type:  "Person",
 			Name:  r.si.AuthorName,
@@ -461,7 +752,7 @@ func (r *renderer) RenderHeader(w io.Writer, ast *bf.Node) {
 			return
 		}
 	}
-	if r.pi.StructData.MainEntityOfPage, err = r.si.AbsURL(r.pi.NavItem.URL); err != nil {
+	if r.pi.StructData.MainEntityOfPage, err = r.si.AbsURL(r.pageURL(r.pageNum, false)); err != nil {
 		r.setError(err)
 		return
 	}
@@ -476,15 +767,19 @@ func (r *renderer) RenderHeader(w io.Writer, ast *bf.Node) {
 			r.setError(err)
 			return
 		}
+		if err := r.addSitemapImage(r.pi.ImagePath); err != nil {
+			r.setError(err)
+			return
+		}
 	}
 
 	// CSS used by both AMP and non-AMP versions of the page.
-	commonStyle := getStdInline("base.css") +
-		r.si.ReadInline("base.css") +
-		r.si.ReadInline("page_"+r.pi.ID+".css") +
-		r.pi.PageStyle
+	commonStyle := r.stdInline("base.css") +
+		r.siteInline("base.css") +
+		r.siteInline("page_"+r.pi.ID+".css") +
+		r.addInline("page_style", "css", r.pi.PageStyle)
 	if r.pi.HasGraph {
-		commonStyle += getStdInline("graph.css") + r.si.ReadInline("graph.css")
+		commonStyle += r.stdInline("graph.css") + r.siteInline("graph.css")
 	}
 	if r.pi.HasMap {
 		style, err := r.getMapPlaceholderStyle(false /* dark */)
@@ -492,15 +787,16 @@ func (r *renderer) RenderHeader(w io.Writer, ast *bf.Node) {
 			r.setErrorf("map_placeholder_light: %v", err)
 			return
 		}
-		commonStyle += getStdInline("map.css") + r.si.ReadInline("map.css") + style
+		commonStyle += r.stdInline("map.css") + r.siteInline("map.css") +
+			r.addInline("map placeholder", "css", style)
 	}
 	if r.pi.HighlightCode {
-		commonStyle += r.si.codeCSS
+		commonStyle += r.addInline("code highlighting", "css", r.si.codeCSS)
 	}
 
 	if r.amp {
 		r.pi.LinkRel = "canonical"
-		if r.pi.LinkHref, err = r.si.AbsURL(r.pi.NavItem.URL); err != nil {
+		if r.pi.LinkHref, err = r.si.AbsURL(r.pageURL(r.pageNum, false)); err != nil {
 			r.setError(err)
 			return
 		}
@@ -508,10 +804,10 @@ func (r *renderer) RenderHeader(w io.Writer, ast *bf.Node) {
 		r.pi.AMPStyle = template.CSS(getStdInline("amp-boilerplate.css"))
 		r.pi.AMPNoscriptStyle = template.CSS(getStdInline("amp-boilerplate-noscript.css"))
 		r.pi.AMPCustomStyle = template.CSS(commonStyle +
-			getStdInline("mobile.css") + // used for all viewport sizes in AMP pages
-			getStdInline("amp.css") +
-			r.si.ReadInline("mobile.css") +
-			r.si.ReadInline("amp.css"))
+			r.stdInline("mobile.css") + // used for all viewport sizes in AMP pages
+			r.stdInline("amp.css") +
+			r.siteInline("mobile.css") +
+			r.siteInline("amp.css"))
 
 		// TODO: It looks like AMP runs
 		// https://raw.githubusercontent.com/ampproject/amphtml/1476486609642/src/style-installer.js,
@@ -527,7 +823,7 @@ func (r *renderer) RenderHeader(w io.Writer, ast *bf.Node) {
 		// https://amp.dev/documentation/guides-and-tutorials/optimize-and-measure/secure-pages/
 	} else {
 		r.pi.LinkRel = "amphtml"
-		if r.pi.LinkHref, err = r.si.AbsURL(r.pi.NavItem.AMPURL()); err != nil {
+		if r.pi.LinkHref, err = r.si.AbsURL(r.pageURL(r.pageNum, true)); err != nil {
 			r.setError(err)
 			return
 		}
@@ -540,28 +836,31 @@ func (r *renderer) RenderHeader(w io.Writer, ast *bf.Node) {
 				r.setErrorf("map_placeholder_dark: %v", err)
 				return
 			}
-			commonStyle += style
+			commonStyle += r.addInline("map placeholder (dark)", "css", style)
 		}
 
 		r.pi.HTMLStyle = template.CSS(commonStyle +
-			getStdInline("nonamp.css") +
-			r.si.ReadInline("nonamp.css") +
+			r.stdInline("nonamp.css") +
+			r.siteInline("nonamp.css") +
 			fmt.Sprintf("@media(min-width:%dpx){%s}",
-				desktopMinWidth, getStdInline("desktop.css")+r.si.ReadInline("desktop.css")) +
+				desktopMinWidth, r.stdInline("desktop.css")+r.siteInline("desktop.css")) +
 			fmt.Sprintf("@media(max-width:%dpx){%s}",
-				mobileMaxWidth, getStdInline("mobile.css")+r.si.ReadInline("mobile.css")))
+				mobileMaxWidth, r.stdInline("mobile.css")+r.siteInline("mobile.css")))
 
 		r.pi.HTMLScripts = []template.JS{
-			template.JS(getStdInline("dark.js")), // used by base.js
-			template.JS(getStdInline("base.js")),
+			template.JS(r.stdInline("dark.js")), // used by base.js
+			template.JS(r.stdInline("base.js")),
 		}
 		if r.pi.HasMap {
-			r.pi.HTMLScripts = append(r.pi.HTMLScripts, template.JS(getStdInline("map.js")))
+			r.pi.HTMLScripts = append(r.pi.HTMLScripts, template.JS(r.stdInline("map.js")))
 		}
-		if js := r.si.ReadInline("page_" + r.pi.ID + ".js"); js != "" {
+		if js := r.siteInline("page_" + r.pi.ID + ".js"); js != "" {
 			r.pi.HTMLScripts = append(r.pi.HTMLScripts, template.JS(js))
 		}
-		r.pi.HTMLBodyScript = template.JS(getStdInline("base-body.js"))
+		if r.si.LiveReload {
+			r.pi.HTMLScripts = append(r.pi.HTMLScripts, template.JS(r.stdInline("live-reload.js")))
+		}
+		r.pi.HTMLBodyScript = template.JS(r.stdInline("base-body.js"))
 
 		csp := cspBuilder{}
 		csp.add(cspDefault, cspNone)
@@ -702,8 +1001,12 @@ func (r *renderer) renderCodeBlock(w io.Writer, node *bf.Node, entering bool) bf
 			r.setErrorf("bad data in %q: %v", node.Literal, err)
 			return bf.Terminate
 		}
+		if err := r.addSitemapImage(info.imgInfo.biggestSrc); err != nil {
+			r.setError(err)
+			return bf.Terminate
+		}
 		info.figureInfo.Align = figureAlign(info.figureInfo.Align)
-		if info.Href == "" && !info.NoLink && info.imgInfo.biggestSrc != info.imgInfo.Src {
+		if info.Href == "" && !info.NoLink && info.imgInfo.biggestSrc != info.imgInfo.origSrc {
 			info.Href = info.imgInfo.biggestSrc
 		}
 		if info.Href != "" {
@@ -741,6 +1044,11 @@ func (r *renderer) renderCodeBlock(w io.Writer, node *bf.Node, entering bool) bf
 		return bf.SkipChildren
 	case "page":
 		return bf.SkipChildren // handled in RenderHeader
+	case "pagelist":
+		if r.setError(r.renderPageList(w, node.Literal)) != nil {
+			return bf.Terminate
+		}
+		return bf.SkipChildren
 	default:
 		if lang := string(node.CodeBlockData.Info); lang != "" {
 			code := strings.TrimRight(string(node.Literal), "\n")
@@ -935,6 +1243,10 @@ func (r *renderer) rewriteLink(link string) (string, error) {
 		if err := r.si.CheckStatic(link); err != nil {
 			return "", err
 		}
+		var err error
+		if link, err = r.si.staticURL(link); err != nil {
+			return "", err
+		}
 	}
 
 	if r.amp {
@@ -1015,19 +1327,63 @@ func (r *renderer) newStructDataImage(path string) (*structDataImage, error) {
 	if err := r.si.CheckStatic(path); err != nil {
 		return nil, err
 	}
-	var err error
-	if img.URL, err = r.si.AbsURL(path); err != nil {
+	u, err := r.si.staticURL(path)
+	if err != nil {
+		return nil, err
+	}
+	if img.URL, err = r.si.AbsURL(u); err != nil {
 		return nil, err
 	}
+	r.si.deps.add(filepath.Join(r.si.StaticDir(), path))
 	img.Width, img.Height, err = imageSize(filepath.Join(r.si.StaticDir(), path))
 	return img, err
 }
 
+// addSitemapImage records the image at path p within the static dir to be listed in the sitemap.
+// Empty paths and duplicates are ignored.
+func (r *renderer) addSitemapImage(p string) error {
+	if p == "" {
+		return nil
+	}
+	u, err := r.si.staticURL(p)
+	if err != nil {
+		return err
+	}
+	if u, err = r.si.AbsURL(u); err != nil {
+		return err
+	}
+	for _, s := range r.sitemapImages {
+		if s == u {
+			return nil
+		}
+	}
+	r.sitemapImages = append(r.sitemapImages, u)
+	return nil
+}
+
 // removeExt removes the extension (e.g. ".txt") from p.
 func removeExt(p string) string {
 	return p[:len(p)-len(filepath.Ext(p))]
 }
 
+// addInline records data as inline CSS or JS (per typ) from the named source and returns it.
+func (r *renderer) addInline(name, typ, data string) string {
+	if data != "" {
+		r.inline = append(r.inline, InlineSource{Name: name, Type: typ, Size: len(data)})
+	}
+	return data
+}
+
+// stdInline returns the named standard inline file and records it as inline CSS or JS.
+func (r *renderer) stdInline(fn string) string {
+	return r.addInline(fn+" (built-in)", strings.TrimPrefix(filepath.Ext(fn), "."), getStdInline(fn))
+}
+
+// siteInline returns the named file from the site's inline dir and records it as inline CSS or JS.
+func (r *renderer) siteInline(fn string) string {
+	return r.addInline("inline/"+fn, strings.TrimPrefix(filepath.Ext(fn), "."), r.si.ReadInline(fn))
+}
+
 // getStdInline returns the contents of the named standard inline file from std_inline.go.
 // It panics if the file does not exist.
 func getStdInline(fn string) string {
@@ -0,0 +1,243 @@
+// Copyright 2023 Daniel Erat.
+// All rights reserved.
+
+package render
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// pageListThumbWidth is the maximum display width in pixels of thumbnails in "pagelist" blocks.
+const pageListThumbWidth = 80
+
+// pageListInfo describes a "pagelist" code block, which lists other pages in the site.
+// If no selection fields are supplied, all pages are listed.
+type pageListInfo struct {
+	Nav     string `yaml:"nav"`       // only list descendants of the nav item with this ID
+	Tag     string `yaml:"tag"`       // only list pages with this tag
+	From    string `yaml:"from"`      // only list pages created on or after this 'YYYY-MM-DD' date
+	To      string `yaml:"to"`        // only list pages created on or before this 'YYYY-MM-DD' date
+	Sort    string `yaml:"sort"`      // "created" (newest first; default), "modified", or "title"
+	Reverse bool   `yaml:"reverse"`   // reverse the sort order
+	Desc    bool   `yaml:"desc"`      // show pages' descriptions
+	Date    bool   `yaml:"date"`      // show pages' creation dates (or modification dates if sorted by them)
+	Thumb   bool   `yaml:"thumbnail"` // show thumbnails of pages' image_path images
+	PerPage int    `yaml:"per_page"`  // maximum number of pages to list per page (0 to not paginate)
+}
+
+// pageListItem describes a single page listed by a "pagelist" block.
+type pageListItem struct {
+	URL      string
+	Title    string
+	Desc     string   // empty if not shown
+	Date     string   // e.g. "Jan 2, 2006"; empty if not shown
+	DateTime string   // e.g. "2006-01-02" for <time> element
+	Thumb    *imgInfo // nil if not shown
+}
+
+// pageListLink describes a link to one page of a paginated "pagelist" block.
+type pageListLink struct {
+	Num int
+	URL string // empty for the current page
+}
+
+// renderPageList writes the "pagelist" block described by the YAML data in b to w.
+// If the block is paginated, only the pages belonging to r.pageNum are listed.
+func (r *renderer) renderPageList(w io.Writer, b []byte) error {
+	var info pageListInfo
+	if err := unmarshalYAML(b, &info); err != nil {
+		return fmt.Errorf("failed to parse pagelist info from %q: %v", b, err)
+	}
+	if info.PerPage < 0 {
+		return fmt.Errorf("invalid per_page %d in %q", info.PerPage, b)
+	}
+	pages, err := r.selectPages(&info)
+	if err != nil {
+		return fmt.Errorf("bad data in %q: %v", b, err)
+	}
+
+	// The listed pages' page blocks were consulted, so record all of them
+	// (along with a pattern so that added pages will be noticed).
+	pat := filepath.Join(r.si.PageDir(), "*.md")
+	ps, err := filepath.Glob(pat)
+	if err != nil {
+		return err
+	}
+	r.si.deps.add(append(ps, pat)...)
+
+	var links []pageListLink
+	if info.PerPage > 0 {
+		if r.pageCount != 0 {
+			return errors.New("only one pagelist per page can set per_page")
+		}
+		r.pageCount = int(math.Ceil(float64(len(pages)) / float64(info.PerPage)))
+		if r.pageCount < 1 {
+			r.pageCount = 1
+		}
+		if r.pageCount > 1 {
+			for i := 1; i <= r.pageCount; i++ {
+				ln := pageListLink{Num: i}
+				if i != r.pageNum {
+					ln.URL = r.pageURL(i, r.amp)
+				}
+				links = append(links, ln)
+			}
+		}
+		start := (r.pageNum - 1) * info.PerPage
+		if start > len(pages) {
+			start = len(pages) // renderPage reports an error for nonexistent pages
+		}
+		end := start + info.PerPage
+		if end > len(pages) {
+			end = len(pages)
+		}
+		pages = pages[start:end]
+	}
+
+	items := make([]pageListItem, len(pages))
+	for i, p := range pages {
+		it := &items[i]
+		it.Title = p.Title
+		if it.URL, err = r.rewriteLink(p.URL); err != nil {
+			return err
+		}
+		if info.Desc {
+			it.Desc = p.Desc
+		}
+		if info.Date {
+			date := p.Created
+			if info.Sort == "modified" && !p.Modified.IsZero() {
+				date = p.Modified
+			}
+			if !date.IsZero() {
+				it.Date = date.Format("Jan 2, 2006")
+				it.DateTime = date.Format(dateLayout)
+			}
+		}
+		if info.Thumb && p.ImagePath != "" {
+			img := &imgInfo{Path: p.ImagePath, Alt: p.Title, Lazy: true, layout: "fixed", noThumb: true}
+			if err := img.finish(r.si, r.amp, &r.didThumb); err != nil {
+				return fmt.Errorf("%v thumbnail: %v", p.ID, err)
+			}
+			if img.Width > pageListThumbWidth {
+				img.Height = int(math.Round(float64(img.Height) * pageListThumbWidth / float64(img.Width)))
+				img.Width = pageListThumbWidth
+			}
+			img.Sizes = fmt.Sprintf("%dpx", img.Width)
+			it.Thumb = img
+		}
+	}
+
+	return r.tmpl.run(w, []string{"pagelist.tmpl", "img.tmpl"}, struct {
+		Items []pageListItem
+		Links []pageListLink
+	}{items, links}, nil)
+}
+
+// selectPages returns the pages from r.si.pages that are selected by info, sorted as requested.
+// The page being rendered is never included.
+func (r *renderer) selectPages(info *pageListInfo) ([]*PageSummary, error) {
+	var navIDs map[string]struct{}
+	if info.Nav != "" {
+		ni := findNavItem(r.si, info.Nav)
+		if ni == nil {
+			return nil, fmt.Errorf("no nav item with ID %q", info.Nav)
+		}
+		navIDs = make(map[string]struct{})
+		var add func(*NavItem)
+		add = func(n *NavItem) {
+			for _, c := range n.Children {
+				if c.ID != "" {
+					navIDs[c.ID] = struct{}{}
+				}
+				add(c)
+			}
+		}
+		add(ni)
+	}
+
+	var from, to time.Time
+	var err error
+	if info.From != "" {
+		if from, err = time.Parse(dateLayout, info.From); err != nil {
+			return nil, err
+		}
+	}
+	if info.To != "" {
+		if to, err = time.Parse(dateLayout, info.To); err != nil {
+			return nil, err
+		}
+	}
+
+	var pages []*PageSummary
+	for _, p := range r.si.pages {
+		if p.ID == r.pi.ID {
+			continue
+		}
+		if navIDs != nil {
+			if _, ok := navIDs[p.ID]; !ok {
+				continue
+			}
+		}
+		if info.Tag != "" && !hasTag(p.Tags, info.Tag) {
+			continue
+		}
+		if (!from.IsZero() || !to.IsZero()) &&
+			(p.Created.IsZero() || p.Created.Before(from) || (!to.IsZero() && p.Created.After(to))) {
+			continue
+		}
+		pages = append(pages, p)
+	}
+
+	// Dates are listed newest-first, with undated pages last.
+	newer := func(a, b time.Time) bool { return a.After(b) }
+	var less func(a, b *PageSummary) bool
+	switch info.Sort {
+	case "", "created":
+		less = func(a, b *PageSummary) bool { return newer(a.Created, b.Created) }
+	case "modified":
+		modified := func(p *PageSummary) time.Time {
+			if p.Modified.After(p.Created) {
+				return p.Modified
+			}
+			return p.Created
+		}
+		less = func(a, b *PageSummary) bool { return newer(modified(a), modified(b)) }
+	case "title":
+		less = func(a, b *PageSummary) bool { return strings.ToLower(a.Title) < strings.ToLower(b.Title) }
+	default:
+		return nil, fmt.Errorf("invalid sort %q", info.Sort)
+	}
+	sort.SliceStable(pages, func(i, j int) bool {
+		a, b := pages[i], pages[j]
+		if less(a, b) {
+			return true
+		} else if less(b, a) {
+			return false
+		}
+		return a.URL < b.URL
+	})
+	if info.Reverse {
+		for i, j := 0, len(pages)-1; i < j; i, j = i+1, j-1 {
+			pages[i], pages[j] = pages[j], pages[i]
+		}
+	}
+	return pages, nil
+}
+
+// hasTag returns true if tags contains tag.
+func hasTag(tags []string, tag string) bool {
+	for _, t := range tags {
+		if t == tag {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,82 @@
+// Copyright 2023 Daniel Erat.
+// All rights reserved.
+
+package render
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	bf "github.com/russross/blackfriday/v2"
+	yaml "gopkg.in/yaml.v3"
+)
+
+// ImageResize describes scaled-down versions of a static image that should be generated.
+type ImageResize struct {
+	Path   string // original image path relative to static dir, e.g. "files/img.jpg"
+	Widths []int  // widths in pixels of scaled versions
+}
+
+// ResizedImagePath returns the path of the version of the image at p scaled to width w,
+// e.g. "files/img-400.jpg" for "files/img.jpg" and 400.
+func ResizedImagePath(p string, w int) string {
+	return fmt.Sprintf("%s-%d%s", removeExt(p), w, filepath.Ext(p))
+}
+
+// PageImageResizes returns the scaled image versions requested by "image" code blocks
+// with "widths" fields in the supplied page Markdown data.
+func PageImageResizes(markdown []byte) ([]ImageResize, error) {
+	var resizes []ImageResize
+	var err error
+	ast := bf.New(bf.WithExtensions(mdExtensions)).Parse(markdown)
+	ast.Walk(func(node *bf.Node, entering bool) bf.WalkStatus {
+		if !entering || node.Type != bf.CodeBlock || string(node.CodeBlockData.Info) != "image" {
+			return bf.GoToNext
+		}
+		// Other fields are checked when the page is rendered.
+		var info struct {
+			Path   string `yaml:"path"`
+			Widths []int  `yaml:"widths"`
+		}
+		if err = yaml.Unmarshal(node.Literal, &info); err != nil {
+			err = fmt.Errorf("failed to parse image info from %q: %v", node.Literal, err)
+			return bf.Terminate
+		}
+		if len(info.Widths) > 0 {
+			if err = checkResizeWidths(info.Path, info.Widths); err != nil {
+				err = fmt.Errorf("bad data in %q: %v", node.Literal, err)
+				return bf.Terminate
+			}
+			resizes = append(resizes, ImageResize{Path: info.Path, Widths: info.Widths})
+		}
+		return bf.GoToNext
+	})
+	return resizes, err
+}
+
+// checkResizeWidths returns an error if the image at p can't be resized to widths.
+func checkResizeWidths(p string, widths []int) error {
+	if p == "" {
+		return errors.New("path must be set to use widths")
+	}
+	if strings.ContainsRune(p, '*') {
+		return errors.New("widths can't be used with wildcard paths")
+	}
+	switch filepath.Ext(p) {
+	case ".jpg", ".jpeg", ".png":
+	default:
+		return errors.New("only JPEG and PNG images can be resized")
+	}
+	if !sort.IntsAreSorted(widths) {
+		return fmt.Errorf("widths %v aren't ascending", widths)
+	}
+	for i, w := range widths {
+		if w <= 0 || (i > 0 && w == widths[i-1]) {
+			return fmt.Errorf("bad width %d", w)
+		}
+	}
+	return nil
+}
@@ -15,7 +15,7 @@ import (
 )
 
 // Process inline/*.scss into inline/*.css.
-//go:generate gen/gen_css.sh
+//go:generate sh -c "go run gen/gen_css.go inline/*.scss"
 
 // Generate an std_inline.go file that defines a map[string]string named stdInline.
 //go:generate sh -c "go run gen/gen_filemap.go stdInline inline/*.css inline/*.js | gofmt -s >std_inline.go"
@@ -42,6 +42,14 @@ type SiteInfo struct {
 	FeedTitle string `yaml:"feed_title"`
 	// FeedDesc is used as the description for the RSS (Atom) feed.
 	FeedDesc string `yaml:"feed_desc"`
+	// FeedItems is the maximum number of pages listed in feeds. Defaults to 10.
+	FeedItems int `yaml:"feed_items"`
+	// FeedRSS indicates that an RSS 2.0 feed should be written to RSSFeedFile
+	// in addition to the Atom feed.
+	FeedRSS bool `yaml:"feed_rss"`
+	// FeedJSON indicates that a JSON Feed should be written to JSONFeedFile
+	// in addition to the Atom feed.
+	FeedJSON bool `yaml:"feed_json"`
 
 	// LogoPathHTML is the image at the top of the page for non-AMP, e.g. "resources/logo-*.png".
 	// The image's intrinsic dimensions for larger displays come from the smallest image.
@@ -128,14 +136,111 @@ type SiteInfo struct {
 
 	// CompressPages specifies whether a .html.gz, gzip-compressed file should be generated
 	// alongside every .html file. This is useful for web hosts that don't automatically compress
-	// pages when they are being served.
+	// pages when they are being served. It is equivalent to setting CompressEncodings to ["gzip"].
 	CompressPages bool `yaml:"compress_pages"`
+	// CompressEncodings lists encodings of precompressed copies of textual files that should be
+	// written alongside the original files. Supported values are "gzip" (".gz"), "br" (".br"),
+	// and "zstd" (".zst"). Copies that aren't smaller than the original file are skipped.
+	CompressEncodings []string `yaml:"compress_encodings"`
+	// CompressLevel is "fastest", "default" (the default), or "best".
+	CompressLevel string `yaml:"compress_level"`
+	// CompressExts lists the extensions of files to compress, e.g. [".html", ".css"].
+	// Common textual extensions are used by default.
+	CompressExts []string `yaml:"compress_extensions"`
+
+	// BuildManifestFile is the path within the output dir of a JSON file listing every output file
+	// along with its size, SHA-256 hash, content type, and source. It is not listed in the sitemap.
+	// The manifest isn't written if this is empty. "manifest.json" is used by default.
+	BuildManifestFile string `yaml:"build_manifest_file"`
+
+	// FingerprintStatic contains path.Match patterns matching files in the static dir and
+	// generated images that should be renamed to include hashes of their contents
+	// (e.g. "img/logo.png" becomes "img/logo.3f2a9c.png") so they can be cached indefinitely.
+	// Patterns without slashes (e.g. "*.png") are also matched against base names. References
+	// in pages and iframes are rewritten, but references within static files are not.
+	FingerprintStatic []string `yaml:"fingerprint_static"`
+
+	// PageBudgets contains optional per-page size limits. If any are set, a table listing each
+	// page's sizes is printed after building and the build fails if a limit is exceeded.
+	// AMP's limit on <style amp-custom> is always enforced.
+	PageBudgets PageBudgets `yaml:"page_budgets"`
+
+	// GenerateAVIF indicates that AVIF versions of JPEG and PNG images should be generated using
+	// avifenc and offered to browsers before WebP versions in non-AMP pages.
+	GenerateAVIF bool `yaml:"generate_avif"`
+
+	// Validator names the backend used to validate generated pages: "w3c" (the default) uses the
+	// W3C's online services, "vnu" uses a local copy of the Nu Html Checker, and "builtin" performs
+	// structural checks without any external tools.
+	Validator string `yaml:"validator"`
+	// VNUPath contains the path to vnu.jar (run via java) or a vnu executable for the "vnu" validator.
+	// "vnu.jar" is used by default.
+	VNUPath string `yaml:"vnu_path"`
+	// Validation contains additional settings for validating generated pages.
+	Validation ValidationInfo `yaml:"validation"`
+
+	// UseSassc indicates that the sassc executable should be used to compile .scss files in the
+	// inline dir instead of the built-in compiler, which only supports a subset of Sass.
+	UseSassc bool `yaml:"use_sassc"`
+
+	// LiveReload indicates that non-AMP pages should include a script that reloads them after the
+	// site is rebuilt. It is set while watching the site for changes rather than via site.yaml.
+	LiveReload bool `yaml:"-"`
 
 	// dir contains the path to the base site directory (i.e. containing the "pages" subdirectory).
 	// It is assumed to be the directory that the SiteInfo was loaded from.
 	dir string
 
-	codeCSS string // CSS class definitions for code syntax highlighting
+	codeCSS      string   // CSS class definitions for code syntax highlighting
+	codeContrast []string // descriptions of code colors with low contrast
+
+	fingerprints *fingerprintCache // shared by copies returned by WithDeps
+
+	deps     *Deps    // records files consulted while rendering (may be nil)
+	siteDeps []string // files consulted by NewSiteInfo
+
+	pages []*PageSummary // pages that can be listed by "pagelist" code blocks (see WithPages)
+}
+
+// PageBudgets contains per-page size limits in bytes. Zero values are ignored.
+type PageBudgets struct {
+	// HTML limits the size of each HTML document.
+	HTML int `yaml:"html"`
+	// InlineCSS limits the total size of the CSS in each page's <style> elements.
+	InlineCSS int `yaml:"inline_css"`
+	// InlineJS limits the total size of the JS in each page's <script> elements without src attributes
+	// (excluding JSON data like structured data).
+	InlineJS int `yaml:"inline_js"`
+	// Images limits the total size of the images referenced by each page's <img> and <amp-img>
+	// elements. When a srcset attribute is present, the smallest image that's at least as wide as
+	// the image's displayed width is counted, and <source> elements in <picture> elements are preferred.
+	Images int `yaml:"images"`
+}
+
+// ValidationInfo contains settings for validating generated pages.
+type ValidationInfo struct {
+	// Accessibility indicates that generated pages should also be checked for accessibility
+	// problems: skipped heading levels, placeholder alt text (e.g. filenames), and links without
+	// discernible text. Code highlighting colors with low contrast against
+	// their backgrounds are also reported. Issues have type "a11y".
+	Accessibility bool `yaml:"accessibility"`
+	// Ignore contains rules for ignoring validation issues in addition to the built-in rules.
+	// A warning is logged for each rule that doesn't match any issues.
+	Ignore []ValidationIgnore `yaml:"ignore"`
+}
+
+// ValidationIgnore describes a rule for ignoring validation issues.
+type ValidationIgnore struct {
+	// Type is the type of validation that the rule applies to: "html", "amp", "css", or "a11y".
+	Type string `yaml:"type"`
+	// Message is a regular expression matching issue messages, e.g. "^Bad value .* for attribute".
+	Message string `yaml:"message"`
+	// Files optionally contains a path.Match pattern matching the paths of files within the output
+	// dir (e.g. "cats/*.html"). Patterns without slashes are also matched against base names.
+	// The rule applies to all files if this is empty.
+	Files string `yaml:"files"`
+	// Expires optionally contains a date in "YYYY-MM-DD" format. The rule isn't applied after it.
+	Expires string `yaml:"expires"`
 }
 
 const (
@@ -144,6 +249,10 @@ const (
 	codeMinBrightnessDark  = 0.7
 )
 
+// LiveReloadFile is the name of a file in the root of the output dir that is rewritten after
+// each build when SiteInfo.LiveReload is true. The live-reload script watches it for changes.
+const LiveReloadFile = ".live-reload"
+
 type linkTagInfo struct{ Rel, Href, Sizes, Type string }
 
 // NewSiteInfo constructs a new SiteInfo from the YAML file at p.
@@ -157,10 +266,15 @@ func NewSiteInfo(p string) (*SiteInfo, error) {
 	si := SiteInfo{
 		CodeStyleLight:                    "github",
 		CodeStyleDark:                     "dracula",
+		BuildManifestFile:                 "manifest.json",
+		FeedItems:                         10,
+		VNUPath:                           "vnu.jar",
 		D3ScriptURL:                       "https://d3js.org/d3.v3.min.js",
 		CloudflareAnalyticsScriptURL:      "https://static.cloudflareinsights.com/beacon.min.js",
 		CloudflareAnalyticsConnectPattern: "https://cloudflareinsights.com",
 		dir:                               filepath.Dir(p),
+		fingerprints:                      &fingerprintCache{paths: make(map[string]string)},
+		deps:                              &Deps{},
 	}
 	dec := yaml.NewDecoder(f)
 	dec.KnownFields(true)
@@ -168,20 +282,31 @@ func NewSiteInfo(p string) (*SiteInfo, error) {
 		return nil, err
 	}
 
+	if err := si.checkFingerprintPatterns(); err != nil {
+		return nil, err
+	}
+
 	ip := filepath.Join(si.PageDir(), "index.md")
 	if _, err := os.Stat(ip); err != nil {
 		return nil, err
 	}
 
-	if si.codeCSS, err = getCodeCSS(si.CodeStyleLight, si.CodeStyleLight, "body:not(.dark)",
+	var lowContrast []string
+	if si.codeCSS, lowContrast, err = getCodeCSS(si.CodeStyleLight, si.CodeStyleLight, "body:not(.dark)",
 		0, codeMaxBrightnessLight, si.CodeForcePlain); err != nil {
 		return nil, err
 	}
-	if css, err := getCodeCSS(si.CodeStyleDark, si.CodeStyleLight, "body.dark ",
+	for _, s := range lowContrast {
+		si.codeContrast = append(si.codeContrast, fmt.Sprintf("code_style_light %q: %s", si.CodeStyleLight, s))
+	}
+	if css, lowContrast, err := getCodeCSS(si.CodeStyleDark, si.CodeStyleLight, "body.dark ",
 		codeMinBrightnessDark, 1, si.CodeForcePlain); err != nil {
 		return nil, err
 	} else {
 		si.codeCSS += css
+		for _, s := range lowContrast {
+			si.codeContrast = append(si.codeContrast, fmt.Sprintf("code_style_dark %q: %s", si.CodeStyleDark, s))
+		}
 	}
 
 	// See https://dev.to/masakudamatsu/favicon-nightmare-how-to-maintain-sanity-3al7.
@@ -195,6 +320,7 @@ func NewSiteInfo(p string) (*SiteInfo, error) {
 		case ".ico":
 			si.LinkTags = append(si.LinkTags, linkTagInfo{Rel: "icon", Href: fp, Sizes: "any"})
 		default:
+			si.deps.add(filepath.Join(si.StaticDir(), fp))
 			width, height, err := imageSize(filepath.Join(si.StaticDir(), fp))
 			if err != nil {
 				return nil, fmt.Errorf("failed getting favicon dimensions: %v", err)
@@ -207,6 +333,7 @@ func NewSiteInfo(p string) (*SiteInfo, error) {
 		}
 	}
 	if si.AppleTouchIconPath != "" {
+		si.deps.add(filepath.Join(si.StaticDir(), si.AppleTouchIconPath))
 		width, height, err := imageSize(filepath.Join(si.StaticDir(), si.AppleTouchIconPath))
 		if err != nil {
 			return nil, fmt.Errorf("failed getting apple-touch-icon dimensions: %v", err)
@@ -223,16 +350,50 @@ func NewSiteInfo(p string) (*SiteInfo, error) {
 		}
 		si.LinkTags = append(si.LinkTags, linkTagInfo{Rel: "manifest", Href: si.ManifestPath})
 	}
+	for i := range si.LinkTags {
+		if si.LinkTags[i].Href, err = si.staticURL(si.LinkTags[i].Href); err != nil {
+			return nil, err
+		}
+	}
+
+	// Save the files that were consulted so they can be reported by WithDeps.
+	si.siteDeps = si.deps.Paths()
+	si.deps = nil
 
 	return &si, nil
 }
 
+// WithDeps returns a copy of si that records the paths of files that it consults to d.
+// Files that were consulted while loading si are also recorded to d.
+// This can be used to track which files were used to render a page or iframe.
+func (si SiteInfo) WithDeps(d *Deps) SiteInfo {
+	si.deps = d
+	si.deps.add(si.siteDeps...)
+	return si
+}
+
+// WithPages returns a copy of si that lists pages in "pagelist" code blocks.
+// pages should contain summaries of all of the site's pages (see ReadPageSummary).
+func (si SiteInfo) WithPages(pages []*PageSummary) SiteInfo {
+	si.pages = pages
+	return si
+}
+
+// CodeContrastIssues returns descriptions of colors used for syntax highlighting (after
+// brightness adjustment) that don't have enough contrast against their backgrounds.
+func (si *SiteInfo) CodeContrastIssues() []string {
+	return si.codeContrast
+}
+
 // ReadInline reads and returns the contents of the named file in si.InlineDir or si.InlineGenDir.
 // It returns an empty string if the file does not exist and panics if the file cannot be read.
 func (si *SiteInfo) ReadInline(fn string) string {
-	b, err := ioutil.ReadFile(filepath.Join(si.InlineDir(), fn))
+	// Record both paths so that a newly-added file will be noticed.
+	p, gp := filepath.Join(si.InlineDir(), fn), filepath.Join(si.InlineGenDir(), fn)
+	si.deps.add(p, gp)
+	b, err := ioutil.ReadFile(p)
 	if os.IsNotExist(err) {
-		b, err = ioutil.ReadFile(filepath.Join(si.InlineGenDir(), fn))
+		b, err = ioutil.ReadFile(gp)
 	}
 	if os.IsNotExist(err) {
 		return ""
@@ -251,17 +412,34 @@ func (si *SiteInfo) ReadInline(fn string) string {
 func (si *SiteInfo) CheckStatic(p string) error {
 	for src, dst := range si.ExtraStaticDirs {
 		if p == dst || strings.HasPrefix(dst+"/", p) {
-			_, err := os.Stat(filepath.Join(si.dir, src, p[len(dst):]))
+			sp := filepath.Join(si.dir, src, p[len(dst):])
+			si.deps.add(sp)
+			_, err := os.Stat(sp)
 			return err
 		}
 	}
-	if _, err := os.Stat(filepath.Join(si.StaticGenDir(), p)); err == nil {
+	gp, sp := filepath.Join(si.StaticGenDir(), p), filepath.Join(si.StaticDir(), p)
+	si.deps.add(gp, sp)
+	if _, err := os.Stat(gp); err == nil {
 		return nil
 	}
-	_, err := os.Stat(filepath.Join(si.StaticDir(), p))
+	_, err := os.Stat(sp)
 	return err
 }
 
+// staticFile returns the full path to p (e.g. "foo/bar.png") within si.StaticDir,
+// or within si.StaticGenDir if it doesn't exist in the former (e.g. for generated images).
+func (si *SiteInfo) staticFile(p string) string {
+	gp, sp := filepath.Join(si.StaticGenDir(), p), filepath.Join(si.StaticDir(), p)
+	si.deps.add(gp, sp)
+	if _, err := os.Stat(sp); err != nil {
+		if _, err := os.Stat(gp); err == nil {
+			return gp
+		}
+	}
+	return sp
+}
+
 func (si *SiteInfo) InlineDir() string {
 	return filepath.Join(si.dir, "inline")
 }
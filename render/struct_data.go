@@ -11,6 +11,7 @@ type structData struct {
 	Description      string `json:"description,omitempty"`
 	DateModified     string `json:"dateModified,omitempty"`
 	DatePublished    string `json:"datePublished,omitempty"`
+	Keywords         string `json:"keywords,omitempty"`
 
 	Author    structDataAuthor    `json:"author"`
 	Publisher structDataPublisher `json:"publisher"`
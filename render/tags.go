@@ -0,0 +1,181 @@
+// Copyright 2023 Daniel Erat.
+// All rights reserved.
+
+package render
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+
+	yaml "gopkg.in/yaml.v3"
+)
+
+const (
+	tagPagePrefix = "tag_" // prefix for IDs and filenames of pages listing a tag's pages
+	tagIndexID    = "tags" // ID of the page listing all tags
+
+	// TagIndexPage is the filename of the page listing all tags.
+	TagIndexPage = tagIndexID + HTMLExt
+)
+
+// tagLink describes a link to a tag's page.
+type tagLink struct {
+	Name string // tag as written in page blocks
+	URL  string // relative URL of the tag's page
+}
+
+// tagSlug returns the string used to identify tag in IDs and filenames.
+// Letters are lowercased, digits are preserved, and other characters are replaced by
+// underscores so that the resulting filenames are matched by tagPageRegexp.
+func tagSlug(tag string) (string, error) {
+	slug := strings.Map(func(r rune) rune {
+		if r >= 'A' && r <= 'Z' {
+			return r - 'A' + 'a'
+		}
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') {
+			return r
+		}
+		return '_'
+	}, strings.TrimSpace(tag))
+	if strings.Trim(slug, "_") == "" {
+		return "", fmt.Errorf("tag %q doesn't contain any letters or digits", tag)
+	}
+	return slug, nil
+}
+
+// TagPageFile returns the filename of the non-AMP page listing pages tagged with tag,
+// e.g. "tag_cats.html".
+func TagPageFile(tag string) (string, error) {
+	slug, err := tagSlug(tag)
+	if err != nil {
+		return "", err
+	}
+	return tagPagePrefix + slug + HTMLExt, nil
+}
+
+// TagFeedFile returns the filename of the Atom feed listing pages tagged with tag,
+// e.g. "tag_cats.xml".
+func TagFeedFile(tag string) (string, error) {
+	slug, err := tagSlug(tag)
+	if err != nil {
+		return "", err
+	}
+	return tagPagePrefix + slug + ".xml", nil
+}
+
+// TagPage renders a page listing pages (which should all be tagged with tag).
+// The page is named as described by TagPageFile and links to the tag's feed.
+func TagPage(si SiteInfo, tag string, pages []*PageSummary, amp bool) ([]byte, *PageMeta, error) {
+	fn, err := TagPageFile(tag)
+	if err != nil {
+		return nil, nil, err
+	}
+	var b bytes.Buffer
+	if err := writeTagPageBlock(&b, "Tag: "+tag, fmt.Sprintf("Pages tagged %q.", tag)); err != nil {
+		return nil, nil, err
+	}
+	fmt.Fprintf(&b, "# Pages tagged \"%s\"\n\n", escapeMarkdown(tag))
+	writePageList(&b, pages)
+	fmt.Fprintf(&b, "\n[All tags](%s)\n", TagIndexPage)
+
+	id := strings.TrimSuffix(fn, HTMLExt)
+	r := newRenderer(si, id, amp)
+	r.defaultNav = &NavItem{ID: id, URL: fn}
+	if r.feedFile, err = TagFeedFile(tag); err != nil {
+		return nil, nil, err
+	}
+	return renderPage(r, b.Bytes())
+}
+
+// TagIndex renders a page listing all of the tags in tagged, a map from tags to
+// the pages that use them.
+func TagIndex(si SiteInfo, tagged map[string][]*PageSummary, amp bool) ([]byte, *PageMeta, error) {
+	tags := make([]string, 0, len(tagged))
+	for tag := range tagged {
+		tags = append(tags, tag)
+	}
+	sort.Slice(tags, func(i, j int) bool {
+		a, b := strings.ToLower(tags[i]), strings.ToLower(tags[j])
+		if a != b {
+			return a < b
+		}
+		return tags[i] < tags[j]
+	})
+
+	var b bytes.Buffer
+	if err := writeTagPageBlock(&b, "Tags", "All tags used on this site."); err != nil {
+		return nil, nil, err
+	}
+	b.WriteString("# Tags\n\n")
+	for _, tag := range tags {
+		fn, err := TagPageFile(tag)
+		if err != nil {
+			return nil, nil, err
+		}
+		n := len(tagged[tag])
+		noun := "pages"
+		if n == 1 {
+			noun = "page"
+		}
+		fmt.Fprintf(&b, "*   [%s](%s) (%d %s)\n", escapeMarkdown(tag), fn, n, noun)
+	}
+
+	r := newRenderer(si, tagIndexID, amp)
+	r.defaultNav = &NavItem{ID: tagIndexID, URL: TagIndexPage}
+	return renderPage(r, b.Bytes())
+}
+
+// writeTagPageBlock writes a "page" code block with the supplied title and description
+// for a generated tag page to w.
+func writeTagPageBlock(w *bytes.Buffer, title, desc string) error {
+	b, err := yaml.Marshal(struct {
+		Title        string `yaml:"title"`
+		Desc         string `yaml:"desc"`
+		HideDates    bool   `yaml:"hide_dates"`
+		OmitFromFeed bool   `yaml:"omit_from_feed"`
+	}{title, desc, true, true})
+	if err != nil {
+		return err
+	}
+	w.WriteString("```page\n")
+	w.Write(b)
+	w.WriteString("```\n\n")
+	return nil
+}
+
+// writePageList writes a Markdown list describing pages to w.
+// Pages are listed newest-first, with undated pages last.
+func writePageList(w *bytes.Buffer, pages []*PageSummary) {
+	pages = append([]*PageSummary{}, pages...)
+	sort.SliceStable(pages, func(i, j int) bool {
+		a, b := pages[i], pages[j]
+		if !a.Created.Equal(b.Created) {
+			return a.Created.After(b.Created)
+		}
+		return a.Title < b.Title
+	})
+	for _, p := range pages {
+		fmt.Fprintf(w, "*   [%s](%s)", escapeMarkdown(p.Title), p.URL)
+		if p.Desc != "" {
+			fmt.Fprintf(w, " — %s", escapeMarkdown(p.Desc))
+		}
+		if !p.Created.IsZero() {
+			fmt.Fprintf(w, " (%s)", p.Created.Format("Jan 2, 2006"))
+		}
+		w.WriteString("\n")
+	}
+}
+
+// escapeMarkdown backslash-escapes characters in s that have special meaning in Markdown.
+func escapeMarkdown(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		if strings.ContainsRune("\\`*_{}[]()<>#+-.!|~", r) {
+			b.WriteByte('\\')
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
@@ -0,0 +1,37 @@
+// Copyright 2023 Daniel Erat.
+// All rights reserved.
+
+package render
+
+import "testing"
+
+func TestTagPageFile(t *testing.T) {
+	for _, tc := range []struct {
+		tag  string
+		want string // empty if an error is expected
+	}{
+		{"cats", "tag_cats" + HTMLExt},
+		{"Cats", "tag_cats" + HTMLExt},
+		{" Big Cats ", "tag_big_cats" + HTMLExt},
+		{"c++", "tag_c__" + HTMLExt},
+		{"2020", "tag_2020" + HTMLExt},
+		{"3D", "tag_3d" + HTMLExt},
+		{"IPv4", "tag_ipv4" + HTMLExt},
+		{"IPv6", "tag_ipv6" + HTMLExt},
+		{"#!", ""},
+		{"", ""},
+	} {
+		got, err := TagPageFile(tc.tag)
+		if tc.want == "" {
+			if err == nil {
+				t.Errorf("TagPageFile(%q) unexpectedly succeeded with %q", tc.tag, got)
+			}
+		} else if err != nil {
+			t.Errorf("TagPageFile(%q) failed: %v", tc.tag, err)
+		} else if got != tc.want {
+			t.Errorf("TagPageFile(%q) = %q; want %q", tc.tag, got, tc.want)
+		} else if !isPage(got) {
+			t.Errorf("TagPageFile(%q) returned non-page %q", tc.tag, got)
+		}
+	}
+}
@@ -17,14 +17,15 @@ import (
 // templater caches and executes HTML templates.
 type templater struct {
 	dir         string
+	deps        *Deps // records template files loaded from dir (may be nil)
 	commonFuncs template.FuncMap
 	tmpls       map[string]*template.Template
 }
 
 // newTemplater returns a templater that will load templates from the supplied directory.
 // TODO: Delete dir arg if it's unneeded.
-func newTemplater(dir string, commonFuncs template.FuncMap) *templater {
-	return &templater{dir, commonFuncs, make(map[string]*template.Template)}
+func newTemplater(dir string, deps *Deps, commonFuncs template.FuncMap) *templater {
+	return &templater{dir, deps, commonFuncs, make(map[string]*template.Template)}
 }
 
 // load loads and caches a template consisting of the supplied files and functions.
@@ -60,6 +61,7 @@ func (t *templater) load(files []string, funcs template.FuncMap) (*template.Temp
 		}
 	}
 	if len(paths) > 0 {
+		t.deps.add(paths...)
 		if _, err := tmpl.ParseFiles(paths...); err != nil {
 			return nil, err
 		}
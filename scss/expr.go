@@ -0,0 +1,203 @@
+// Copyright 2023 Daniel Erat.
+// All rights reserved.
+
+package scss
+
+import "strings"
+
+// cssFuncs lists plain CSS functions that may be used in values.
+// Calls to other functions (e.g. Sass's darken() or map-get()) are rejected.
+var cssFuncs = map[string]struct{}{
+	"attr": {}, "blur": {}, "brightness": {}, "calc": {}, "clamp": {}, "color": {},
+	"conic-gradient": {}, "contrast": {}, "counter": {}, "counters": {}, "cubic-bezier": {},
+	"drop-shadow": {}, "env": {}, "fit-content": {}, "format": {}, "grayscale": {},
+	"hsl": {}, "hsla": {}, "hue-rotate": {}, "hwb": {}, "image-set": {}, "invert": {},
+	"lab": {}, "lch": {}, "linear-gradient": {}, "local": {}, "matrix": {}, "matrix3d": {},
+	"max": {}, "min": {}, "minmax": {}, "opacity": {}, "perspective": {},
+	"radial-gradient": {}, "repeat": {}, "repeating-conic-gradient": {},
+	"repeating-linear-gradient": {}, "repeating-radial-gradient": {}, "rgb": {}, "rgba": {},
+	"rotate": {}, "rotate3d": {}, "rotateX": {}, "rotateY": {}, "rotateZ": {},
+	"saturate": {}, "scale": {}, "scale3d": {}, "scaleX": {}, "scaleY": {}, "scaleZ": {},
+	"sepia": {}, "skew": {}, "skewX": {}, "skewY": {}, "steps": {},
+	"translate": {}, "translate3d": {}, "translateX": {}, "translateY": {}, "translateZ": {},
+	"url": {}, "var": {},
+}
+
+// mathFuncs lists CSS functions whose arguments may contain arithmetic operators.
+var mathFuncs = map[string]struct{}{"calc": {}, "clamp": {}, "max": {}, "min": {}}
+
+// exprTokenType describes the type of an exprToken.
+type exprTokenType int
+
+const (
+	operandToken  exprTokenType = iota // number (with optional unit) or variable
+	operatorToken                      // one of "+-*/%"
+	otherToken                         // anything else
+)
+
+// exprToken is a token from a value passed to checkExpr.
+type exprToken struct {
+	typ      exprTokenType
+	text     string
+	space    bool // preceded by whitespace
+	inMath   bool // within the arguments of one of mathFuncs
+	variable bool // operandToken is a variable, e.g. "$foo"
+}
+
+// checkExpr returns an error if the value s (from n) uses Sass features that aren't
+// supported: arithmetic between numbers or variables and calls to non-CSS functions.
+// Arithmetic is permitted within CSS math functions like calc(), and '/' is only rejected
+// when used with a variable, since it's also used as a separator in plain CSS
+// (e.g. "font: 12px/1.5 serif").
+func checkExpr(n *node, s string) error {
+	var toks []exprToken
+	var funcs []string // names of functions whose parens we're in ("" for plain parens)
+	mathDepth := 0     // number of entries in funcs that are in mathFuncs
+	space := false
+	add := func(typ exprTokenType, text string) {
+		toks = append(toks, exprToken{typ: typ, text: text, space: space, inMath: mathDepth > 0,
+			variable: strings.HasPrefix(text, "$")})
+		space = false
+	}
+
+	for i := 0; i < len(s); {
+		ch := s[i]
+		switch {
+		case isSpace(ch):
+			space = true
+			i++
+		case ch == '"' || ch == '\'':
+			j := i + 1
+			for j < len(s) && s[j] != ch {
+				if s[j] == '\\' {
+					j++
+				}
+				j++
+			}
+			if j >= len(s) {
+				j = len(s) - 1
+			}
+			add(otherToken, s[i:j+1])
+			i = j + 1
+		case strings.HasPrefix(s[i:], "#{"):
+			j := strings.IndexByte(s[i:], '}')
+			if j < 0 {
+				j = len(s) - i - 1
+			}
+			add(otherToken, s[i:i+j+1])
+			i += j + 1
+		case ch == '$':
+			j := i + 1
+			for j < len(s) && isNameChar(s[j]) {
+				j++
+			}
+			add(operandToken, s[i:j])
+			i = j
+		case isDigit(ch) || (ch == '.' && i+1 < len(s) && isDigit(s[i+1])):
+			j := i
+			for j < len(s) && (isDigit(s[j]) || s[j] == '.') {
+				j++
+			}
+			for j < len(s) && (isNameChar(s[j]) || s[j] == '%') {
+				j++ // unit
+			}
+			add(operandToken, s[i:j])
+			i = j
+		case ch == '#':
+			j := i + 1
+			for j < len(s) && isNameChar(s[j]) {
+				j++
+			}
+			add(otherToken, s[i:j]) // color, e.g. "#fff"
+			i = j
+		case isIdentStart(s[i:]):
+			j := i
+			for j < len(s) && isNameChar(s[j]) {
+				j++
+			}
+			name := s[i:j]
+			if j < len(s) && s[j] == '(' {
+				if _, ok := cssFuncs[name]; !ok {
+					return n.errorf("unsupported function %s()", name)
+				}
+				if name == "url" {
+					// Unquoted URLs can contain arbitrary characters, so skip to the closing paren.
+					end := strings.IndexByte(s[j:], ')')
+					if end < 0 {
+						end = len(s) - j - 1
+					}
+					add(otherToken, s[i:j+end+1])
+					i = j + end + 1
+					continue
+				}
+				funcs = append(funcs, name)
+				if _, ok := mathFuncs[name]; ok {
+					mathDepth++
+				}
+				add(otherToken, s[i:j+1])
+				i = j + 1
+				continue
+			}
+			add(otherToken, name)
+			i = j
+		case ch == '(':
+			funcs = append(funcs, "")
+			add(otherToken, "(")
+			i++
+		case ch == ')':
+			if len(funcs) > 0 {
+				if _, ok := mathFuncs[funcs[len(funcs)-1]]; ok {
+					mathDepth--
+				}
+				funcs = funcs[:len(funcs)-1]
+			}
+			add(otherToken, ")")
+			i++
+		case strings.IndexByte("+-*/%", ch) >= 0:
+			add(operatorToken, string(ch))
+			i++
+		default:
+			add(otherToken, string(ch))
+			i++
+		}
+	}
+
+	for i := 1; i+1 < len(toks); i++ {
+		op, a, b := toks[i], toks[i-1], toks[i+1]
+		if op.typ != operatorToken || op.inMath || a.typ != operandToken || b.typ != operandToken {
+			continue
+		}
+		var bad bool
+		switch op.text {
+		case "/":
+			bad = a.variable || b.variable
+		case "-":
+			// "1px -2px" is a list containing a negative number.
+			bad = op.space == b.space && (op.space || a.variable || b.variable)
+		default:
+			bad = op.space == b.space
+		}
+		if bad {
+			return n.errorf("unsupported arithmetic %q", a.text+" "+op.text+" "+b.text)
+		}
+	}
+	return nil
+}
+
+// isIdentStart returns true if s starts with a CSS identifier (e.g. "foo" or "-webkit-foo").
+func isIdentStart(s string) bool {
+	isStart := func(ch byte) bool {
+		return ch == '_' || (ch >= 'a' && ch <= 'z') || (ch >= 'A' && ch <= 'Z')
+	}
+	if s == "" {
+		return false
+	}
+	if s[0] == '-' {
+		return len(s) > 1 && (isStart(s[1]) || s[1] == '-')
+	}
+	return isStart(s[0])
+}
+
+func isDigit(ch byte) bool {
+	return ch >= '0' && ch <= '9'
+}
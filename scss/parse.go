@@ -0,0 +1,266 @@
+// Copyright 2023 Daniel Erat.
+// All rights reserved.
+
+package scss
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Error describes a problem encountered while compiling SCSS.
+type Error struct {
+	File string // path of file containing error
+	Line int    // 1-indexed line number
+	Msg  string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s:%d: %s", e.File, e.Line, e.Msg)
+}
+
+type nodeType int
+
+const (
+	declNode nodeType = iota // "prop: value"
+	varNode                  // "$name: value"
+	ruleNode                 // "selector { ... }"
+	atNode                   // "@name params;" or "@name params { ... }"
+)
+
+// node is a single statement in a parsed SCSS file.
+type node struct {
+	typ      nodeType
+	file     string
+	line     int
+	name     string  // property, variable name (without '$'), selector, or at-rule name (without '@')
+	value    string  // declaration or variable value, or at-rule params
+	block    bool    // true if an at-rule has a block
+	children []*node // statements within block
+}
+
+// errorf returns an *Error describing a problem at n.
+func (n *node) errorf(format string, args ...interface{}) error {
+	return &Error{File: n.file, Line: n.line, Msg: fmt.Sprintf(format, args...)}
+}
+
+// parser splits SCSS data into nodes.
+type parser struct {
+	file string
+	data string
+	pos  int
+	line int
+}
+
+// parse parses the supplied SCSS data. file is only used in error messages.
+func parse(file, data string) ([]*node, error) {
+	p := parser{file: file, data: data, line: 1}
+	return p.parseBlock(true)
+}
+
+func (p *parser) errorf(line int, format string, args ...interface{}) error {
+	return &Error{File: p.file, Line: line, Msg: fmt.Sprintf(format, args...)}
+}
+
+// parseBlock parses statements until the end of the current block.
+// If top is true, statements are read until the end of the data.
+// Otherwise, statements are read until (and including) the closing '}'.
+func (p *parser) parseBlock(top bool) ([]*node, error) {
+	var nodes []*node
+	for {
+		if err := p.skipSpace(); err != nil {
+			return nil, err
+		}
+		if p.pos == len(p.data) {
+			if !top {
+				return nil, p.errorf(p.line, "missing '}'")
+			}
+			return nodes, nil
+		}
+		if p.data[p.pos] == '}' {
+			if top {
+				return nil, p.errorf(p.line, "unexpected '}'")
+			}
+			p.pos++
+			return nodes, nil
+		}
+
+		line := p.line
+		text, term, err := p.readStatement()
+		if err != nil {
+			return nil, err
+		}
+		n := &node{file: p.file, line: line}
+
+		if term == '{' {
+			if strings.HasPrefix(text, "@") {
+				n.typ = atNode
+				n.name, n.value = splitAtRule(text)
+				n.block = true
+			} else if strings.HasSuffix(text, ":") {
+				return nil, p.errorf(line, "nested properties are unsupported")
+			} else if text == "" {
+				return nil, p.errorf(line, "missing selector")
+			} else {
+				n.typ = ruleNode
+				n.name = text
+			}
+			if n.children, err = p.parseBlock(false); err != nil {
+				return nil, err
+			}
+			nodes = append(nodes, n)
+			continue
+		}
+
+		// The statement was terminated by ';', '}', or EOF.
+		if text == "" {
+			continue
+		}
+		switch {
+		case strings.HasPrefix(text, "@"):
+			n.typ = atNode
+			n.name, n.value = splitAtRule(text)
+		case strings.HasPrefix(text, "$"):
+			n.typ = varNode
+			i := strings.IndexByte(text, ':')
+			if i < 0 {
+				return nil, p.errorf(line, "expected ':' in variable declaration %q", text)
+			}
+			n.name = strings.TrimSpace(text[1:i])
+			n.value = strings.TrimSpace(text[i+1:])
+		default:
+			n.typ = declNode
+			i := strings.IndexByte(text, ':')
+			if i < 0 {
+				return nil, p.errorf(line, "expected declaration but got %q", text)
+			}
+			n.name = strings.TrimSpace(text[:i])
+			n.value = strings.TrimSpace(text[i+1:])
+		}
+		nodes = append(nodes, n)
+	}
+}
+
+// skipSpace advances past whitespace and comments.
+func (p *parser) skipSpace() error {
+	for p.pos < len(p.data) {
+		switch ch := p.data[p.pos]; {
+		case ch == '\n':
+			p.line++
+			p.pos++
+		case ch == ' ' || ch == '\t' || ch == '\r' || ch == '\f':
+			p.pos++
+		case strings.HasPrefix(p.data[p.pos:], "//"):
+			p.skipLineComment()
+		case strings.HasPrefix(p.data[p.pos:], "/*"):
+			if err := p.skipBlockComment(); err != nil {
+				return err
+			}
+		default:
+			return nil
+		}
+	}
+	return nil
+}
+
+func (p *parser) skipLineComment() {
+	for p.pos < len(p.data) && p.data[p.pos] != '\n' {
+		p.pos++
+	}
+}
+
+func (p *parser) skipBlockComment() error {
+	line := p.line
+	end := strings.Index(p.data[p.pos+2:], "*/")
+	if end < 0 {
+		return p.errorf(line, "unterminated comment")
+	}
+	end += p.pos + 4
+	p.line += strings.Count(p.data[p.pos:end], "\n")
+	p.pos = end
+	return nil
+}
+
+// readStatement reads text up to the next ';', '{', or '}' that isn't within a string,
+// parentheses, brackets, or interpolation. Comments are dropped and the text is trimmed.
+// The terminating character is consumed (unless it is '}') and returned.
+// 0 is returned as the terminator if the end of the data is reached.
+func (p *parser) readStatement() (text string, term byte, err error) {
+	var sb strings.Builder
+	var depth int  // nesting of parens, brackets, and interpolation
+	var quote byte // active quote char
+	line := p.line // start line for error messages
+	for p.pos < len(p.data) {
+		ch := p.data[p.pos]
+		if ch == '\n' {
+			p.line++
+		}
+		if quote != 0 {
+			sb.WriteByte(ch)
+			p.pos++
+			if ch == '\\' && p.pos < len(p.data) {
+				sb.WriteByte(p.data[p.pos])
+				p.pos++
+			} else if ch == quote {
+				quote = 0
+			} else if ch == '\n' {
+				return "", 0, p.errorf(line, "unterminated string")
+			}
+			continue
+		}
+
+		switch {
+		case ch == '"' || ch == '\'':
+			quote = ch
+		case depth == 0 && strings.HasPrefix(p.data[p.pos:], "//"):
+			p.skipLineComment()
+			continue
+		case strings.HasPrefix(p.data[p.pos:], "/*"):
+			if err := p.skipBlockComment(); err != nil {
+				return "", 0, err
+			}
+			sb.WriteByte(' ')
+			continue
+		case strings.HasPrefix(p.data[p.pos:], "#{"):
+			depth++
+			sb.WriteString("#{")
+			p.pos += 2
+			continue
+		case ch == '(' || ch == '[':
+			depth++
+		case ch == ')' || ch == ']':
+			if depth == 0 {
+				return "", 0, p.errorf(p.line, "unexpected '%c'", ch)
+			}
+			depth--
+		case ch == '}' && depth > 0:
+			depth-- // end of interpolation
+		case depth == 0 && (ch == ';' || ch == '{' || ch == '}'):
+			if ch != '}' {
+				p.pos++
+			}
+			return strings.TrimSpace(sb.String()), ch, nil
+		}
+		sb.WriteByte(ch)
+		p.pos++
+	}
+	if quote != 0 {
+		return "", 0, p.errorf(line, "unterminated string")
+	}
+	if depth != 0 {
+		return "", 0, p.errorf(line, "unbalanced parentheses or brackets")
+	}
+	return strings.TrimSpace(sb.String()), 0, nil
+}
+
+// splitAtRule splits text like "@media screen" into "media" and "screen".
+func splitAtRule(text string) (name, params string) {
+	text = text[1:]
+	i := strings.IndexFunc(text, func(r rune) bool {
+		return r == ' ' || r == '\t' || r == '\n' || r == '\r' || r == '(' || r == '"' || r == '\''
+	})
+	if i < 0 {
+		return text, ""
+	}
+	return text[:i], strings.TrimSpace(text[i:])
+}
@@ -0,0 +1,611 @@
+// Copyright 2023 Daniel Erat.
+// All rights reserved.
+
+// Package scss compiles a subset of SCSS to compressed CSS.
+//
+// Variables, nested rules (including the parent selector '&'), mixins, @import of other
+// SCSS files, and @media are supported. Other Sass features (control directives, functions,
+// arithmetic, @extend, etc.) are rejected with errors. Plain CSS functions like rgba() and
+// calc() are passed through.
+package scss
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// CompileFile compiles the SCSS file at p to compressed CSS.
+// The paths of p and all files that it imported are also returned.
+func CompileFile(p string) (css string, files []string, err error) {
+	b, err := ioutil.ReadFile(p)
+	if err != nil {
+		return "", nil, err
+	}
+	c := newCompiler()
+	if err := c.compile(p, string(b)); err != nil {
+		return "", nil, err
+	}
+	return c.css(), c.files, nil
+}
+
+// Compile compiles the supplied SCSS data to compressed CSS.
+// name is used in error messages and to resolve relative @import paths.
+func Compile(name, data string) (string, error) {
+	c := newCompiler()
+	if err := c.compile(name, data); err != nil {
+		return "", err
+	}
+	return c.css(), nil
+}
+
+// compiler evaluates parsed SCSS and collects the resulting CSS.
+type compiler struct {
+	global    *scope
+	out       []*outBlock     // top-level output in order
+	files     []string        // files that were compiled
+	importing map[string]bool // files that are currently being imported
+}
+
+func newCompiler() *compiler {
+	return &compiler{global: newScope(nil), importing: make(map[string]bool)}
+}
+
+// outBlock is a top-level block of CSS output.
+type outBlock struct {
+	media string     // media query (empty for a regular rule)
+	rules []*outRule // should only contain one rule if media is empty
+}
+
+// outRule is a single CSS rule in the output.
+type outRule struct {
+	sels  []string // fully-resolved selectors
+	decls []string // "prop:value"
+}
+
+// context describes the position of the statements being evaluated.
+type context struct {
+	sels  []string  // resolved selectors of the enclosing rule
+	media *outBlock // enclosing @media block (nil if none)
+	sc    *scope
+}
+
+// compile parses and evaluates the file p with the supplied data.
+func (c *compiler) compile(p, data string) error {
+	nodes, err := parse(p, data)
+	if err != nil {
+		return err
+	}
+	c.files = append(c.files, p)
+	c.importing[p] = true
+	defer delete(c.importing, p)
+	_, err = c.eval(nodes, context{sc: c.global}, nil)
+	return err
+}
+
+// css returns the compressed CSS for everything that has been compiled.
+func (c *compiler) css() string {
+	var sb strings.Builder
+	writeRules := func(rules []*outRule) {
+		for _, r := range rules {
+			sb.WriteString(strings.Join(r.sels, ","))
+			sb.WriteByte('{')
+			sb.WriteString(strings.Join(r.decls, ";"))
+			sb.WriteByte('}')
+		}
+	}
+	for _, b := range c.out {
+		if len(b.rules) == 0 {
+			continue
+		}
+		if b.media != "" {
+			sb.WriteString("@media " + b.media + "{")
+			writeRules(b.rules)
+			sb.WriteByte('}')
+		} else {
+			writeRules(b.rules)
+		}
+	}
+	if sb.Len() > 0 {
+		sb.WriteByte('\n') // match sassc
+	}
+	return sb.String()
+}
+
+// emit adds r to the output within ctx.
+func (c *compiler) emit(r *outRule, ctx context) {
+	if ctx.media != nil {
+		ctx.media.rules = append(ctx.media.rules, r)
+	} else {
+		c.out = append(c.out, &outBlock{rules: []*outRule{r}})
+	}
+}
+
+// eval evaluates nodes within ctx. cur is the output rule that declarations should be
+// appended to (or nil if a new rule should be started). The rule that subsequent
+// declarations should be appended to is returned.
+func (c *compiler) eval(nodes []*node, ctx context, cur *outRule) (*outRule, error) {
+	for _, n := range nodes {
+		if n.typ != atNode && n.block {
+			return nil, n.errorf("unexpected block")
+		}
+		switch n.typ {
+		case varNode:
+			if err := c.evalVar(n, ctx.sc); err != nil {
+				return nil, err
+			}
+		case declNode:
+			if len(ctx.sels) == 0 {
+				return nil, n.errorf("declaration %q outside of rule", n.name)
+			}
+			prop, err := c.interpolate(n, n.name, ctx.sc)
+			if err != nil {
+				return nil, err
+			}
+			val := n.value
+			if !strings.HasPrefix(prop, "--") {
+				if val, err = c.value(n, val, ctx.sc); err != nil {
+					return nil, err
+				}
+			}
+			if val == "" {
+				return nil, n.errorf("missing value for %q", prop)
+			}
+			if cur == nil {
+				cur = &outRule{sels: ctx.sels}
+				c.emit(cur, ctx)
+			}
+			cur.decls = append(cur.decls, prop+":"+val)
+		case ruleNode:
+			sel, err := c.interpolate(n, n.name, ctx.sc)
+			if err != nil {
+				return nil, err
+			}
+			sels, err := resolveSelectors(ctx.sels, sel)
+			if err != nil {
+				return nil, n.errorf("%v", err)
+			}
+			if _, err := c.eval(n.children, context{sels, ctx.media, newScope(ctx.sc)}, nil); err != nil {
+				return nil, err
+			}
+			cur = nil
+		case atNode:
+			var err error
+			if cur, err = c.evalAtRule(n, ctx, cur); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return cur, nil
+}
+
+// evalVar evaluates a variable declaration within sc.
+func (c *compiler) evalVar(n *node, sc *scope) error {
+	val := n.value
+	var def, global bool
+	for {
+		if s := strings.TrimSuffix(val, "!default"); s != val {
+			val, def = strings.TrimSpace(s), true
+		} else if s := strings.TrimSuffix(val, "!global"); s != val {
+			val, global = strings.TrimSpace(s), true
+		} else {
+			break
+		}
+	}
+	if global {
+		sc = c.global
+	}
+	if _, ok := sc.lookupVar(n.name); ok && def {
+		return nil
+	}
+	val, err := c.value(n, val, sc)
+	if err != nil {
+		return err
+	}
+	if val == "" {
+		return n.errorf("missing value for $%s", n.name)
+	}
+	sc.vars[normalizeName(n.name)] = val
+	return nil
+}
+
+// evalAtRule evaluates an at-rule. cur and the return value are as described for eval.
+func (c *compiler) evalAtRule(n *node, ctx context, cur *outRule) (*outRule, error) {
+	needBlock := func(want bool) error {
+		if n.block && !want {
+			return n.errorf("unexpected block after @%s", n.name)
+		} else if !n.block && want {
+			return n.errorf("missing block after @%s", n.name)
+		}
+		return nil
+	}
+
+	switch n.name {
+	case "media":
+		if err := needBlock(true); err != nil {
+			return nil, err
+		}
+		query, err := c.value(n, n.value, ctx.sc)
+		if err != nil {
+			return nil, err
+		}
+		if query == "" {
+			return nil, n.errorf("missing media query")
+		}
+		query = normalizeMediaQuery(query)
+		if ctx.media != nil {
+			query = combineMediaQueries(ctx.media.media, query)
+		}
+		mb := &outBlock{media: query}
+		c.out = append(c.out, mb)
+		if _, err := c.eval(n.children, context{ctx.sels, mb, newScope(ctx.sc)}, nil); err != nil {
+			return nil, err
+		}
+		return nil, nil
+
+	case "import":
+		if err := needBlock(false); err != nil {
+			return nil, err
+		}
+		for _, arg := range splitList(n.value) {
+			p, err := c.resolveImport(n, arg)
+			if err != nil {
+				return nil, err
+			}
+			b, err := ioutil.ReadFile(p)
+			if err != nil {
+				return nil, n.errorf("%v", err)
+			}
+			nodes, err := parse(p, string(b))
+			if err != nil {
+				return nil, err
+			}
+			c.files = append(c.files, p)
+			c.importing[p] = true
+			_, err = c.eval(nodes, ctx, nil)
+			delete(c.importing, p)
+			if err != nil {
+				return nil, err
+			}
+		}
+		return nil, nil
+
+	case "mixin":
+		if err := needBlock(true); err != nil {
+			return nil, err
+		}
+		name, args, err := splitCall(n.value)
+		if err != nil {
+			return nil, n.errorf("%v", err)
+		}
+		m := &mixin{body: n.children, sc: ctx.sc}
+		for _, a := range args {
+			pn, def, hasDef := splitNamedArg(a)
+			if pn == "" {
+				return nil, n.errorf("bad mixin parameter %q", a)
+			}
+			m.params = append(m.params, param{pn, def, hasDef})
+		}
+		ctx.sc.mixins[name] = m
+		return cur, nil
+
+	case "include":
+		if err := needBlock(false); err != nil {
+			return nil, n.errorf("%v (@content is unsupported)", err)
+		}
+		name, args, err := splitCall(n.value)
+		if err != nil {
+			return nil, n.errorf("%v", err)
+		}
+		m, ok := ctx.sc.lookupMixin(name)
+		if !ok {
+			return nil, n.errorf("undefined mixin %q", name)
+		}
+		msc, err := c.bindArgs(n, m, args, ctx.sc)
+		if err != nil {
+			return nil, err
+		}
+		// Declarations from the mixin are added to the current rule.
+		return c.eval(m.body, context{ctx.sels, ctx.media, msc}, cur)
+
+	default:
+		return nil, n.errorf("unsupported at-rule @%s", n.name)
+	}
+}
+
+// resolveImport returns the path of the SCSS file referred to by arg, a quoted path from
+// an @import statement in n.
+func (c *compiler) resolveImport(n *node, arg string) (string, error) {
+	if len(arg) < 2 || (arg[0] != '"' && arg[0] != '\'') || arg[len(arg)-1] != arg[0] {
+		return "", n.errorf("@import requires a quoted path (plain CSS imports are unsupported)")
+	}
+	name := arg[1 : len(arg)-1]
+	if strings.HasSuffix(name, ".css") || strings.Contains(name, "://") {
+		return "", n.errorf("plain CSS import of %q is unsupported", name)
+	}
+
+	dir, base := filepath.Split(filepath.Join(filepath.Dir(n.file), name))
+	var cands []string
+	if strings.HasSuffix(base, ".scss") {
+		cands = []string{base}
+	} else {
+		cands = []string{base + ".scss", "_" + base + ".scss"}
+	}
+	for _, cand := range cands {
+		p := filepath.Join(dir, cand)
+		if _, err := os.Stat(p); err == nil {
+			if c.importing[p] {
+				return "", n.errorf("recursive import of %v", p)
+			}
+			return p, nil
+		}
+	}
+	return "", n.errorf("can't find file to import for %q", name)
+}
+
+// bindArgs returns a new scope for calling m with the supplied arguments from n.
+func (c *compiler) bindArgs(n *node, m *mixin, args []string, caller *scope) (*scope, error) {
+	sc := newScope(m.sc)
+	named := make(map[string]string)
+	var pos []string
+	for _, a := range args {
+		v := a
+		name, nv, ok := splitNamedArg(a)
+		if ok && name != "" {
+			v = nv
+		}
+		v, err := c.value(n, v, caller)
+		if err != nil {
+			return nil, err
+		}
+		if ok && name != "" {
+			named[name] = v
+		} else if len(named) > 0 {
+			return nil, n.errorf("positional argument after named arguments")
+		} else {
+			pos = append(pos, v)
+		}
+	}
+	if len(pos) > len(m.params) {
+		return nil, n.errorf("got %d argument(s) but mixin takes %d", len(pos), len(m.params))
+	}
+	for i, p := range m.params {
+		if i < len(pos) {
+			sc.vars[p.name] = pos[i]
+		} else if v, ok := named[p.name]; ok {
+			sc.vars[p.name] = v
+			delete(named, p.name)
+		} else if p.hasDef {
+			// Defaults are evaluated in the mixin's scope and can refer to earlier params.
+			v, err := c.value(n, p.def, sc)
+			if err != nil {
+				return nil, err
+			}
+			sc.vars[p.name] = v
+		} else {
+			return nil, n.errorf("missing argument $%s", p.name)
+		}
+	}
+	if len(named) > 0 {
+		var names []string
+		for name := range named {
+			names = append(names, "$"+name)
+		}
+		sort.Strings(names)
+		return nil, n.errorf("no parameter(s) named %s", strings.Join(names, ", "))
+	}
+	return sc, nil
+}
+
+// value substitutes variables and interpolation in s (from n) using sc and normalizes whitespace.
+// An error is returned if s uses unsupported features like arithmetic or Sass functions.
+func (c *compiler) value(n *node, s string, sc *scope) (string, error) {
+	if err := checkExpr(n, s); err != nil {
+		return "", err
+	}
+	return c.subst(n, s, sc, true)
+}
+
+// interpolate is like value but only replaces interpolation (e.g. "#{$var}").
+func (c *compiler) interpolate(n *node, s string, sc *scope) (string, error) {
+	return c.subst(n, s, sc, false)
+}
+
+func (c *compiler) subst(n *node, s string, sc *scope, vars bool) (string, error) {
+	var sb strings.Builder
+	var quote byte
+	space := false // pending whitespace
+	for i := 0; i < len(s); i++ {
+		ch := s[i]
+		if quote != 0 && !strings.HasPrefix(s[i:], "#{") {
+			sb.WriteByte(ch)
+			if ch == '\\' && i+1 < len(s) {
+				i++
+				sb.WriteByte(s[i])
+			} else if ch == quote {
+				quote = 0
+			}
+			continue
+		}
+		if quote == 0 {
+			if isSpace(ch) {
+				space = true
+				continue
+			}
+			if space && sb.Len() > 0 {
+				sb.WriteByte(' ')
+			}
+			space = false
+		}
+
+		switch {
+		case ch == '"' || ch == '\'':
+			quote = ch
+			sb.WriteByte(ch)
+		case strings.HasPrefix(s[i:], "#{"):
+			end := strings.IndexByte(s[i:], '}')
+			if end < 0 {
+				return "", n.errorf("unterminated interpolation")
+			}
+			v, err := c.value(n, s[i+2:i+end], sc)
+			if err != nil {
+				return "", err
+			}
+			sb.WriteString(unquote(v))
+			i += end
+		case ch == '$' && vars:
+			j := i + 1
+			for j < len(s) && isNameChar(s[j]) {
+				j++
+			}
+			name := s[i+1 : j]
+			if name == "" {
+				return "", n.errorf("bad variable reference")
+			}
+			v, ok := sc.lookupVar(name)
+			if !ok {
+				return "", n.errorf("undefined variable $%s", name)
+			}
+			sb.WriteString(v)
+			i = j - 1
+		default:
+			sb.WriteByte(ch)
+		}
+	}
+	return sb.String(), nil
+}
+
+// mixin is a mixin defined via @mixin.
+type mixin struct {
+	params []param
+	body   []*node
+	sc     *scope // scope in which the mixin was defined
+}
+
+// param is a mixin parameter.
+type param struct {
+	name   string // without '$'
+	def    string // default value
+	hasDef bool   // true if def was supplied
+}
+
+// scope holds variables and mixins defined within a block.
+type scope struct {
+	parent *scope
+	vars   map[string]string
+	mixins map[string]*mixin
+}
+
+func newScope(parent *scope) *scope {
+	return &scope{parent, make(map[string]string), make(map[string]*mixin)}
+}
+
+func (sc *scope) lookupVar(name string) (string, bool) {
+	for ; sc != nil; sc = sc.parent {
+		if v, ok := sc.vars[normalizeName(name)]; ok {
+			return v, true
+		}
+	}
+	return "", false
+}
+
+func (sc *scope) lookupMixin(name string) (*mixin, bool) {
+	for ; sc != nil; sc = sc.parent {
+		if m, ok := sc.mixins[normalizeName(name)]; ok {
+			return m, true
+		}
+	}
+	return nil, false
+}
+
+// normalizeName handles Sass treating hyphens and underscores as equivalent in names.
+func normalizeName(name string) string {
+	return strings.ReplaceAll(name, "_", "-")
+}
+
+// splitCall splits s (e.g. "name($a, $b: 2)" or "name") into a name and arguments.
+func splitCall(s string) (name string, args []string, err error) {
+	i := strings.IndexByte(s, '(')
+	if i < 0 {
+		name = strings.TrimSpace(s)
+	} else {
+		if !strings.HasSuffix(s, ")") {
+			return "", nil, fmt.Errorf("bad arguments in %q", s)
+		}
+		name = strings.TrimSpace(s[:i])
+		args = splitList(s[i+1 : len(s)-1])
+	}
+	if name == "" || strings.IndexFunc(name, func(r rune) bool { return r > 127 || !isNameChar(byte(r)) }) >= 0 {
+		return "", nil, fmt.Errorf("bad name in %q", s)
+	}
+	return normalizeName(name), args, nil
+}
+
+// splitNamedArg splits s (e.g. "$name: value") into a name (without '$') and value.
+// If s is a bare variable like "$name", ok is false and name is still returned.
+func splitNamedArg(s string) (name, value string, ok bool) {
+	if !strings.HasPrefix(s, "$") {
+		return "", "", false
+	}
+	i := strings.IndexByte(s, ':')
+	if i < 0 {
+		return normalizeName(strings.TrimSpace(s[1:])), "", false
+	}
+	return normalizeName(strings.TrimSpace(s[1:i])), strings.TrimSpace(s[i+1:]), true
+}
+
+// splitList splits s on commas that aren't within parentheses, brackets, or quotes.
+// Items are trimmed and empty items are dropped.
+func splitList(s string) []string {
+	var items []string
+	var depth int
+	var quote byte
+	start := 0
+	add := func(end int) {
+		if it := strings.TrimSpace(s[start:end]); it != "" {
+			items = append(items, it)
+		}
+		start = end + 1
+	}
+	for i := 0; i < len(s); i++ {
+		ch := s[i]
+		switch {
+		case quote != 0:
+			if ch == '\\' {
+				i++
+			} else if ch == quote {
+				quote = 0
+			}
+		case ch == '"' || ch == '\'':
+			quote = ch
+		case ch == '(' || ch == '[':
+			depth++
+		case ch == ')' || ch == ']':
+			depth--
+		case ch == ',' && depth == 0:
+			add(i)
+		}
+	}
+	add(len(s))
+	return items
+}
+
+// unquote removes surrounding quotes from s, if present.
+func unquote(s string) string {
+	if len(s) >= 2 && (s[0] == '"' || s[0] == '\'') && s[len(s)-1] == s[0] {
+		return s[1 : len(s)-1]
+	}
+	return s
+}
+
+func isSpace(ch byte) bool {
+	return ch == ' ' || ch == '\t' || ch == '\n' || ch == '\r' || ch == '\f'
+}
+
+func isNameChar(ch byte) bool {
+	return ch == '-' || ch == '_' ||
+		(ch >= 'a' && ch <= 'z') || (ch >= 'A' && ch <= 'Z') || (ch >= '0' && ch <= '9')
+}
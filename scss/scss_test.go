@@ -0,0 +1,182 @@
+// Copyright 2023 Daniel Erat.
+// All rights reserved.
+
+package scss
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCompile(t *testing.T) {
+	for _, tc := range []struct {
+		in, want string
+	}{
+		{"", ""},
+		{"a { color: red; }", "a{color:red}"},
+		{"a, b  >  c { margin: 0 auto ; padding:1px }", "a,b>c{margin:0 auto;padding:1px}"},
+		{"// comment\na { /* inner */ color: red; } // trailing", "a{color:red}"},
+		{"a { background: url(http://example.org/a.png); }", "a{background:url(http://example.org/a.png)}"},
+		{"a { font-family: Arial,  Helvetica; content: '  //  '; }", "a{font-family:Arial, Helvetica;content:'  //  '}"},
+		{"a { b { c: d; } }", "a b{c:d}"},
+		{"a, b { c, d { e: f } }", "a c,a d,b c,b d{e:f}"},
+		{"a { &:hover { b: c } &.x, & + & { d: e } }", "a:hover{b:c}a.x,a+a{d:e}"},
+		{"a { > b { c: d } ~ e { f: g } }", "a>b{c:d}a~e{f:g}"},
+		{".box > { .title { a: b } .body { c: d } }", ".box>.title{a:b}.box>.body{c:d}"},
+		{"a { b: c; d { e: f } g: h }", "a{b:c}a d{e:f}a{g:h}"},
+		{"a:not(.b  >  .c) { d: e }", "a:not(.b > .c){d:e}"},
+		{"input[type~=\"x\"] { a: b }", "input[type~=\"x\"]{a:b}"},
+		{"$c: #333;\na { color: $c; }", "a{color:#333}"},
+		{"$a: 1px; $b: $a solid;\na { border: $b }", "a{border:1px solid}"},
+		{"$a: 1px; a { $a: 2px; b: $a } c { d: $a }", "a{b:2px}c{d:1px}"},
+		{"$a: 1px; $a: 2px !default; a { b: $a }", "a{b:1px}"},
+		{"$my-var: 1px; a { b: $my_var }", "a{b:1px}"},
+		{"$n: foo; .#{$n}-bar { #{$n}-x: '#{$n}' }", ".foo-bar{foo-x:'foo'}"},
+		{"a { b: c !important; }", "a{b:c !important}"},
+		{"$a: 1px; a { --x:  $a  2px ; }", "a{--x:$a  2px}"},
+		{"@mixin m { a: b; c { d: e } }\nx { y: z; @include m; w: v }", "x{y:z;a:b}x c{d:e}x{w:v}"},
+		{"@mixin m($a, $b: 2px) { p: $a $b }\nx { @include m(1px); }\ny { @include m(3px, $b: 4px) }",
+			"x{p:1px 2px}y{p:3px 4px}"},
+		{"$v: 5px; @mixin m($a: $v) { p: $a }\nx { @include m }", "x{p:5px}"},
+		{"@media screen and (max-width: 100px), print { a { b: c } d { e: f } }",
+			"@media screen and (max-width: 100px),print{a{b:c}d{e:f}}"},
+		{"a { b: c; @media print { d: e; f { g: h } } i: j }", "a{b:c}@media print{a{d:e}a f{g:h}}a{i:j}"},
+		{"@media screen { a { @media (min-width: 1px) { b: c } } }",
+			"@media screen and (min-width: 1px){a{b:c}}"},
+		{"a{b:c}d{e:f}", "a{b:c}d{e:f}"},
+		{"a { b: c }\n\n", "a{b:c}"},
+		{"a { }", ""},
+		{"$w: 2px; a { width: calc(100% - #{$w} * 2); margin: 0 -1px; font: 12px/1.5 serif; }",
+			"a{width:calc(100% - 2px * 2);margin:0 -1px;font:12px/1.5 serif}"},
+		{"a { color: rgba(0, 0, 0, .5); transform: translateX(-50%) rotate(45deg); }",
+			"a{color:rgba(0, 0, 0, .5);transform:translateX(-50%) rotate(45deg)}"},
+	} {
+		got, err := Compile("test.scss", tc.in)
+		if err != nil {
+			t.Errorf("Compile(%q) failed: %v", tc.in, err)
+			continue
+		}
+		want := tc.want
+		if want != "" {
+			want += "\n"
+		}
+		if got != want {
+			t.Errorf("Compile(%q) = %q; want %q", tc.in, got, want)
+		}
+	}
+}
+
+func TestCompile_Errors(t *testing.T) {
+	for _, tc := range []struct {
+		in, want string
+	}{
+		{"a { b: c;", "test.scss:1: missing '}'"},
+		{"a { b: c; }\n}", "test.scss:2: unexpected '}'"},
+		{"a {\n  b;\n}", "test.scss:2: expected declaration but got \"b\""},
+		{"a {\n  color: $nope;\n}", "test.scss:2: undefined variable $nope"},
+		{"\n\nb: c;", "test.scss:3: declaration \"b\" outside of rule"},
+		{"a {\n  @include nope;\n}", "test.scss:2: undefined mixin \"nope\""},
+		{"@mixin m($a) { b: $a }\na { @include m; }", "test.scss:2: missing argument $a"},
+		{"@mixin m { b: c }\na { @include m(1px); }", "test.scss:2: got 1 argument(s) but mixin takes 0"},
+		{"a {\n  @if true { b: c }\n}", "test.scss:2: unsupported at-rule @if"},
+		{"@keyframes x { from { a: b } }", "test.scss:1: unsupported at-rule @keyframes"},
+		{"a {\n  font: {\n    family: x;\n  }\n}", "test.scss:2: nested properties are unsupported"},
+		{"a { b: 'c; }", "test.scss:1: unterminated string"},
+		{"& { a: b }", "test.scss:1: '&' used in top-level selector"},
+		{"@import 'missing';", "test.scss:1: can't find file to import for \"missing\""},
+		{"@import url(foo.css);", "test.scss:1: @import requires a quoted path (plain CSS imports are unsupported)"},
+		{"/* a\n\n", "test.scss:1: unterminated comment"},
+		{"$a: 1px;\nb {\n  c: $a + 2px;\n}", "test.scss:3: unsupported arithmetic \"$a + 2px\""},
+		{"a {\n  b: 1px*2;\n}", "test.scss:2: unsupported arithmetic \"1px * 2\""},
+		{"a { b: 4px - 1px; }", "test.scss:1: unsupported arithmetic \"4px - 1px\""},
+		{"$a: 10px;\nb { c: $a / 2; }", "test.scss:2: unsupported arithmetic \"$a / 2\""},
+		{"a { b: 5 % 2; }", "test.scss:1: unsupported arithmetic \"5 % 2\""},
+		{"$a: 1px;\n$b: $a+$a;", "test.scss:2: unsupported arithmetic \"$a + $a\""},
+		{"a {\n  color: darken(red, 10%);\n}", "test.scss:2: unsupported function darken()"},
+		{"@mixin m($a) { b: $a }\na { @include m(lighten(#fff, 5%)); }", "test.scss:2: unsupported function lighten()"},
+	} {
+		if got, err := Compile("test.scss", tc.in); err == nil {
+			t.Errorf("Compile(%q) unexpectedly succeeded with %q", tc.in, got)
+		} else if err.Error() != tc.want {
+			t.Errorf("Compile(%q) returned error %q; want %q", tc.in, err.Error(), tc.want)
+		}
+	}
+}
+
+func TestCompileFile_Import(t *testing.T) {
+	dir, err := ioutil.TempDir("", "scss_test.")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	for fn, data := range map[string]string{
+		"main.scss":        "@import 'vars', 'sub/rules';\nb { c: $color }",
+		"_vars.scss":       "$color: red;\n@mixin m { d: $color }",
+		"sub/_rules.scss":  "@import 'more.scss';\na { @include m; }",
+		"sub/more.scss":    "e { f: g }",
+		"loop.scss":        "@import 'loop';",
+		"sub/bad.scss":     "a {\n  b: $undefined;\n}",
+		"importbad.scss":   "@import 'sub/bad';",
+		"sub/unused.scss":  "x { y: z }",
+		"sub/another.scss": "",
+	} {
+		p := filepath.Join(dir, fn)
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(p, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	css, files, err := CompileFile(filepath.Join(dir, "main.scss"))
+	if err != nil {
+		t.Fatal("CompileFile failed:", err)
+	}
+	if want := "e{f:g}a{d:red}b{c:red}\n"; css != want {
+		t.Errorf("CompileFile returned %q; want %q", css, want)
+	}
+	for i := range files {
+		files[i] = files[i][len(dir)+1:]
+	}
+	if got, want := strings.Join(files, " "), "main.scss _vars.scss sub/_rules.scss sub/more.scss"; got != want {
+		t.Errorf("CompileFile returned files %q; want %q", got, want)
+	}
+
+	if _, _, err := CompileFile(filepath.Join(dir, "loop.scss")); err == nil {
+		t.Error("CompileFile unexpectedly succeeded for recursive import")
+	}
+	want := filepath.Join(dir, "sub/bad.scss") + ":2: undefined variable $undefined"
+	if _, _, err := CompileFile(filepath.Join(dir, "importbad.scss")); err == nil {
+		t.Error("CompileFile unexpectedly succeeded for bad imported file")
+	} else if err.Error() != want {
+		t.Errorf("CompileFile returned error %q; want %q", err.Error(), want)
+	}
+}
+
+func TestCompileFile_StdInline(t *testing.T) {
+	// The checked-in CSS files were originally generated by sassc, so make sure that
+	// we produce identical output.
+	ps, err := filepath.Glob("../render/inline/*.scss")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ps) == 0 {
+		t.Fatal("No SCSS files found")
+	}
+	for _, p := range ps {
+		want, err := ioutil.ReadFile(strings.TrimSuffix(p, ".scss") + ".css")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, _, err := CompileFile(p); err != nil {
+			t.Errorf("CompileFile(%q) failed: %v", p, err)
+		} else if got != string(want) {
+			t.Errorf("CompileFile(%q) = %q; want %q", p, got, string(want))
+		}
+	}
+}
@@ -0,0 +1,122 @@
+// Copyright 2023 Daniel Erat.
+// All rights reserved.
+
+package scss
+
+import (
+	"errors"
+	"strings"
+)
+
+// resolveSelectors combines the parent rule's resolved selectors (empty at the top level)
+// with a nested rule's selector list (e.g. "&.foo, > .bar").
+func resolveSelectors(parents []string, sel string) ([]string, error) {
+	var children []string
+	for _, s := range splitList(sel) {
+		children = append(children, normalizeSelector(s))
+	}
+	if len(children) == 0 {
+		return nil, errors.New("empty selector")
+	}
+
+	if len(parents) == 0 {
+		for _, ch := range children {
+			if strings.Contains(ch, "&") {
+				return nil, errors.New("'&' used in top-level selector")
+			}
+			if isCombinator(ch[0]) {
+				return nil, errors.New("top-level selector starts with combinator")
+			}
+		}
+		return children, nil
+	}
+
+	var sels []string
+	for _, p := range parents {
+		for _, ch := range children {
+			switch {
+			case strings.Contains(ch, "&"):
+				sels = append(sels, strings.ReplaceAll(ch, "&", p))
+			case isCombinator(ch[0]) || isCombinator(p[len(p)-1]):
+				// Handle e.g. "> .foo" or a parent like ".box >".
+				sels = append(sels, p+ch)
+			default:
+				sels = append(sels, p+" "+ch)
+			}
+		}
+	}
+	return sels, nil
+}
+
+// normalizeSelector collapses whitespace in a single selector and removes
+// whitespace around combinators, e.g. "a  >  b c" becomes "a>b c".
+func normalizeSelector(sel string) string {
+	var sb strings.Builder
+	var depth int
+	var quote byte
+	space := false // pending whitespace
+	for i := 0; i < len(sel); i++ {
+		ch := sel[i]
+		if quote != 0 || depth > 0 {
+			// Copy strings, pseudo-class args, and attribute selectors verbatim.
+			switch {
+			case quote != 0 && ch == quote:
+				quote = 0
+			case quote == 0 && (ch == '"' || ch == '\''):
+				quote = ch
+			case quote == 0 && (ch == '(' || ch == '['):
+				depth++
+			case quote == 0 && (ch == ')' || ch == ']'):
+				depth--
+			}
+			sb.WriteByte(ch)
+			continue
+		}
+
+		switch {
+		case isSpace(ch):
+			space = true
+			continue
+		case isCombinator(ch):
+			sb.WriteByte(ch)
+			space = false
+			continue
+		}
+		if space && sb.Len() > 0 {
+			if s := sb.String(); !isCombinator(s[len(s)-1]) {
+				sb.WriteByte(' ')
+			}
+		}
+		space = false
+		switch ch {
+		case '"', '\'':
+			quote = ch
+		case '(', '[':
+			depth++
+		}
+		sb.WriteByte(ch)
+	}
+	return sb.String()
+}
+
+func isCombinator(ch byte) bool {
+	return ch == '>' || ch == '+' || ch == '~'
+}
+
+// normalizeMediaQuery collapses whitespace in a media query list and removes
+// whitespace after commas, e.g. "screen,  print" becomes "screen,print".
+func normalizeMediaQuery(q string) string {
+	return strings.Join(splitList(q), ",")
+}
+
+// combineMediaQueries combines an outer and nested media query list, e.g.
+// "screen" and "(min-width: 100px)" become "screen and (min-width: 100px)".
+func combineMediaQueries(outer, inner string) string {
+	var qs []string
+	for _, o := range splitList(outer) {
+		for _, in := range splitList(inner) {
+			qs = append(qs, o+" and "+in)
+		}
+	}
+	return strings.Join(qs, ",")
+}